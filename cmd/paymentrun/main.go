@@ -0,0 +1,107 @@
+// The payment run. This command submits the disbursements that are due in a bank file, as
+// POST /api/payment-batches does, or downloads the file of an earlier batch again.
+//
+// It reads the database and debtor settings the way the server does, from the environment, a .env file
+// or the file named by CONFIG_FILE, and takes its own options as flags:
+//
+//	paymentrun [-format pain.001|csv] [-currency SGD] [-date YYYY-MM-DD] [-out FILE]
+//	paymentrun -batch ID [-out FILE]
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"os/user"
+	"syscall"
+	"time"
+
+	"fas/internal/auth"
+	"fas/internal/config"
+	"fas/internal/database"
+	"fas/internal/logging"
+	"fas/internal/models"
+	"fas/internal/money"
+	"fas/internal/payment"
+)
+
+func main() {
+	format := flag.String("format", payment.FormatPain001, "format of the payment file: pain.001 or csv")
+	currency := flag.String("currency", money.DefaultCurrency, "currency of the disbursements to submit")
+	date := flag.String("date", "", "execution date; disbursements due by then are submitted (default today)")
+	batchID := flag.String("batch", "", "download the file of this batch again instead of creating one")
+	out := flag.String("out", "", "where to write the file; - for standard output (default the batch's file name)")
+	flag.Parse()
+
+	cfg, err := config.Load(nil)
+	if err != nil {
+		log.Fatal(err)
+	}
+	logging.Setup(os.Stderr, cfg.LogLevel)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Attribute the changes in the audit log to the user running the command
+	name := "paymentrun"
+	if u, err := user.Current(); err == nil {
+		name = u.Username
+	}
+	ctx = auth.WithPrincipal(ctx, auth.Principal{ID: "paymentrun", Name: name})
+
+	db, err := database.SetupDB(ctx, cfg)
+	if err != nil {
+		log.Fatalf("Could not set up database: %v", err)
+	}
+	defer db.Close()
+
+	var batch models.PaymentBatch
+	var content []byte
+	if *batchID != "" {
+		batch, content, err = payment.Download(ctx, db, *batchID)
+		if err != nil {
+			log.Fatalf("Could not download payment batch %s: %v", *batchID, err)
+		}
+	} else {
+		run := payment.Run{Format: *format, Currency: *currency, ExecutionDate: time.Now()}
+		if *date != "" {
+			if run.ExecutionDate, err = time.ParseInLocation("2006-01-02", *date, time.Local); err != nil {
+				log.Fatalf("Execution date %q must be in the format YYYY-MM-DD", *date)
+			}
+		}
+		debtor := payment.Debtor{Name: cfg.DebtorName, Account: cfg.DebtorAccount, BIC: cfg.DebtorBIC}
+		if batch, err = payment.Submit(ctx, db, debtor, run); err != nil {
+			log.Fatalf("Could not create payment batch: %v", err)
+		}
+		if _, content, err = payment.Download(ctx, db, batch.ID); err != nil {
+			log.Fatalf("Could not download payment batch %s: %v", batch.ID, err)
+		}
+	}
+
+	// Write the file, then report what it holds
+	path := *out
+	if path == "" {
+		path = batch.FileName
+	}
+	if path == "-" {
+		_, err = os.Stdout.Write(content)
+	} else {
+		err = os.WriteFile(path, content, 0o600)
+	}
+	if err != nil {
+		log.Fatalf("Could not write payment file: %v", err)
+	}
+
+	fmt.Fprintf(os.Stderr, "Batch %s: %d payments totalling %s %s, to be made on %s\n",
+		batch.ID, batch.Payments, batch.Total, batch.Currency, batch.ExecutionDate)
+	fmt.Fprintf(os.Stderr, "SHA-256 %s\n", batch.Checksum)
+	if batch.Skipped > 0 {
+		fmt.Fprintf(os.Stderr, "%d due payments were left scheduled as their applicants have no bank account\n", batch.Skipped)
+	}
+	if path != "-" {
+		fmt.Fprintf(os.Stderr, "Written to %s\n", path)
+	}
+}
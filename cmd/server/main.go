@@ -1,49 +1,97 @@
-// The entry point. This file sets up the server and routes for the application.
+// The entry point. This file sets up and runs the server; its routes are set up in routes.go.
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
 	"log"
+	"log/slog"
 	"net/http"
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
+	"time"
 
-	"github.com/gorilla/mux"
-
+	"fas/internal/auth"
+	"fas/internal/config"
 	"fas/internal/database"
-	"fas/internal/handlers"
-	"fas/internal/middleware"
+	"fas/internal/logging"
+	"fas/internal/metrics"
 )
 
 func main() {
 
+	// Load the configuration from flags, the environment and the configuration file
+	cfg, err := config.Load(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Log structured JSON, with personal details masked
+	logging.Setup(os.Stdout, cfg.LogLevel)
+
+	// Stop on SIGINT or SIGTERM, letting requests in flight finish
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
 	// Connect to database
-	db, err := database.SetupDB()
+	db, err := database.SetupDB(ctx, cfg)
 	if err != nil {
 		log.Fatalf("Could not set up database: %v", err)
 	}
 	defer db.Close()
 
+	// Store the bootstrap admin key, if one is configured
+	if cfg.AdminAPIKey != "" {
+		if err := auth.BootstrapAPIKey(ctx, db, cfg.AdminAPIKey); err != nil {
+			log.Fatalf("Could not store bootstrap API key: %v", err)
+		}
+	}
+
+	// Report the statistics of the connection pool with the other metrics
+	metrics.RegisterDBStats(db)
+
 	// Initialise router
-	r := mux.NewRouter()
-	
-	// Routes (API Endpoints)
-	// Applicants
-	r.Handle("/api/applicants", middleware.ValidateApplicant(handlers.CreateApplicant(db))).Methods(http.MethodPost)
-	r.Handle("/api/applicants/{id}", middleware.ValidateApplicant(handlers.UpdateApplicant(db))).Methods(http.MethodPut)
-	r.HandleFunc("/api/applicants", handlers.GetApplicants(db)).Methods(http.MethodGet)
-	r.HandleFunc("/api/applicants/{id}", handlers.DeleteApplicant(db)).Methods(http.MethodDelete)
-	
-	// Schemes
-	r.Handle("/api/schemes", middleware.ValidateScheme(handlers.CreateScheme(db))).Methods(http.MethodPost)
-	r.Handle("/api/schemes/{id}", middleware.ValidateScheme(handlers.UpdateScheme(db))).Methods(http.MethodPut)
-	r.HandleFunc("/api/schemes", handlers.GetSchemes(db)).Methods(http.MethodGet)
-	r.HandleFunc("/api/schemes/eligible", handlers.GetEligibleSchemes(db)).Methods(http.MethodGet)
-	r.HandleFunc("/api/schemes/{id}", handlers.DeleteScheme(db)).Methods(http.MethodDelete)
-	
-	// Applications
-	r.HandleFunc("/api/applications", handlers.CreateApplication(db)).Methods(http.MethodPost)
-	r.HandleFunc("/api/applications", handlers.GetApplications(db)).Methods(http.MethodGet)
-	r.HandleFunc("/api/applications/{id}", handlers.UpdateApplication(db)).Methods(http.MethodPut)
-	r.HandleFunc("/api/applications/{id}", handlers.DeleteApplication(db)).Methods(http.MethodDelete)
-	
+	var shuttingDown atomic.Bool
+	r := newRouter(db, cfg, &shuttingDown)
+
 	// Start server
-	log.Fatal(http.ListenAndServe(":8080", r))
-}
\ No newline at end of file
+	server := &http.Server{
+		Addr:              cfg.ListenAddr,
+		Handler:           r,
+		ReadHeaderTimeout: 5 * time.Second,
+		ReadTimeout:       cfg.ReadTimeout,
+		WriteTimeout:      cfg.WriteTimeout,
+		IdleTimeout:       cfg.IdleTimeout,
+	}
+	serverErr := make(chan error, 1)
+	go func() {
+		slog.Info("server listening", "addr", server.Addr, "tls", cfg.TLS())
+		if cfg.TLS() {
+			serverErr <- server.ListenAndServeTLS(cfg.TLSCertFile, cfg.TLSKeyFile)
+		} else {
+			serverErr <- server.ListenAndServe()
+		}
+	}()
+
+	select {
+	case err := <-serverErr:
+		log.Fatalf("Server failed: %v", err)
+	case <-ctx.Done():
+	}
+
+	// Fail readiness checks so that no new traffic is routed here, then drain the requests in flight
+	slog.Info("shutting down")
+	shuttingDown.Store(true)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		slog.Error("shutdown did not complete", "error", err)
+	}
+	slog.Info("server stopped")
+}
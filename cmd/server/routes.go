@@ -0,0 +1,125 @@
+// Sets up the routes of the server.
+package main
+
+import (
+	"database/sql"
+	"net/http"
+	"sync/atomic"
+
+	"github.com/gorilla/mux"
+
+	"fas/internal/auth"
+	"fas/internal/config"
+	"fas/internal/handlers"
+	"fas/internal/metrics"
+	"fas/internal/middleware"
+	"fas/internal/openapi"
+	"fas/internal/payment"
+)
+
+// newRouter registers every route of the server. Each route must also be described in the openapi package.
+// shuttingDown fails the readiness check once the server starts shutting down.
+func newRouter(db *sql.DB, cfg config.Config, shuttingDown *atomic.Bool) *mux.Router {
+	r := mux.NewRouter()
+	r.Use(middleware.RequestID)
+	r.Use(middleware.AccessLog)
+	r.Use(middleware.Metrics)
+
+	// Health checks are made without authentication
+	r.HandleFunc("/healthz", handlers.Healthz()).Methods(http.MethodGet)
+	r.HandleFunc("/readyz", handlers.Readyz(db, shuttingDown)).Methods(http.MethodGet)
+
+	// Metrics are scraped without authentication, so they carry no personal details
+	r.Handle("/metrics", metrics.Handler()).Methods(http.MethodGet)
+
+	// The API documentation is public, so it is registered ahead of the authenticated routes
+	r.Handle("/api/openapi.json", openapi.Handler()).Methods(http.MethodGet)
+	r.Handle("/api/docs", openapi.UI()).Methods(http.MethodGet)
+
+	// Every API route requires an authenticated principal, and each route declares the permission it needs
+	api := r.PathPrefix("/api").Subrouter()
+	api.Use(middleware.Timeout(cfg.QueryTimeout))
+	api.Use(middleware.Authenticate(db, []byte(cfg.JWTSecret)))
+	api.Use(middleware.Idempotency(db))
+	allow := middleware.Authorize
+
+	// Routes (API Endpoints)
+	// Applicants
+	api.Handle("/applicants", allow(auth.PermApplicantsWrite, middleware.ValidateApplicant(handlers.CreateApplicant(db)))).Methods(http.MethodPost)
+	api.Handle("/applicants/{id}", allow(auth.PermApplicantsWrite, middleware.ValidateApplicant(handlers.UpdateApplicant(db)))).Methods(http.MethodPut)
+	api.Handle("/applicants", allow(auth.PermApplicantsRead, handlers.GetApplicants(db))).Methods(http.MethodGet)
+	api.Handle("/applicants/{id}", allow(auth.PermApplicantsRead, handlers.GetApplicant(db))).Methods(http.MethodGet)
+	api.Handle("/applicants/{id}", allow(auth.PermApplicantsWrite, handlers.DeleteApplicant(db))).Methods(http.MethodDelete)
+	api.Handle("/applicants/{id}/restore", allow(auth.PermApplicantsWrite, handlers.RestoreApplicant(db))).Methods(http.MethodPost)
+
+	// Schemes
+	api.Handle("/schemes", allow(auth.PermSchemesWrite, middleware.ValidateScheme(handlers.CreateScheme(db)))).Methods(http.MethodPost)
+	api.Handle("/schemes/{id}", allow(auth.PermSchemesWrite, middleware.ValidateScheme(handlers.UpdateScheme(db)))).Methods(http.MethodPut)
+	api.Handle("/schemes", allow(auth.PermSchemesRead, handlers.GetSchemes(db))).Methods(http.MethodGet)
+	api.Handle("/schemes/eligible", allow(auth.PermSchemesRead, handlers.GetEligibleSchemes(db))).Methods(http.MethodGet)
+	api.Handle("/schemes/{id}", allow(auth.PermSchemesRead, handlers.GetScheme(db))).Methods(http.MethodGet)
+	api.Handle("/schemes/{id}/eligibility", allow(auth.PermSchemesRead, handlers.GetEligibility(db))).Methods(http.MethodGet)
+	api.Handle("/schemes/{id}", allow(auth.PermSchemesWrite, handlers.DeleteScheme(db))).Methods(http.MethodDelete)
+	api.Handle("/schemes/{id}/restore", allow(auth.PermSchemesWrite, handlers.RestoreScheme(db))).Methods(http.MethodPost)
+	api.Handle("/schemes/{id}/criteria/{criteria_id}", allow(auth.PermSchemesWrite, handlers.AttachCriteria(db))).Methods(http.MethodPut)
+	api.Handle("/schemes/{id}/criteria/{criteria_id}", allow(auth.PermSchemesWrite, handlers.DetachCriteria(db))).Methods(http.MethodDelete)
+
+	// Benefits
+	api.Handle("/benefits", allow(auth.PermSchemesWrite, handlers.CreateBenefit(db))).Methods(http.MethodPost)
+	api.Handle("/benefits", allow(auth.PermSchemesRead, handlers.GetBenefits(db))).Methods(http.MethodGet)
+	api.Handle("/benefits/{id}", allow(auth.PermSchemesRead, handlers.GetBenefit(db))).Methods(http.MethodGet)
+	api.Handle("/benefits/{id}", allow(auth.PermSchemesWrite, handlers.UpdateBenefit(db))).Methods(http.MethodPut)
+	api.Handle("/benefits/{id}", allow(auth.PermSchemesWrite, handlers.DeleteBenefit(db))).Methods(http.MethodDelete)
+	api.Handle("/benefits/{id}/schemes", allow(auth.PermSchemesRead, handlers.GetBenefitSchemes(db))).Methods(http.MethodGet)
+
+	// Criteria
+	api.Handle("/criteria-types", allow(auth.PermSchemesRead, handlers.GetCriteriaTypes())).Methods(http.MethodGet)
+	api.Handle("/criteria", allow(auth.PermSchemesRead, handlers.GetCriteria(db))).Methods(http.MethodGet)
+	api.Handle("/criteria/{id}", allow(auth.PermSchemesRead, handlers.GetCriterion(db))).Methods(http.MethodGet)
+	api.Handle("/criteria/{id}/schemes", allow(auth.PermSchemesRead, handlers.GetCriteriaSchemes(db))).Methods(http.MethodGet)
+
+	// Applications
+	api.Handle("/applications", allow(auth.PermApplicationsWrite, handlers.CreateApplication(db))).Methods(http.MethodPost)
+	api.Handle("/applications", allow(auth.PermApplicationsRead, handlers.GetApplications(db))).Methods(http.MethodGet)
+	api.Handle("/applications/{id}", allow(auth.PermApplicationsRead, handlers.GetApplication(db))).Methods(http.MethodGet)
+	api.Handle("/applications/{id}", allow(auth.PermApplicationsWrite, handlers.UpdateApplication(db))).Methods(http.MethodPut)
+	api.Handle("/applications/{id}", allow(auth.PermApplicationsReview, handlers.PatchApplication(db))).Methods(http.MethodPatch)
+	api.Handle("/applications/{id}", allow(auth.PermApplicationsWrite, handlers.DeleteApplication(db))).Methods(http.MethodDelete)
+	api.Handle("/applications/{id}/restore", allow(auth.PermApplicationsWrite, handlers.RestoreApplication(db))).Methods(http.MethodPost)
+
+	// Disbursements
+	api.Handle("/applicants/{id}/disbursements", allow(auth.PermDisbursementsRead, handlers.GetApplicantDisbursements(db))).Methods(http.MethodGet)
+	api.Handle("/disbursements/totals", allow(auth.PermDisbursementsRead, handlers.GetDisbursementTotals(db))).Methods(http.MethodGet)
+	api.Handle("/disbursements/{id}", allow(auth.PermDisbursementsRead, handlers.GetDisbursement(db))).Methods(http.MethodGet)
+	api.Handle("/disbursements/{id}", allow(auth.PermDisbursementsWrite, handlers.PatchDisbursement(db))).Methods(http.MethodPatch)
+
+	// Payment batches
+	debtor := payment.Debtor{Name: cfg.DebtorName, Account: cfg.DebtorAccount, BIC: cfg.DebtorBIC}
+	api.Handle("/payment-batches", allow(auth.PermDisbursementsWrite, handlers.CreatePaymentBatch(db, debtor))).Methods(http.MethodPost)
+	api.Handle("/payment-batches", allow(auth.PermDisbursementsRead, handlers.GetPaymentBatches(db))).Methods(http.MethodGet)
+	api.Handle("/payment-batches/{id}", allow(auth.PermDisbursementsRead, handlers.GetPaymentBatch(db))).Methods(http.MethodGet)
+	api.Handle("/payment-batches/{id}/file", allow(auth.PermDisbursementsRead, handlers.GetPaymentBatchFile(db))).Methods(http.MethodGet)
+
+	// Reference data
+	api.Handle("/reference-data", allow(auth.PermReferenceDataRead, handlers.GetReferenceData(db))).Methods(http.MethodGet)
+	api.Handle("/reference-data/{category}", allow(auth.PermReferenceDataRead, handlers.GetReferenceDataCategory(db))).Methods(http.MethodGet)
+	api.Handle("/reference-data/{category}", allow(auth.PermReferenceDataWrite, handlers.CreateReferenceData(db))).Methods(http.MethodPost)
+	api.Handle("/reference-data/{category}/{id}", allow(auth.PermReferenceDataWrite, handlers.UpdateReferenceData(db))).Methods(http.MethodPut)
+	api.Handle("/reference-data/{category}/{id}", allow(auth.PermReferenceDataWrite, handlers.DeleteReferenceData(db))).Methods(http.MethodDelete)
+
+	// Current principal
+	api.HandleFunc("/me/permissions", handlers.GetMyPermissions()).Methods(http.MethodGet)
+
+	// Administration
+	api.Handle("/admin/api-keys", allow(auth.PermAPIKeysManage, handlers.GetAPIKeys(db))).Methods(http.MethodGet)
+	api.Handle("/admin/api-keys", allow(auth.PermAPIKeysManage, handlers.CreateAPIKey(db))).Methods(http.MethodPost)
+	api.Handle("/admin/api-keys/{id}", allow(auth.PermAPIKeysManage, handlers.RevokeAPIKey(db))).Methods(http.MethodDelete)
+	api.Handle("/admin/applicants/{id}", allow(auth.PermRecordsPurge, handlers.PurgeApplicant(db))).Methods(http.MethodDelete)
+	api.Handle("/admin/schemes/{id}", allow(auth.PermRecordsPurge, handlers.PurgeScheme(db))).Methods(http.MethodDelete)
+	api.Handle("/admin/applications/{id}", allow(auth.PermRecordsPurge, handlers.PurgeApplication(db))).Methods(http.MethodDelete)
+
+	// Audit log
+	api.Handle("/audit", allow(auth.PermAuditRead, handlers.GetAuditLog(db))).Methods(http.MethodGet)
+
+	return r
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/gorilla/mux"
+
+	"fas/internal/config"
+	"fas/internal/openapi"
+)
+
+// TestSpecCoversRoutes fails when a registered route is missing from the OpenAPI document, or the document
+// describes a route that is not registered.
+func TestSpecCoversRoutes(t *testing.T) {
+	var shuttingDown atomic.Bool
+	router := newRouter(nil, config.Defaults(), &shuttingDown)
+
+	paths, ok := openapi.Spec()["paths"].(map[string]interface{})
+	if !ok {
+		t.Fatal("the document has no paths")
+	}
+	described := make(map[string]bool)
+	for path, item := range paths {
+		for method := range item.(map[string]interface{}) {
+			described[strings.ToUpper(method)+" "+path] = true
+		}
+	}
+
+	registered := make(map[string]bool)
+	err := router.Walk(func(route *mux.Route, _ *mux.Router, _ []*mux.Route) error {
+		path, err := route.GetPathTemplate()
+		if err != nil {
+			return nil
+		}
+		methods, err := route.GetMethods()
+		if err != nil {
+			// Subrouters only match a prefix
+			return nil
+		}
+		for _, method := range methods {
+			registered[method+" "+path] = true
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(registered) == 0 {
+		t.Fatal("no routes are registered")
+	}
+
+	for route := range registered {
+		if !described[route] {
+			t.Errorf("%s is registered but not described in the OpenAPI document", route)
+		}
+	}
+	for route := range described {
+		if !registered[route] {
+			t.Errorf("%s is described in the OpenAPI document but not registered", route)
+		}
+	}
+}
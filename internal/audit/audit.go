@@ -0,0 +1,65 @@
+// Records who changed what, in the same transaction as the change.
+package audit
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+
+	"fas/internal/auth"
+	"fas/internal/utils"
+)
+
+// Actions recorded in the audit log.
+const (
+	ActionCreate  = "create"
+	ActionUpdate  = "update"
+	ActionDelete  = "delete"
+	ActionRevoke  = "revoke"
+	ActionRestore = "restore"
+	ActionPurge   = "purge"
+)
+
+// Entry describes a change to a single entity. Before is nil for creations and After for deletions.
+type Entry struct {
+	Action     string
+	EntityType string
+	EntityID   string
+	Before     interface{}
+	After      interface{}
+}
+
+// Record writes the entry to the audit log within the transaction making the change,
+// attributing it to the principal and request carried by the context.
+func Record(ctx context.Context, tx *sql.Tx, entry Entry) error {
+	before, err := snapshot(entry.Before)
+	if err != nil {
+		return err
+	}
+	after, err := snapshot(entry.After)
+	if err != nil {
+		return err
+	}
+
+	principal, _ := auth.PrincipalFrom(ctx)
+	_, err = tx.ExecContext(ctx, `INSERT INTO audit_log (id, actor, actor_name, action, entity_type, entity_id, request_id, before_json, after_json, created_at) 
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		uuid.New().String(), principal.ID, principal.Name, entry.Action, entry.EntityType, entry.EntityID,
+		utils.RequestID(ctx), before, after, time.Now().UTC())
+	return err
+}
+
+// snapshot encodes an entity as JSON, or NULL when there is none.
+func snapshot(entity interface{}) (interface{}, error) {
+	if entity == nil {
+		return nil, nil
+	}
+	data, err := json.Marshal(entity)
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
+}
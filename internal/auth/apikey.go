@@ -0,0 +1,75 @@
+// Issues and verifies API keys, of which only hashes are stored.
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// apiKeyPrefix marks strings that are API keys.
+const apiKeyPrefix = "fas_"
+
+var ErrInvalidCredentials = errors.New("invalid credentials")
+
+// GenerateAPIKey returns a new random API key together with the short prefix used to identify it.
+func GenerateAPIKey() (key, prefix string, err error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", "", err
+	}
+	key = apiKeyPrefix + base64.RawURLEncoding.EncodeToString(secret)
+	return key, key[:len(apiKeyPrefix)+8], nil
+}
+
+// HashAPIKey returns the hash under which an API key is stored.
+// Keys are long and random, so a fast hash is sufficient.
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// IsAPIKey reports whether a credential has the form of an API key.
+func IsAPIKey(credential string) bool {
+	return strings.HasPrefix(credential, apiKeyPrefix)
+}
+
+// AuthenticateAPIKey returns the principal owning an API key that has not been revoked.
+func AuthenticateAPIKey(ctx context.Context, db *sql.DB, key string) (Principal, error) {
+	principal := Principal{Method: MethodAPIKey}
+	var role string
+	err := db.QueryRowContext(ctx, `SELECT id, name, role FROM api_keys WHERE key_hash = ? AND revoked_at IS NULL`,
+		HashAPIKey(key)).Scan(&principal.ID, &principal.Name, &role)
+	if err == sql.ErrNoRows {
+		return Principal{}, ErrInvalidCredentials
+	}
+	if err != nil {
+		return Principal{}, err
+	}
+	principal.Roles = []string{role}
+
+	// Recording the last use is best effort and must not fail the request
+	db.ExecContext(ctx, `UPDATE api_keys SET last_used_at = ? WHERE id = ?`, time.Now(), principal.ID)
+
+	return principal, nil
+}
+
+// BootstrapAPIKey stores a configured admin key, so that the first keys can be issued through the API.
+func BootstrapAPIKey(ctx context.Context, db *sql.DB, key string) error {
+	if !IsAPIKey(key) || len(key) < len(apiKeyPrefix)+32 {
+		return errors.New("bootstrap API key must start with " + apiKeyPrefix + " and be at least 36 characters")
+	}
+
+	_, err := db.ExecContext(ctx, `INSERT IGNORE INTO api_keys (id, name, key_prefix, key_hash, role, created_by, created_at) 
+		VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		uuid.New().String(), "bootstrap", key[:len(apiKeyPrefix)+8], HashAPIKey(key), RoleAdmin, "system", time.Now())
+	return err
+}
@@ -0,0 +1,131 @@
+package auth
+
+import (
+	"encoding/base64"
+	"errors"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testSecret = []byte("test-secret")
+
+// craft builds a token from a raw header and payload, signed with the secret unless the signature is given.
+func craft(header, payload string, secret []byte, signature ...string) string {
+	unsigned := base64.RawURLEncoding.EncodeToString([]byte(header)) + "." + base64.RawURLEncoding.EncodeToString([]byte(payload))
+	if len(signature) > 0 {
+		return unsigned + "." + signature[0]
+	}
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(sign(unsigned, secret))
+}
+
+func TestParseJWTValid(t *testing.T) {
+	now := time.Now().Unix()
+	claims := Claims{Subject: "user-1", Name: "Ada", Roles: []string{RoleAdmin}, IssuedAt: now, NotBefore: now - 60, ExpiresAt: now + 3600}
+	token, err := SignJWT(claims, testSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !IsJWT(token) {
+		t.Errorf("IsJWT(%q) = false", token)
+	}
+
+	got, err := ParseJWT(token, testSecret)
+	if err != nil {
+		t.Fatalf("ParseJWT: %v", err)
+	}
+	if !reflect.DeepEqual(got, claims) {
+		t.Errorf("got %+v, want %+v", got, claims)
+	}
+
+	principal, err := AuthenticateJWT(token, testSecret)
+	if err != nil {
+		t.Fatalf("AuthenticateJWT: %v", err)
+	}
+	want := Principal{ID: "user-1", Name: "Ada", Method: MethodJWT, Roles: []string{RoleAdmin}}
+	if !reflect.DeepEqual(principal, want) {
+		t.Errorf("got %+v, want %+v", principal, want)
+	}
+}
+
+func TestParseJWTErrors(t *testing.T) {
+	now := time.Now().Unix()
+	valid, _ := SignJWT(Claims{Subject: "user-1", ExpiresAt: now + 3600}, testSecret)
+	other, _ := SignJWT(Claims{Subject: "user-2", ExpiresAt: now + 3600}, testSecret)
+	segments, otherSegments := strings.Split(valid, "."), strings.Split(other, ".")
+	hs256 := `{"alg":"HS256","typ":"JWT"}`
+	payload := `{"sub":"user-1","exp":` + itoa(now+3600) + `}`
+
+	tests := []struct {
+		name   string
+		token  string
+		secret []byte
+		want   error
+	}{
+		// Signatures
+		{"wrong secret", valid, []byte("another-secret"), ErrInvalidToken},
+		{"no secret configured", valid, nil, ErrInvalidToken},
+		{"tampered payload", segments[0] + "." + otherSegments[1] + "." + segments[2], testSecret, ErrInvalidToken},
+		{"empty signature", craft(hs256, payload, nil, ""), testSecret, ErrInvalidToken},
+		{"signature not base64", craft(hs256, payload, nil, "not*base64"), testSecret, ErrMalformedToken},
+
+		// Algorithms
+		{"alg none", craft(`{"alg":"none"}`, payload, nil, ""), testSecret, ErrInvalidToken},
+		{"alg none signed", craft(`{"alg":"none"}`, payload, testSecret), testSecret, ErrInvalidToken},
+		{"alg HS512", craft(`{"alg":"HS512"}`, payload, testSecret), testSecret, ErrInvalidToken},
+		{"alg RS256", craft(`{"alg":"RS256"}`, payload, testSecret), testSecret, ErrInvalidToken},
+		{"alg lower case", craft(`{"alg":"hs256"}`, payload, testSecret), testSecret, ErrInvalidToken},
+		{"alg missing", craft(`{"typ":"JWT"}`, payload, testSecret), testSecret, ErrInvalidToken},
+
+		// Validity period
+		{"expired", craft(hs256, `{"sub":"user-1","exp":`+itoa(now-1)+`}`, testSecret), testSecret, ErrExpiredToken},
+		{"expires now", craft(hs256, `{"sub":"user-1","exp":`+itoa(now)+`}`, testSecret), testSecret, ErrExpiredToken},
+		{"no expiry", craft(hs256, `{"sub":"user-1"}`, testSecret), testSecret, ErrExpiredToken},
+		{"not yet valid", craft(hs256, `{"sub":"user-1","nbf":`+itoa(now+600)+`,"exp":`+itoa(now+3600)+`}`, testSecret), testSecret, ErrExpiredToken},
+
+		// Malformed tokens
+		{"empty", "", testSecret, ErrMalformedToken},
+		{"two segments", "abc.def", testSecret, ErrMalformedToken},
+		{"four segments", valid + ".extra", testSecret, ErrMalformedToken},
+		{"header not base64", "***." + segments[1] + "." + segments[2], testSecret, ErrMalformedToken},
+		{"header not JSON", craft(`not json`, payload, testSecret), testSecret, ErrMalformedToken},
+		{"payload not JSON", craft(hs256, `not json`, testSecret), testSecret, ErrMalformedToken},
+		{"payload of the wrong type", craft(hs256, `{"sub":1,"exp":`+itoa(now+3600)+`}`, testSecret), testSecret, ErrMalformedToken},
+		{"no subject", craft(hs256, `{"exp":`+itoa(now+3600)+`}`, testSecret), testSecret, ErrMalformedToken},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseJWT(tt.token, tt.secret)
+			if !errors.Is(err, tt.want) {
+				t.Errorf("got %v, want %v", err, tt.want)
+			}
+			if !errors.Is(err, ErrInvalidCredentials) {
+				t.Errorf("%v does not wrap ErrInvalidCredentials", err)
+			}
+		})
+	}
+}
+
+func TestIsJWT(t *testing.T) {
+	tests := []struct {
+		credential string
+		want       bool
+	}{
+		{"aaa.bbb.ccc", true},
+		{apiKeyPrefix + "0123456789abcdef", false},
+		{"aaa.bbb", false},
+		{"aaa.bbb.ccc.ddd", false},
+	}
+	for _, tt := range tests {
+		if got := IsJWT(tt.credential); got != tt.want {
+			t.Errorf("IsJWT(%q) = %v, want %v", tt.credential, got, tt.want)
+		}
+	}
+}
+
+func itoa(n int64) string {
+	return strconv.FormatInt(n, 10)
+}
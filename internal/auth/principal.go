@@ -0,0 +1,44 @@
+// Identifies the administrators making requests.
+package auth
+
+import "context"
+
+// Ways a principal can authenticate.
+const (
+	MethodAPIKey = "api_key"
+	MethodJWT    = "jwt"
+)
+
+// RoleAdmin may manage API keys.
+const RoleAdmin = "admin"
+
+// Principal is the authenticated caller of a request.
+type Principal struct {
+	ID     string   `json:"id"`
+	Name   string   `json:"name"`
+	Method string   `json:"method"`
+	Roles  []string `json:"roles"`
+}
+
+// HasRole reports whether the principal holds the role.
+func (p Principal) HasRole(role string) bool {
+	for _, r := range p.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+type principalKey struct{}
+
+// WithPrincipal returns a copy of the context that carries the principal.
+func WithPrincipal(ctx context.Context, principal Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, principal)
+}
+
+// PrincipalFrom returns the principal carried by the context, if any.
+func PrincipalFrom(ctx context.Context) (Principal, bool) {
+	principal, ok := ctx.Value(principalKey{}).(Principal)
+	return principal, ok
+}
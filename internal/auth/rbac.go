@@ -0,0 +1,119 @@
+// Declares the roles of staff and the permissions each role grants.
+package auth
+
+import (
+	"context"
+	"sort"
+)
+
+// Permission allows an operation on a kind of resource.
+type Permission string
+
+const (
+	PermApplicantsRead     Permission = "applicants:read"
+	PermApplicantsWrite    Permission = "applicants:write"
+	PermApplicationsRead   Permission = "applications:read"
+	PermApplicationsWrite  Permission = "applications:write"
+	PermApplicationsReview Permission = "applications:review"
+	PermSchemesRead        Permission = "schemes:read"
+	PermSchemesWrite       Permission = "schemes:write"
+	PermDisbursementsRead  Permission = "disbursements:read"
+	PermDisbursementsWrite Permission = "disbursements:write"
+	PermReferenceDataRead  Permission = "reference_data:read"
+	PermReferenceDataWrite Permission = "reference_data:write"
+	PermAPIKeysManage      Permission = "api_keys:manage"
+	PermAuditRead          Permission = "audit:read"
+	PermRecordsPurge       Permission = "records:purge"
+)
+
+// Roles held by staff, besides RoleAdmin.
+const (
+	RoleCaseworker     = "caseworker"
+	RoleApprover       = "approver"
+	RolePolicyOfficer  = "policy_officer"
+	RoleAuditor        = "auditor"
+	RoleFinanceOfficer = "finance_officer"
+)
+
+// readOnly are the permissions that only read data.
+var readOnly = []Permission{
+	PermApplicantsRead, PermApplicationsRead, PermSchemesRead, PermReferenceDataRead, PermDisbursementsRead,
+}
+
+// rolePermissions grants each role its permissions.
+var rolePermissions = map[string][]Permission{
+	RoleAdmin: append(append([]Permission{}, readOnly...),
+		PermApplicantsWrite, PermApplicationsWrite, PermApplicationsReview,
+		PermSchemesWrite, PermReferenceDataWrite, PermDisbursementsWrite, PermAPIKeysManage, PermAuditRead, PermRecordsPurge),
+	// Caseworkers create applicants and applications
+	RoleCaseworker: {
+		PermApplicantsRead, PermApplicantsWrite, PermApplicationsRead, PermApplicationsWrite,
+		PermSchemesRead, PermReferenceDataRead,
+	},
+	// Approvers change the status of applications
+	RoleApprover: {
+		PermApplicantsRead, PermApplicationsRead, PermApplicationsReview, PermSchemesRead, PermReferenceDataRead,
+		PermDisbursementsRead,
+	},
+	// Policy officers manage schemes and the values they are built from
+	RolePolicyOfficer: {
+		PermSchemesRead, PermSchemesWrite, PermReferenceDataRead, PermReferenceDataWrite,
+	},
+	// Finance officers record the payments made to approved applicants
+	RoleFinanceOfficer: {
+		PermApplicantsRead, PermApplicationsRead, PermSchemesRead, PermDisbursementsRead, PermDisbursementsWrite,
+	},
+	// Auditors have read-only access, including to the audit log
+	RoleAuditor: append(append([]Permission{}, readOnly...), PermAuditRead),
+}
+
+// IsRole reports whether the role is known.
+func IsRole(role string) bool {
+	_, ok := rolePermissions[role]
+	return ok
+}
+
+// Roles returns every known role.
+func Roles() []string {
+	roles := make([]string, 0, len(rolePermissions))
+	for role := range rolePermissions {
+		roles = append(roles, role)
+	}
+	sort.Strings(roles)
+	return roles
+}
+
+// Permissions returns every permission granted by the principal's roles.
+func (p Principal) Permissions() []Permission {
+	granted := make(map[Permission]bool)
+	for _, role := range p.Roles {
+		for _, permission := range rolePermissions[role] {
+			granted[permission] = true
+		}
+	}
+
+	permissions := make([]Permission, 0, len(granted))
+	for permission := range granted {
+		permissions = append(permissions, permission)
+	}
+	sort.Slice(permissions, func(i, j int) bool { return permissions[i] < permissions[j] })
+	return permissions
+}
+
+// Can reports whether any of the principal's roles grants the permission.
+func (p Principal) Can(permission Permission) bool {
+	for _, role := range p.Roles {
+		for _, granted := range rolePermissions[role] {
+			if granted == permission {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Allowed reports whether the principal carried by the context holds the permission.
+func Allowed(ctx context.Context, permission Permission) bool {
+	principal, ok := PrincipalFrom(ctx)
+	return ok && principal.Can(permission)
+}
@@ -0,0 +1,282 @@
+// Loads the configuration of the server from flags, environment variables and an optional file.
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/joho/godotenv"
+)
+
+// Config holds every setting of the server.
+type Config struct {
+	// Server
+	ListenAddr      string
+	TLSCertFile     string
+	TLSKeyFile      string
+	ReadTimeout     time.Duration
+	WriteTimeout    time.Duration
+	IdleTimeout     time.Duration
+	ShutdownTimeout time.Duration
+	LogLevel        slog.Level
+
+	// Database
+	DSN               string
+	DBMaxOpenConns    int
+	DBMaxIdleConns    int
+	DBConnMaxLifetime time.Duration
+	DBConnMaxIdleTime time.Duration
+	QueryTimeout      time.Duration
+
+	// Authentication
+	JWTSecret   string
+	AdminAPIKey string
+
+	// Payments, made from the account of the debtor
+	DebtorName    string
+	DebtorAccount string
+	DebtorBIC     string
+}
+
+// Defaults returns the configuration used for any setting that is not given.
+func Defaults() Config {
+	return Config{
+		ListenAddr:        ":8080",
+		ReadTimeout:       15 * time.Second,
+		WriteTimeout:      30 * time.Second,
+		IdleTimeout:       60 * time.Second,
+		ShutdownTimeout:   30 * time.Second,
+		LogLevel:          slog.LevelInfo,
+		DBMaxOpenConns:    25,
+		DBMaxIdleConns:    25,
+		DBConnMaxLifetime: 5 * time.Minute,
+		DBConnMaxIdleTime: time.Minute,
+		QueryTimeout:      5 * time.Second,
+	}
+}
+
+// TLS reports whether the server should serve HTTPS.
+func (c Config) TLS() bool {
+	return c.TLSCertFile != ""
+}
+
+// setting is a single configuration value. It is named in flags as -name, in environment variables as env,
+// and in the configuration file as name with underscores in place of hyphens.
+type setting struct {
+	name  string
+	env   string
+	usage string
+	set   func(c *Config, value string) error
+}
+
+var settings = []setting{
+	{"addr", "LISTEN_ADDR", "address to listen on, such as :8080", setString(func(c *Config) *string { return &c.ListenAddr })},
+	{"tls-cert", "TLS_CERT_FILE", "TLS certificate file; serves HTTPS when set", setString(func(c *Config) *string { return &c.TLSCertFile })},
+	{"tls-key", "TLS_KEY_FILE", "TLS private key file", setString(func(c *Config) *string { return &c.TLSKeyFile })},
+	{"read-timeout", "READ_TIMEOUT", "maximum time to read a request", setDuration(func(c *Config) *time.Duration { return &c.ReadTimeout })},
+	{"write-timeout", "WRITE_TIMEOUT", "maximum time to write a response", setDuration(func(c *Config) *time.Duration { return &c.WriteTimeout })},
+	{"idle-timeout", "IDLE_TIMEOUT", "maximum time to keep an idle connection open", setDuration(func(c *Config) *time.Duration { return &c.IdleTimeout })},
+	{"shutdown-timeout", "SHUTDOWN_TIMEOUT", "maximum time for requests in flight to finish on shutdown", setDuration(func(c *Config) *time.Duration { return &c.ShutdownTimeout })},
+	{"log-level", "LOG_LEVEL", "debug, info, warn or error", func(c *Config, value string) error { return c.LogLevel.UnmarshalText([]byte(value)) }},
+	{"dsn", "DSN", "MySQL data source name", setString(func(c *Config) *string { return &c.DSN })},
+	{"db-max-open-conns", "DB_MAX_OPEN_CONNS", "maximum number of open database connections; 0 is unlimited", setInt(func(c *Config) *int { return &c.DBMaxOpenConns })},
+	{"db-max-idle-conns", "DB_MAX_IDLE_CONNS", "maximum number of idle database connections", setInt(func(c *Config) *int { return &c.DBMaxIdleConns })},
+	{"db-conn-max-lifetime", "DB_CONN_MAX_LIFETIME", "maximum time a database connection may be reused", setDuration(func(c *Config) *time.Duration { return &c.DBConnMaxLifetime })},
+	{"db-conn-max-idle-time", "DB_CONN_MAX_IDLE_TIME", "maximum time a database connection may be idle", setDuration(func(c *Config) *time.Duration { return &c.DBConnMaxIdleTime })},
+	{"query-timeout", "QUERY_TIMEOUT", "maximum time the database work of a request may take", setDuration(func(c *Config) *time.Duration { return &c.QueryTimeout })},
+	{"jwt-secret", "JWT_SECRET", "HMAC-SHA256 secret for verifying JWTs; prefer the environment over this flag", setString(func(c *Config) *string { return &c.JWTSecret })},
+	{"admin-api-key", "ADMIN_API_KEY", "API key stored as an admin key on start-up; prefer the environment over this flag", setString(func(c *Config) *string { return &c.AdminAPIKey })},
+	{"debtor-name", "DEBTOR_NAME", "name of the organisation paying the disbursements, as payment files give it", setString(func(c *Config) *string { return &c.DebtorName })},
+	{"debtor-account", "DEBTOR_ACCOUNT", "IBAN or account number the disbursements are paid from", setString(func(c *Config) *string { return &c.DebtorAccount })},
+	{"debtor-bic", "DEBTOR_BIC", "BIC of the bank the disbursements are paid from", setString(func(c *Config) *string { return &c.DebtorBIC })},
+}
+
+func setString(field func(*Config) *string) func(*Config, string) error {
+	return func(c *Config, value string) error {
+		*field(c) = value
+		return nil
+	}
+}
+
+func setInt(field func(*Config) *int) func(*Config, string) error {
+	return func(c *Config, value string) error {
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("%q is not a whole number", value)
+		}
+		*field(c) = n
+		return nil
+	}
+}
+
+func setDuration(field func(*Config) *time.Duration) func(*Config, string) error {
+	return func(c *Config, value string) error {
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("%q is not a duration such as 5s or 1m", value)
+		}
+		*field(c) = d
+		return nil
+	}
+}
+
+// Load reads the configuration from the command-line arguments, the environment, a .env file in the
+// working directory and the JSON file named by -config or CONFIG_FILE, in that order of precedence.
+// Settings that appear nowhere keep their defaults. Every invalid setting is reported.
+func Load(args []string) (Config, error) {
+	flags := flag.NewFlagSet("server", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	configFile := flags.String("config", "", "JSON configuration file (env CONFIG_FILE)")
+	values := make(map[string]*string, len(settings))
+	for _, s := range settings {
+		values[s.name] = flags.String(s.name, "", s.usage+" (env "+s.env+")")
+	}
+	if err := flags.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			flags.SetOutput(os.Stderr)
+			flags.PrintDefaults()
+		}
+		return Config{}, err
+	}
+
+	// A .env file is optional; variables already in the environment take precedence over it
+	if err := godotenv.Load(); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return Config{}, fmt.Errorf("reading .env: %w", err)
+	}
+
+	cfg := Defaults()
+	var problems []error
+
+	// Configuration file
+	if *configFile == "" {
+		*configFile = os.Getenv("CONFIG_FILE")
+	}
+	if *configFile != "" {
+		fileValues, err := readFile(*configFile)
+		if err != nil {
+			return Config{}, err
+		}
+		for _, s := range settings {
+			key := strings.ReplaceAll(s.name, "-", "_")
+			if value, ok := fileValues[key]; ok {
+				problems = appendProblem(problems, s.set(&cfg, value), key+" in "+*configFile)
+				delete(fileValues, key)
+			}
+		}
+		for key := range fileValues {
+			problems = append(problems, fmt.Errorf("%s in %s: unknown setting", key, *configFile))
+		}
+	}
+
+	// Environment
+	for _, s := range settings {
+		if value, ok := os.LookupEnv(s.env); ok && value != "" {
+			problems = appendProblem(problems, s.set(&cfg, value), s.env)
+		}
+	}
+
+	// Flags
+	flags.Visit(func(f *flag.Flag) {
+		for _, s := range settings {
+			if s.name == f.Name {
+				problems = appendProblem(problems, s.set(&cfg, *values[s.name]), "-"+s.name)
+			}
+		}
+	})
+
+	problems = append(problems, cfg.validate()...)
+	if len(problems) > 0 {
+		return Config{}, fmt.Errorf("invalid configuration: %w", errors.Join(problems...))
+	}
+	return cfg, nil
+}
+
+// readFile reads a JSON object of settings, whose values may be strings, numbers or booleans.
+func readFile(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading configuration file: %w", err)
+	}
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("parsing configuration file %s: %w", path, err)
+	}
+
+	values := make(map[string]string, len(raw))
+	for key, value := range raw {
+		var s string
+		if err := json.Unmarshal(value, &s); err != nil {
+			s = string(value)
+		}
+		values[key] = s
+	}
+	return values, nil
+}
+
+func appendProblem(problems []error, err error, source string) []error {
+	if err != nil {
+		problems = append(problems, fmt.Errorf("%s: %w", source, err))
+	}
+	return problems
+}
+
+// validate reports every setting that is missing or out of range.
+func (c Config) validate() []error {
+	var problems []error
+	add := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Errorf(format, args...))
+	}
+
+	if _, _, err := net.SplitHostPort(c.ListenAddr); err != nil {
+		add("listen address %q must be host:port or :port", c.ListenAddr)
+	}
+	if (c.TLSCertFile == "") != (c.TLSKeyFile == "") {
+		add("TLS certificate and key files must be given together")
+	}
+	for _, file := range []string{c.TLSCertFile, c.TLSKeyFile} {
+		if file == "" {
+			continue
+		}
+		if _, err := os.Stat(file); err != nil {
+			add("TLS file: %v", err)
+		}
+	}
+	for _, timeout := range []struct {
+		name string
+		d    time.Duration
+	}{
+		{"read timeout", c.ReadTimeout}, {"write timeout", c.WriteTimeout}, {"idle timeout", c.IdleTimeout},
+		{"shutdown timeout", c.ShutdownTimeout}, {"query timeout", c.QueryTimeout},
+	} {
+		if timeout.d <= 0 {
+			add("%s must be positive", timeout.name)
+		}
+	}
+
+	if c.DSN == "" {
+		add("DSN is required")
+	}
+	if c.DBMaxOpenConns < 0 || c.DBMaxIdleConns < 0 {
+		add("database connection limits must not be negative")
+	}
+	if c.DBMaxOpenConns > 0 && c.DBMaxIdleConns > c.DBMaxOpenConns {
+		add("maximum idle database connections (%d) must not exceed the maximum open connections (%d)", c.DBMaxIdleConns, c.DBMaxOpenConns)
+	}
+	if c.DBConnMaxLifetime < 0 || c.DBConnMaxIdleTime < 0 {
+		add("database connection lifetimes must not be negative")
+	}
+	if (c.DebtorName == "") != (c.DebtorAccount == "") {
+		add("debtor name and account must be given together")
+	}
+	return problems
+}
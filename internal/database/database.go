@@ -2,47 +2,83 @@
 package database
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"log"
-	"os"
+	"log/slog"
+	"sort"
+	"strings"
+	"time"
 	
 	_ "github.com/go-sql-driver/mysql"
-	"github.com/joho/godotenv"
-)
+	"github.com/google/uuid"
 
-// SetupDB connects to the MySQL database, create the relevant tables and returns the database.
-func SetupDB() (*sql.DB, error) {
-	err := godotenv.Load()
-	if err != nil {
-		log.Fatalf("Error loading .env file: %v", err)
-	}
+	"fas/internal/config"
+	"fas/internal/refdata"
+)
 
-	// Get the DSN from the environment variable
-	dsn := os.Getenv("DSN")
-	if dsn == "" {
-		log.Fatal("DSN not set in environment.")
-	}
+// Connection attempts at start-up back off exponentially from connectBackoff up to maxConnectBackoff.
+const (
+	connectAttempts   = 10
+	connectBackoff    = 500 * time.Millisecond
+	maxConnectBackoff = 30 * time.Second
+)
 
+// SetupDB connects to the MySQL database, create the relevant tables and returns the database.
+// The database is retried with backoff until it is reachable or the context is cancelled.
+func SetupDB(ctx context.Context, cfg config.Config) (*sql.DB, error) {
 	// Open a connection to the MySQL database.
-	db, err := sql.Open("mysql", dsn)
+	db, err := sql.Open("mysql", cfg.DSN)
 	if err != nil {
 		return nil, err
 	}
-
-	fmt.Println("Connected to MySQL.")
+	db.SetMaxOpenConns(cfg.DBMaxOpenConns)
+	db.SetMaxIdleConns(cfg.DBMaxIdleConns)
+	db.SetConnMaxLifetime(cfg.DBConnMaxLifetime)
+	db.SetConnMaxIdleTime(cfg.DBConnMaxIdleTime)
 
 	// Verify the connection to the database.
-	if err = db.Ping(); err != nil {
+	if err = connect(ctx, db); err != nil {
+		db.Close()
 		return nil, err
 	}
+	slog.Info("connected to MySQL")
 
 	createTables(db)
+	migrateTables(db)
+	seedReferenceData(db)
+
+	if err := refdata.Load(ctx, db); err != nil {
+		return nil, err
+	}
 
-	fmt.Println("Database setup complete.")
+	slog.Info("database setup complete")
 	return db, nil
 }
 
+// connect pings the database until it answers, waiting longer after each failed attempt.
+func connect(ctx context.Context, db *sql.DB) error {
+	backoff := connectBackoff
+	for attempt := 1; ; attempt++ {
+		err := db.PingContext(ctx)
+		if err == nil {
+			return nil
+		}
+		if attempt == connectAttempts {
+			return fmt.Errorf("database unreachable after %d attempts: %w", attempt, err)
+		}
+
+		slog.Warn("database unreachable, retrying", "attempt", attempt, "retry_in", backoff.String(), "error", err)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, maxConnectBackoff)
+	}
+}
+
 // createTables executes the SQL commands to create the necessary tables.
 func createTables(db *sql.DB) {
 	queries := []string{
@@ -54,6 +90,11 @@ func createTables(db *sql.DB) {
 			marital_status VARCHAR(50),
 			sex VARCHAR(10),
 			date_of_birth DATE,
+			bank_account_holder VARCHAR(140) NULL,
+			bank_account_number VARCHAR(34) NULL,
+			bank_bic VARCHAR(11) NULL,
+			version INT NOT NULL DEFAULT 1,
+			deleted_at DATETIME NULL,
 			CONSTRAINT unique_name_dob_applicant UNIQUE (name, date_of_birth)
 		);`,
 
@@ -74,7 +115,9 @@ func createTables(db *sql.DB) {
 		// Schemes table
 		`CREATE TABLE IF NOT EXISTS schemes (
 			id VARCHAR(36) PRIMARY KEY,
-			name VARCHAR(100) UNIQUE
+			name VARCHAR(100) UNIQUE,
+			version INT NOT NULL DEFAULT 1,
+			deleted_at DATETIME NULL
 		);`,
 
 		// Criteria table
@@ -101,7 +144,14 @@ func createTables(db *sql.DB) {
 			id VARCHAR(36) PRIMARY KEY,
 			name VARCHAR(100),
 			amount DECIMAL(10, 2),
-			CONSTRAINT unique_benefits UNIQUE (name, amount)
+			amount_formula VARCHAR(255) NOT NULL DEFAULT '',
+			currency CHAR(3) NOT NULL DEFAULT 'SGD',
+			benefit_type VARCHAR(50) NOT NULL DEFAULT 'cash',
+			frequency VARCHAR(50) NOT NULL DEFAULT 'one_off',
+			duration INT NOT NULL DEFAULT 1,
+			catalogue BOOLEAN NOT NULL DEFAULT FALSE,
+			version INT NOT NULL DEFAULT 1,
+			CONSTRAINT unique_benefits UNIQUE (name, amount, amount_formula, currency, benefit_type, frequency, duration)
 		);`,
 
 		// Scheme_Benefits table
@@ -120,10 +170,118 @@ func createTables(db *sql.DB) {
 			scheme_id VARCHAR(36),
 			status VARCHAR(50),
 			applied_date DATE,
+			version INT NOT NULL DEFAULT 1,
+			deleted_at DATETIME NULL,
 			FOREIGN KEY (applicant_id) REFERENCES applicants(id) ON DELETE CASCADE,
 			FOREIGN KEY (scheme_id) REFERENCES schemes(id) ON DELETE CASCADE,
 			CONSTRAINT unique_applicant_scheme_application UNIQUE (applicant_id, scheme_id)
 		);`,
+
+		// Application_Entitlements table, what each benefit pays an approved application
+		`CREATE TABLE IF NOT EXISTS application_entitlements (
+			application_id VARCHAR(36),
+			benefit_id VARCHAR(36),
+			name VARCHAR(100),
+			benefit_type VARCHAR(50),
+			amount DECIMAL(10, 2),
+			amount_formula VARCHAR(255) NOT NULL DEFAULT '',
+			currency CHAR(3),
+			frequency VARCHAR(50),
+			payments INT,
+			total DECIMAL(15, 2),
+			PRIMARY KEY (application_id, benefit_id),
+			FOREIGN KEY (application_id) REFERENCES applications(id) ON DELETE RESTRICT
+		);`,
+
+		// Disbursements table, the ledger of payments scheduled for approved applications
+		`CREATE TABLE IF NOT EXISTS disbursements (
+			id VARCHAR(36) PRIMARY KEY,
+			application_id VARCHAR(36) NOT NULL,
+			applicant_id VARCHAR(36) NOT NULL,
+			scheme_id VARCHAR(36) NOT NULL,
+			benefit_id VARCHAR(36) NOT NULL,
+			name VARCHAR(100),
+			installment INT NOT NULL,
+			amount DECIMAL(10, 2) NOT NULL,
+			currency CHAR(3) NOT NULL,
+			due_date DATE NOT NULL,
+			status VARCHAR(20) NOT NULL DEFAULT 'scheduled',
+			reference VARCHAR(100) NULL,
+			paid_at DATETIME NULL,
+			batch_id VARCHAR(36) NULL,
+			version INT NOT NULL DEFAULT 1,
+			created_at DATETIME NOT NULL,
+			INDEX idx_disbursements_applicant (applicant_id, due_date),
+			INDEX idx_disbursements_scheme (scheme_id, status),
+			FOREIGN KEY (application_id) REFERENCES applications(id) ON DELETE RESTRICT
+		);`,
+
+		// Payment_Batches table, the bank files the due disbursements were submitted in
+		`CREATE TABLE IF NOT EXISTS payment_batches (
+			id VARCHAR(36) PRIMARY KEY,
+			format VARCHAR(20) NOT NULL,
+			currency CHAR(3) NOT NULL,
+			execution_date DATE NOT NULL,
+			file_name VARCHAR(100) NOT NULL,
+			content MEDIUMBLOB NOT NULL,
+			checksum CHAR(64) NOT NULL,
+			payments INT NOT NULL,
+			total DECIMAL(15, 2) NOT NULL,
+			created_at DATETIME NOT NULL
+		);`,
+
+		// Reference_Data table
+		`CREATE TABLE IF NOT EXISTS reference_data (
+			id VARCHAR(36) PRIMARY KEY,
+			category VARCHAR(50) NOT NULL,
+			value VARCHAR(50) NOT NULL,
+			label VARCHAR(100),
+			sort_order INT NOT NULL DEFAULT 0,
+			active BOOLEAN NOT NULL DEFAULT TRUE,
+			CONSTRAINT unique_reference_data UNIQUE (category, value)
+		);`,
+
+		// API_Keys table
+		`CREATE TABLE IF NOT EXISTS api_keys (
+			id VARCHAR(36) PRIMARY KEY,
+			name VARCHAR(100) NOT NULL,
+			key_prefix VARCHAR(12) NOT NULL,
+			key_hash CHAR(64) NOT NULL UNIQUE,
+			role VARCHAR(50) NOT NULL,
+			created_by VARCHAR(100),
+			created_at DATETIME NOT NULL,
+			last_used_at DATETIME,
+			revoked_at DATETIME
+		);`,
+
+		// Audit_Log table
+		`CREATE TABLE IF NOT EXISTS audit_log (
+			id VARCHAR(36) PRIMARY KEY,
+			actor VARCHAR(100) NOT NULL,
+			actor_name VARCHAR(100),
+			action VARCHAR(50) NOT NULL,
+			entity_type VARCHAR(50) NOT NULL,
+			entity_id VARCHAR(36) NOT NULL,
+			request_id VARCHAR(128),
+			before_json JSON,
+			after_json JSON,
+			created_at DATETIME(6) NOT NULL,
+			INDEX idx_audit_entity (entity_type, entity_id),
+			INDEX idx_audit_actor (actor),
+			INDEX idx_audit_created_at (created_at)
+		);`,
+
+		// Idempotency_Keys table
+		`CREATE TABLE IF NOT EXISTS idempotency_keys (
+			principal VARCHAR(255) NOT NULL,
+			idempotency_key VARCHAR(255) NOT NULL,
+			request_hash CHAR(64) NOT NULL,
+			status_code INT,
+			response_headers TEXT,
+			response_body MEDIUMBLOB,
+			created_at DATETIME NOT NULL,
+			PRIMARY KEY (principal, idempotency_key)
+		);`,
 	}
 
 	// Execute each query to create the tables.
@@ -132,4 +290,196 @@ func createTables(db *sql.DB) {
 			log.Fatalf("error creating table: %v", err)
 		}
 	}
-}
\ No newline at end of file
+}
+
+// migrateTables adds the columns introduced after the tables were first created.
+func migrateTables(db *sql.DB) {
+	columns := []struct {
+		table      string
+		column     string
+		definition string
+	}{
+		// Versions used for optimistic concurrency control
+		{"applicants", "version", "INT NOT NULL DEFAULT 1"},
+		{"schemes", "version", "INT NOT NULL DEFAULT 1"},
+		{"applications", "version", "INT NOT NULL DEFAULT 1"},
+		// Deletion times of soft-deleted rows
+		{"applicants", "deleted_at", "DATETIME NULL"},
+		{"schemes", "deleted_at", "DATETIME NULL"},
+		{"applications", "deleted_at", "DATETIME NULL"},
+		// Benefits managed through the catalogue, which are kept when no scheme uses them
+		{"benefits", "catalogue", "BOOLEAN NOT NULL DEFAULT FALSE"},
+		{"benefits", "version", "INT NOT NULL DEFAULT 1"},
+		// Currencies of benefit amounts, as ISO 4217 codes
+		{"benefits", "currency", "CHAR(3) NOT NULL DEFAULT 'SGD'"},
+		// How benefits are paid; existing benefits are one-off cash payments
+		{"benefits", "benefit_type", "VARCHAR(50) NOT NULL DEFAULT 'cash'"},
+		{"benefits", "frequency", "VARCHAR(50) NOT NULL DEFAULT 'one_off'"},
+		{"benefits", "duration", "INT NOT NULL DEFAULT 1"},
+		// Formulas computing the amounts of benefits that depend on the household
+		{"benefits", "amount_formula", "VARCHAR(255) NOT NULL DEFAULT ''"},
+		// Bank accounts applicants are paid into, and the batches their payments were submitted in
+		{"applicants", "bank_account_holder", "VARCHAR(140) NULL"},
+		{"applicants", "bank_account_number", "VARCHAR(34) NULL"},
+		{"applicants", "bank_bic", "VARCHAR(11) NULL"},
+		{"disbursements", "batch_id", "VARCHAR(36) NULL"},
+		// Principals that idempotency keys belong to
+		{"idempotency_keys", "principal", "VARCHAR(255) NOT NULL DEFAULT ''"},
+	}
+
+	for _, c := range columns {
+		if err := addColumnIfMissing(db, c.table, c.column, c.definition); err != nil {
+			log.Fatalf("error migrating table %s: %v", c.table, err)
+		}
+	}
+
+	keys := []struct {
+		table   string
+		name    string
+		columns []string
+	}{
+		// The same benefit may be paid in different currencies, and in different ways
+		{"benefits", "unique_benefits", []string{"name", "amount", "amount_formula", "currency", "benefit_type", "frequency", "duration"}},
+	}
+
+	for _, k := range keys {
+		if err := replaceUniqueKey(db, k.table, k.name, k.columns); err != nil {
+			log.Fatalf("error migrating table %s: %v", k.table, err)
+		}
+	}
+
+	// Each principal has its own idempotency keys
+	if err := replacePrimaryKey(db, "idempotency_keys", []string{"principal", "idempotency_key"}); err != nil {
+		log.Fatalf("error migrating table idempotency_keys: %v", err)
+	}
+
+	foreignKeys := []struct {
+		table      string
+		column     string
+		references string
+		onDelete   string
+	}{
+		// The payment ledger is kept when the application it was scheduled for is removed
+		{"application_entitlements", "application_id", "applications(id)", "RESTRICT"},
+		{"disbursements", "application_id", "applications(id)", "RESTRICT"},
+	}
+
+	for _, k := range foreignKeys {
+		if err := replaceForeignKey(db, k.table, k.column, k.references, k.onDelete); err != nil {
+			log.Fatalf("error migrating table %s: %v", k.table, err)
+		}
+	}
+}
+
+// addColumnIfMissing adds a column to a table unless the table already has it.
+func addColumnIfMissing(db *sql.DB, table, column, definition string) error {
+	var exists bool
+	err := db.QueryRow(`SELECT EXISTS(
+			SELECT 1 FROM information_schema.COLUMNS
+			WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ? AND COLUMN_NAME = ?
+		)`, table, column).Scan(&exists)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return nil
+	}
+
+	_, err = db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition))
+	return err
+}
+
+// replaceUniqueKey recreates a unique key over the given columns, unless it already covers exactly those columns.
+func replaceUniqueKey(db *sql.DB, table, name string, columns []string) error {
+	var current sql.NullString
+	err := db.QueryRow(`SELECT GROUP_CONCAT(COLUMN_NAME ORDER BY SEQ_IN_INDEX) FROM information_schema.STATISTICS
+			WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ? AND INDEX_NAME = ?`, table, name).Scan(&current)
+	if err != nil {
+		return err
+	}
+	wanted := strings.Join(columns, ",")
+	if current.String == wanted {
+		return nil
+	}
+
+	query := fmt.Sprintf("ALTER TABLE %s ADD CONSTRAINT %s UNIQUE (%s)", table, name, wanted)
+	if current.Valid {
+		query = fmt.Sprintf("ALTER TABLE %s DROP INDEX %s, ADD CONSTRAINT %s UNIQUE (%s)", table, name, name, wanted)
+	}
+	_, err = db.Exec(query)
+	return err
+}
+
+// replacePrimaryKey recreates the primary key of a table over the given columns, unless it already covers exactly those columns.
+func replacePrimaryKey(db *sql.DB, table string, columns []string) error {
+	var current sql.NullString
+	err := db.QueryRow(`SELECT GROUP_CONCAT(COLUMN_NAME ORDER BY SEQ_IN_INDEX) FROM information_schema.STATISTICS
+			WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ? AND INDEX_NAME = 'PRIMARY'`, table).Scan(&current)
+	if err != nil {
+		return err
+	}
+	wanted := strings.Join(columns, ",")
+	if current.String == wanted {
+		return nil
+	}
+
+	query := fmt.Sprintf("ALTER TABLE %s ADD PRIMARY KEY (%s)", table, wanted)
+	if current.Valid {
+		query = fmt.Sprintf("ALTER TABLE %s DROP PRIMARY KEY, ADD PRIMARY KEY (%s)", table, wanted)
+	}
+	_, err = db.Exec(query)
+	return err
+}
+
+// replaceForeignKey recreates the foreign key of a column with the given delete rule, unless it already has that rule.
+func replaceForeignKey(db *sql.DB, table, column, references, onDelete string) error {
+	var name, rule string
+	err := db.QueryRow(`SELECT rc.CONSTRAINT_NAME, rc.DELETE_RULE FROM information_schema.REFERENTIAL_CONSTRAINTS rc
+			JOIN information_schema.KEY_COLUMN_USAGE k ON k.CONSTRAINT_SCHEMA = rc.CONSTRAINT_SCHEMA
+				AND k.TABLE_NAME = rc.TABLE_NAME AND k.CONSTRAINT_NAME = rc.CONSTRAINT_NAME
+			WHERE rc.CONSTRAINT_SCHEMA = DATABASE() AND rc.TABLE_NAME = ? AND k.COLUMN_NAME = ?`, table, column).Scan(&name, &rule)
+	if err != nil && err != sql.ErrNoRows {
+		return err
+	}
+	if rule == onDelete {
+		return nil
+	}
+
+	// MySQL cannot drop and add a constraint of the same name in one statement
+	if name != "" {
+		if _, err := db.Exec(fmt.Sprintf("ALTER TABLE %s DROP FOREIGN KEY %s", table, name)); err != nil {
+			return err
+		}
+	}
+	_, err = db.Exec(fmt.Sprintf("ALTER TABLE %s ADD FOREIGN KEY (%s) REFERENCES %s ON DELETE %s", table, column, references, onDelete))
+	return err
+}
+
+// seedReferenceData fills each empty reference data category with its default values.
+func seedReferenceData(db *sql.DB) {
+	categories := make([]string, 0, len(refdata.Defaults))
+	for category := range refdata.Defaults {
+		categories = append(categories, category)
+	}
+	sort.Strings(categories)
+
+	for _, category := range categories {
+		var exists bool
+		err := db.QueryRow("SELECT EXISTS(SELECT 1 FROM reference_data WHERE category = ?)", category).Scan(&exists)
+		if err != nil {
+			log.Fatalf("error checking reference data: %v", err)
+		}
+		if exists {
+			continue
+		}
+
+		for i, value := range refdata.Defaults[category] {
+			_, err := db.Exec(`INSERT INTO reference_data (id, category, value, label, sort_order, active) 
+				VALUES (?, ?, ?, ?, ?, TRUE)`,
+				uuid.New().String(), category, value, value, i)
+			if err != nil {
+				log.Fatalf("error seeding reference data: %v", err)
+			}
+		}
+	}
+}
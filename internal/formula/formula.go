@@ -0,0 +1,406 @@
+// Evaluates arithmetic formulas exactly, with rational numbers, against named variables and functions.
+//
+// A formula is made of decimal numbers, variables, the operators + - * / and parentheses, and function calls
+// such as max(0, 500 - 50 * children_count). min and max are always available.
+package formula
+
+import (
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// MaxLength matches the VARCHAR(255) amount_formula column.
+const MaxLength = 255
+
+// Error describes what is wrong with a formula, and where.
+type Error struct {
+	Pos int // byte offset in the formula
+	Msg string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s at position %d", e.Msg, e.Pos+1)
+}
+
+// Func computes the value of a function call from the values of its arguments.
+type Func func(args []*big.Rat) (*big.Rat, error)
+
+// Function is a function a formula may call, together with the number of arguments it takes.
+// Calls with too few or too many arguments are refused by Check, before the function is ever called.
+type Function struct {
+	MinArgs int
+	MaxArgs int // -1 for no limit
+	Call    Func
+}
+
+// Env supplies the variables and functions a formula may refer to.
+type Env struct {
+	Vars  map[string]*big.Rat
+	Funcs map[string]Function
+}
+
+// builtins are the functions every formula may call.
+var builtins = map[string]Function{
+	"min": {MinArgs: 1, MaxArgs: -1, Call: func(args []*big.Rat) (*big.Rat, error) { return extreme(args, -1) }},
+	"max": {MinArgs: 1, MaxArgs: -1, Call: func(args []*big.Rat) (*big.Rat, error) { return extreme(args, 1) }},
+}
+
+// extreme returns the smallest of one or more arguments when sign is -1, and the largest when it is 1.
+func extreme(args []*big.Rat, sign int) (*big.Rat, error) {
+	result := args[0]
+	for _, arg := range args[1:] {
+		if arg.Cmp(result) == sign {
+			result = arg
+		}
+	}
+	return result, nil
+}
+
+// Formula is a parsed formula, ready to be evaluated.
+type Formula struct {
+	src  string
+	root node
+}
+
+// Parse reads a formula, reporting the first syntax error.
+func Parse(src string) (*Formula, error) {
+	if strings.TrimSpace(src) == "" {
+		return nil, &Error{Pos: 0, Msg: "formula is empty"}
+	}
+	p := &parser{src: src}
+	p.next()
+	root, err := p.expr()
+	if err != nil {
+		return nil, err
+	}
+	if p.tok.kind != tokEOF {
+		return nil, &Error{Pos: p.tok.pos, Msg: "unexpected " + p.tok.describe()}
+	}
+	return &Formula{src: src, root: root}, nil
+}
+
+func (f *Formula) String() string {
+	return f.src
+}
+
+// Check reports the first variable or function the formula refers to that the environment does not supply,
+// or the first function call with the wrong number of arguments.
+func (f *Formula) Check(env Env) error {
+	return f.root.check(env)
+}
+
+// Eval computes the value of the formula.
+func (f *Formula) Eval(env Env) (*big.Rat, error) {
+	return f.root.eval(env)
+}
+
+// node is an element of a parsed formula.
+type node interface {
+	eval(env Env) (*big.Rat, error)
+	check(env Env) error
+}
+
+type number struct{ value *big.Rat }
+
+func (n number) eval(Env) (*big.Rat, error) { return n.value, nil }
+func (n number) check(Env) error            { return nil }
+
+type variable struct {
+	pos  int
+	name string
+}
+
+func (v variable) eval(env Env) (*big.Rat, error) {
+	value, ok := env.Vars[v.name]
+	if !ok {
+		return nil, &Error{Pos: v.pos, Msg: fmt.Sprintf("unknown variable %q", v.name)}
+	}
+	return value, nil
+}
+
+func (v variable) check(env Env) error {
+	_, err := v.eval(env)
+	return err
+}
+
+type call struct {
+	pos  int
+	name string
+	args []node
+}
+
+// function looks up the function called, checking that it is given the number of arguments it takes.
+func (c call) function(env Env) (Function, error) {
+	fn, ok := env.Funcs[c.name]
+	if !ok {
+		fn, ok = builtins[c.name]
+	}
+	if !ok {
+		return Function{}, &Error{Pos: c.pos, Msg: fmt.Sprintf("unknown function %q", c.name)}
+	}
+
+	switch n := len(c.args); {
+	case fn.MinArgs == fn.MaxArgs && n != fn.MinArgs:
+		return Function{}, &Error{Pos: c.pos, Msg: fmt.Sprintf("%s takes %s but was given %d", c.name, arguments(fn.MinArgs), n)}
+	case n < fn.MinArgs:
+		return Function{}, &Error{Pos: c.pos, Msg: fmt.Sprintf("%s takes at least %s but was given %d", c.name, arguments(fn.MinArgs), n)}
+	case fn.MaxArgs >= 0 && n > fn.MaxArgs:
+		return Function{}, &Error{Pos: c.pos, Msg: fmt.Sprintf("%s takes at most %s but was given %d", c.name, arguments(fn.MaxArgs), n)}
+	}
+	return fn, nil
+}
+
+// arguments counts arguments in an error message.
+func arguments(n int) string {
+	if n == 1 {
+		return "1 argument"
+	}
+	return fmt.Sprintf("%d arguments", n)
+}
+
+func (c call) eval(env Env) (*big.Rat, error) {
+	fn, err := c.function(env)
+	if err != nil {
+		return nil, err
+	}
+	args := make([]*big.Rat, len(c.args))
+	for i, arg := range c.args {
+		if args[i], err = arg.eval(env); err != nil {
+			return nil, err
+		}
+	}
+	result, err := fn.Call(args)
+	if err != nil {
+		return nil, &Error{Pos: c.pos, Msg: fmt.Sprintf("%s: %v", c.name, err)}
+	}
+	return result, nil
+}
+
+func (c call) check(env Env) error {
+	if _, err := c.function(env); err != nil {
+		return err
+	}
+	for _, arg := range c.args {
+		if err := arg.check(env); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type negation struct{ operand node }
+
+func (n negation) eval(env Env) (*big.Rat, error) {
+	value, err := n.operand.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Rat).Neg(value), nil
+}
+
+func (n negation) check(env Env) error { return n.operand.check(env) }
+
+type binary struct {
+	pos         int
+	op          byte
+	left, right node
+}
+
+func (b binary) eval(env Env) (*big.Rat, error) {
+	left, err := b.left.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	right, err := b.right.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	switch b.op {
+	case '+':
+		return new(big.Rat).Add(left, right), nil
+	case '-':
+		return new(big.Rat).Sub(left, right), nil
+	case '*':
+		return new(big.Rat).Mul(left, right), nil
+	default:
+		if right.Sign() == 0 {
+			return nil, &Error{Pos: b.pos, Msg: "division by zero"}
+		}
+		return new(big.Rat).Quo(left, right), nil
+	}
+}
+
+func (b binary) check(env Env) error {
+	if err := b.left.check(env); err != nil {
+		return err
+	}
+	return b.right.check(env)
+}
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokNumber
+	tokIdent
+	tokOperator
+)
+
+type token struct {
+	kind tokenKind
+	pos  int
+	text string
+}
+
+// describe names the token in an error message.
+func (t token) describe() string {
+	if t.kind == tokEOF {
+		return "end of formula"
+	}
+	return strconv.Quote(t.text)
+}
+
+// parser reads a formula by recursive descent:
+//
+//	expr    = term { ("+" | "-") term }
+//	term    = unary { ("*" | "/") unary }
+//	unary   = "-" unary | primary
+//	primary = number | name [ "(" [ expr { "," expr } ] ")" ] | "(" expr ")"
+type parser struct {
+	src string
+	pos int
+	tok token
+}
+
+// next reads the following token.
+func (p *parser) next() {
+	for p.pos < len(p.src) && unicode.IsSpace(rune(p.src[p.pos])) {
+		p.pos++
+	}
+	start := p.pos
+	if p.pos >= len(p.src) {
+		p.tok = token{kind: tokEOF, pos: start}
+		return
+	}
+
+	c := p.src[p.pos]
+	switch {
+	case c >= '0' && c <= '9' || c == '.':
+		for p.pos < len(p.src) && (p.src[p.pos] >= '0' && p.src[p.pos] <= '9' || p.src[p.pos] == '.') {
+			p.pos++
+		}
+		p.tok = token{kind: tokNumber, pos: start, text: p.src[start:p.pos]}
+	case c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z':
+		for p.pos < len(p.src) && (p.src[p.pos] == '_' || p.src[p.pos] >= 'a' && p.src[p.pos] <= 'z' ||
+			p.src[p.pos] >= 'A' && p.src[p.pos] <= 'Z' || p.src[p.pos] >= '0' && p.src[p.pos] <= '9') {
+			p.pos++
+		}
+		p.tok = token{kind: tokIdent, pos: start, text: p.src[start:p.pos]}
+	default:
+		p.pos++
+		p.tok = token{kind: tokOperator, pos: start, text: string(c)}
+	}
+}
+
+// is reports whether the current token is the given operator.
+func (p *parser) is(op string) bool {
+	return p.tok.kind == tokOperator && p.tok.text == op
+}
+
+func (p *parser) expr() (node, error) {
+	left, err := p.term()
+	if err != nil {
+		return nil, err
+	}
+	for p.is("+") || p.is("-") {
+		op := p.tok
+		p.next()
+		right, err := p.term()
+		if err != nil {
+			return nil, err
+		}
+		left = binary{pos: op.pos, op: op.text[0], left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) term() (node, error) {
+	left, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	for p.is("*") || p.is("/") {
+		op := p.tok
+		p.next()
+		right, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		left = binary{pos: op.pos, op: op.text[0], left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) unary() (node, error) {
+	if p.is("-") {
+		p.next()
+		operand, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return negation{operand: operand}, nil
+	}
+	return p.primary()
+}
+
+func (p *parser) primary() (node, error) {
+	tok := p.tok
+	switch {
+	case tok.kind == tokNumber:
+		value, ok := new(big.Rat).SetString(tok.text)
+		if !ok || strings.Count(tok.text, ".") > 1 {
+			return nil, &Error{Pos: tok.pos, Msg: fmt.Sprintf("invalid number %q", tok.text)}
+		}
+		p.next()
+		return number{value: value}, nil
+
+	case tok.kind == tokIdent:
+		p.next()
+		if !p.is("(") {
+			return variable{pos: tok.pos, name: tok.text}, nil
+		}
+		p.next()
+		c := call{pos: tok.pos, name: tok.text}
+		for !p.is(")") {
+			if len(c.args) > 0 {
+				if !p.is(",") {
+					return nil, &Error{Pos: p.tok.pos, Msg: `expected "," or ")" but found ` + p.tok.describe()}
+				}
+				p.next()
+			}
+			arg, err := p.expr()
+			if err != nil {
+				return nil, err
+			}
+			c.args = append(c.args, arg)
+		}
+		p.next()
+		return c, nil
+
+	case p.is("("):
+		p.next()
+		inner, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		if !p.is(")") {
+			return nil, &Error{Pos: p.tok.pos, Msg: `expected ")" but found ` + p.tok.describe()}
+		}
+		p.next()
+		return inner, nil
+	}
+	return nil, &Error{Pos: tok.pos, Msg: "unexpected " + tok.describe()}
+}
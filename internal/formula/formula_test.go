@@ -0,0 +1,265 @@
+package formula
+
+import (
+	"math/big"
+	"testing"
+	"time"
+
+	"fas/internal/models"
+)
+
+// testEnv supplies two variables and a function of two arguments.
+var testEnv = Env{
+	Vars: map[string]*big.Rat{
+		"x": big.NewRat(4, 1),
+		"y": big.NewRat(1, 2),
+	},
+	Funcs: map[string]Function{
+		"sum2": {MinArgs: 2, MaxArgs: 2, Call: func(args []*big.Rat) (*big.Rat, error) {
+			return new(big.Rat).Add(args[0], args[1]), nil
+		}},
+	},
+}
+
+func TestEval(t *testing.T) {
+	tests := []struct {
+		src  string
+		want string // as a fraction, such as "7/1"
+	}{
+		// Precedence and associativity
+		{"1 + 2 * 3", "7/1"},
+		{"(1 + 2) * 3", "9/1"},
+		{"2 * 3 + 4 * 5", "26/1"},
+		{"10 - 4 - 3", "3/1"},
+		{"12 / 4 / 3", "1/1"},
+		{"12 / (4 / 2)", "6/1"},
+		{"1 + 6 / 2 - 3", "1/1"},
+		// Unary minus
+		{"-2 * 3", "-6/1"},
+		{"- -2", "2/1"},
+		{"2 - -3", "5/1"},
+		{"-(1 + 2)", "-3/1"},
+		{"2 * -x", "-8/1"},
+		// Exact arithmetic
+		{"1 / 3 * 3", "1/1"},
+		{"0.1 + 0.2", "3/10"},
+		{"x * y", "2/1"},
+		{"100 + 50 * x", "300/1"},
+		// Functions
+		{"min(3, 1, 2)", "1/1"},
+		{"max(3, 1, 2)", "3/1"},
+		{"max(5)", "5/1"},
+		{"max(0, 600 - 100 * 7)", "0/1"},
+		{"min(max(x, 10), 8)", "8/1"},
+		{"sum2(x, y) * 2", "9/1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.src, func(t *testing.T) {
+			f, err := Parse(tt.src)
+			if err != nil {
+				t.Fatalf("Parse: %v", err)
+			}
+			if err := f.Check(testEnv); err != nil {
+				t.Fatalf("Check: %v", err)
+			}
+			got, err := f.Eval(testEnv)
+			if err != nil {
+				t.Fatalf("Eval: %v", err)
+			}
+			if got.String() != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		src  string
+		want string
+	}{
+		{"", "formula is empty at position 1"},
+		{"   ", "formula is empty at position 1"},
+		{"1 +", "unexpected end of formula at position 4"},
+		{"(1 + 2", `expected ")" but found end of formula at position 7`},
+		{"1 2", `unexpected "2" at position 3`},
+		{"1..2", `invalid number "1..2" at position 1`},
+		{"max(1 2)", `expected "," or ")" but found "2" at position 7`},
+		{"max(1,)", `unexpected ")" at position 7`},
+		{"2 $ 3", `unexpected "$" at position 3`},
+		{"* 2", `unexpected "*" at position 1`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.src, func(t *testing.T) {
+			_, err := Parse(tt.src)
+			if err == nil {
+				t.Fatal("parsed without error")
+			}
+			if err.Error() != tt.want {
+				t.Errorf("got %q, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckErrors(t *testing.T) {
+	tests := []struct {
+		src  string
+		want string
+	}{
+		{"x + z", `unknown variable "z" at position 5`},
+		{"2 * foo(1)", `unknown function "foo" at position 5`},
+		{"max(1, unknown)", `unknown variable "unknown" at position 8`},
+		{"min()", "min takes at least 1 argument but was given 0 at position 1"},
+		{"1 + max()", "max takes at least 1 argument but was given 0 at position 5"},
+		{"sum2(1)", "sum2 takes 2 arguments but was given 1 at position 1"},
+		{"sum2(1, 2, 3)", "sum2 takes 2 arguments but was given 3 at position 1"},
+		{"max(sum2(1), 2)", "sum2 takes 2 arguments but was given 1 at position 5"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.src, func(t *testing.T) {
+			f, err := Parse(tt.src)
+			if err != nil {
+				t.Fatalf("Parse: %v", err)
+			}
+			err = f.Check(testEnv)
+			if err == nil {
+				t.Fatal("checked without error")
+			}
+			if err.Error() != tt.want {
+				t.Errorf("Check: got %q, want %q", err, tt.want)
+			}
+			// Evaluating refuses the formula in the same way
+			if _, err := f.Eval(testEnv); err == nil || err.Error() != tt.want {
+				t.Errorf("Eval: got %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestEvalErrors(t *testing.T) {
+	tests := []struct {
+		src  string
+		want string
+	}{
+		{"1 / 0", "division by zero at position 3"},
+		{"x / (y - 0.5)", "division by zero at position 3"},
+		{"max(1, 2 / (x - 4))", "division by zero at position 10"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.src, func(t *testing.T) {
+			f, err := Parse(tt.src)
+			if err != nil {
+				t.Fatalf("Parse: %v", err)
+			}
+			if err := f.Check(testEnv); err != nil {
+				t.Fatalf("Check: %v", err)
+			}
+			_, err = f.Eval(testEnv)
+			if err == nil {
+				t.Fatal("evaluated without error")
+			}
+			if err.Error() != tt.want {
+				t.Errorf("got %q, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestHousehold(t *testing.T) {
+	applicant := models.Applicant{
+		DateOfBirth: "1985-06-15",
+		Household: []models.Household{
+			{Relationship: "wife", DateOfBirth: "1987-01-01"},
+			{Relationship: "son", DateOfBirth: "2015-06-16"},
+			{Relationship: "daughter", DateOfBirth: "2020-03-01"},
+			{Relationship: "mother", DateOfBirth: "1955-12-31"},
+		},
+	}
+	env := Household(applicant, time.Date(2025, 6, 15, 0, 0, 0, 0, time.UTC))
+
+	tests := []struct {
+		src  string
+		want string
+	}{
+		{"household_size", "5/1"},
+		{"household_members", "4/1"},
+		{"children_count", "2/1"},
+		{"applicant_age", "40/1"},
+		// The son turns 10 the day after
+		{"members_aged(0, 9)", "2/1"},
+		{"members_aged(10, 64)", "1/1"},
+		{"members_aged(65, 200)", "1/1"},
+		{"members_aged(18, 0)", "0/1"},
+		{"100 + 50 * children_count", "200/1"},
+		{"max(0, 600 - 100 * household_size)", "100/1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.src, func(t *testing.T) {
+			f, err := Parse(tt.src)
+			if err != nil {
+				t.Fatalf("Parse: %v", err)
+			}
+			got, err := f.Eval(env)
+			if err != nil {
+				t.Fatalf("Eval: %v", err)
+			}
+			if got.String() != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHouseholdChildrenInAnyCase(t *testing.T) {
+	// Relationships are stored as typed, and count as MySQL compares them when checking eligibility
+	applicant := models.Applicant{Household: []models.Household{
+		{Relationship: "Son"}, {Relationship: "DAUGHTER"}, {Relationship: "Mother"}, {Relationship: "stepson"},
+	}}
+	f, err := Parse("children_count")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := f.Eval(Household(applicant, time.Now()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.String() != "2/1" {
+		t.Errorf("children_count = %s, want 2/1", got)
+	}
+}
+
+func TestCheckHousehold(t *testing.T) {
+	tests := []struct {
+		src  string
+		want string // empty when the formula is valid
+	}{
+		{"100 + 50 * children_count", ""},
+		{"max(0, 600 - 100 * household_size)", ""},
+		{"members_aged(0, 17) * 25", ""},
+		{"income * 2", `unknown variable "income" at position 1`},
+		{"members_aged(65)", "members_aged takes 2 arguments but was given 1 at position 1"},
+		{"members_aged(0, 17, 65)", "members_aged takes 2 arguments but was given 3 at position 1"},
+		{"average(applicant_age)", `unknown function "average" at position 1`},
+		{"100 +", "unexpected end of formula at position 6"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.src, func(t *testing.T) {
+			err := CheckHousehold(tt.src)
+			switch {
+			case tt.want == "" && err != nil:
+				t.Errorf("got %q, want no error", err)
+			case tt.want != "" && err == nil:
+				t.Errorf("got no error, want %q", tt.want)
+			case tt.want != "" && err.Error() != tt.want:
+				t.Errorf("got %q, want %q", err, tt.want)
+			}
+		})
+	}
+}
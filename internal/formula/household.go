@@ -0,0 +1,81 @@
+// Evaluates benefit amount formulas against an applicant's household.
+package formula
+
+import (
+	"math/big"
+	"time"
+
+	"fas/internal/models"
+)
+
+// HouseholdVariables describes the variables a benefit's amount formula may use.
+var HouseholdVariables = map[string]string{
+	"household_size":    "Number of people in the household, including the applicant",
+	"household_members": "Number of household members, not counting the applicant",
+	"children_count":    "Number of household members who are the applicant's son or daughter",
+	"applicant_age":     "Age of the applicant in whole years",
+}
+
+// HouseholdFunctions describes the functions a benefit's amount formula may call, besides min and max.
+var HouseholdFunctions = map[string]string{
+	"members_aged": "members_aged(youngest, oldest) is the number of household members whose age in years is between the two, inclusive",
+}
+
+// Household returns the environment in which a benefit's amount formula is evaluated for an applicant,
+// with ages taken on the given day. A date of birth that cannot be read counts as age 0.
+func Household(applicant models.Applicant, on time.Time) Env {
+	children := 0
+	ages := make([]int, len(applicant.Household))
+	for i, member := range applicant.Household {
+		if member.IsChild() {
+			children++
+		}
+		ages[i] = age(member.DateOfBirth, on)
+	}
+
+	return Env{
+		Vars: map[string]*big.Rat{
+			"household_size":    big.NewRat(int64(len(applicant.Household)+1), 1),
+			"household_members": big.NewRat(int64(len(applicant.Household)), 1),
+			"children_count":    big.NewRat(int64(children), 1),
+			"applicant_age":     big.NewRat(int64(age(applicant.DateOfBirth, on)), 1),
+		},
+		Funcs: map[string]Function{
+			"members_aged": {MinArgs: 2, MaxArgs: 2, Call: func(args []*big.Rat) (*big.Rat, error) {
+				count := int64(0)
+				for _, a := range ages {
+					years := big.NewRat(int64(a), 1)
+					if years.Cmp(args[0]) >= 0 && years.Cmp(args[1]) <= 0 {
+						count++
+					}
+				}
+				return big.NewRat(count, 1), nil
+			}},
+		},
+	}
+}
+
+// CheckHousehold parses a benefit's amount formula and checks that it only uses the household variables and functions.
+func CheckHousehold(src string) error {
+	f, err := Parse(src)
+	if err != nil {
+		return err
+	}
+	return f.Check(Household(models.Applicant{}, time.Now()))
+}
+
+// age returns the age in whole years on the given day of someone born on a YYYY-MM-DD date.
+func age(dateOfBirth string, on time.Time) int {
+	born, err := time.Parse("2006-01-02", dateOfBirth)
+	if err != nil {
+		return 0
+	}
+	years := on.Year() - born.Year()
+	if on.Month() < born.Month() || on.Month() == born.Month() && on.Day() < born.Day() {
+		years--
+	}
+	if years < 0 {
+		return 0
+	}
+	return years
+}
@@ -0,0 +1,187 @@
+// Handles all the requests related to API keys.
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+
+	"fas/internal/audit"
+	"fas/internal/auth"
+	"fas/internal/models"
+	"fas/internal/utils"
+)
+
+// GetAPIKeys retrieves every API key issued, without the keys themselves.
+func GetAPIKeys(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		rows, err := db.QueryContext(ctx, `SELECT id, name, key_prefix, role, COALESCE(created_by, ''), created_at, last_used_at, revoked_at 
+			FROM api_keys ORDER BY created_at`)
+		if err != nil {
+			utils.Error(w, http.StatusInternalServerError, utils.CodeInternal, "Failed to retrieve API keys")
+			return
+		}
+		defer rows.Close()
+
+		keys := []models.APIKey{}
+		for rows.Next() {
+			var key models.APIKey
+			if err := rows.Scan(&key.ID, &key.Name, &key.Prefix, &key.Role, &key.CreatedBy, &key.CreatedAt, &key.LastUsedAt, &key.RevokedAt); err != nil {
+				utils.Error(w, http.StatusInternalServerError, utils.CodeInternal, "Failed to scan API key")
+				return
+			}
+			keys = append(keys, key)
+		}
+		if err := rows.Err(); err != nil {
+			utils.Error(w, http.StatusInternalServerError, utils.CodeInternal, "Failed to read API key data")
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(keys)
+	}
+}
+
+// CreateAPIKey issues a new API key. The key is only ever returned in this response.
+func CreateAPIKey(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		var key models.APIKey
+		if err := json.NewDecoder(r.Body).Decode(&key); err != nil {
+			utils.Error(w, http.StatusBadRequest, utils.CodeInvalidRequest, "Invalid input")
+			return
+		}
+		key.Name = strings.TrimSpace(key.Name)
+		if key.Name == "" {
+			utils.WriteError(w, http.StatusBadRequest, utils.APIError{Code: utils.CodeMissingValue, Field: "name", Message: "Name is required"})
+			return
+		}
+		if !auth.IsRole(key.Role) {
+			utils.WriteError(w, http.StatusBadRequest, utils.APIError{
+				Code:    utils.CodeInvalidValue,
+				Field:   "role",
+				Message: "Invalid role, " + utils.FormatValidOptions(auth.Roles()),
+				Details: map[string][]string{"valid_options": auth.Roles()},
+			})
+			return
+		}
+
+		plaintext, prefix, err := auth.GenerateAPIKey()
+		if err != nil {
+			utils.Error(w, http.StatusInternalServerError, utils.CodeInternal, "Failed to generate API key")
+			return
+		}
+
+		principal, _ := auth.PrincipalFrom(r.Context())
+		key.ID = uuid.New().String()
+		key.Prefix = prefix
+		key.CreatedBy = principal.Name
+		key.CreatedAt = time.Now().UTC().Format("2006-01-02 15:04:05")
+		key.LastUsedAt, key.RevokedAt = nil, nil
+
+		// Begin transaction
+		tx, err := db.BeginTx(ctx, nil)
+		if err != nil {
+			utils.Error(w, http.StatusInternalServerError, utils.CodeInternal, "Failed to begin transaction")
+			return
+		}
+		defer tx.Rollback()
+
+		// Only the hash of the key is stored
+		_, err = tx.ExecContext(ctx, `INSERT INTO api_keys (id, name, key_prefix, key_hash, role, created_by, created_at) 
+			VALUES (?, ?, ?, ?, ?, ?, ?)`,
+			key.ID, key.Name, key.Prefix, auth.HashAPIKey(plaintext), key.Role, key.CreatedBy, key.CreatedAt)
+		if err != nil {
+			utils.HandleInsertError(w, err, "API key")
+			return
+		}
+
+		// Record the change, without the key itself
+		err = audit.Record(r.Context(), tx, audit.Entry{Action: audit.ActionCreate, EntityType: "api_key", EntityID: key.ID, After: key})
+		if err != nil {
+			utils.Error(w, http.StatusInternalServerError, utils.CodeInternal, "Failed to record audit log")
+			return
+		}
+
+		// Commit the transaction
+		if err := tx.Commit(); err != nil {
+			utils.Error(w, http.StatusInternalServerError, utils.CodeInternal, "Failed to commit")
+			return
+		}
+
+		key.Key = plaintext
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(key)
+	}
+}
+
+// RevokeAPIKey revokes an API key so that it can no longer authenticate.
+func RevokeAPIKey(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		keyID := mux.Vars(r)["id"]
+		if err := checkAPIKey(ctx, db, keyID); err != nil {
+			utils.HandleLookupError(w, err)
+			return
+		}
+
+		// Begin transaction
+		tx, err := db.BeginTx(ctx, nil)
+		if err != nil {
+			utils.Error(w, http.StatusInternalServerError, utils.CodeInternal, "Failed to begin transaction")
+			return
+		}
+		defer tx.Rollback()
+
+		_, err = tx.ExecContext(ctx, `UPDATE api_keys SET revoked_at = COALESCE(revoked_at, ?) WHERE id = ?`, time.Now().UTC(), keyID)
+		if err != nil {
+			utils.Error(w, http.StatusInternalServerError, utils.CodeInternal, "Failed to revoke API key")
+			return
+		}
+
+		// Record the change
+		err = audit.Record(r.Context(), tx, audit.Entry{Action: audit.ActionRevoke, EntityType: "api_key", EntityID: keyID})
+		if err != nil {
+			utils.Error(w, http.StatusInternalServerError, utils.CodeInternal, "Failed to record audit log")
+			return
+		}
+
+		// Commit the transaction
+		if err := tx.Commit(); err != nil {
+			utils.Error(w, http.StatusInternalServerError, utils.CodeInternal, "Failed to commit")
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// checkAPIKey validates the UUID and checks if an API key exists.
+func checkAPIKey(ctx context.Context, db *sql.DB, keyID string) error {
+	// Validate the UUID for security
+	if err := utils.ValidateUUID(keyID); err != nil {
+		return fmt.Errorf("invalid UUID: %w", err)
+	}
+
+	// Check if the API key exists
+	var exists bool
+	err := db.QueryRowContext(ctx, "SELECT EXISTS(SELECT 1 FROM api_keys WHERE id = ?)", keyID).Scan(&exists)
+	if err != nil {
+		return fmt.Errorf("error checking API key existence: %w", err)
+	}
+	if !exists {
+		return fmt.Errorf("API key %w", utils.ErrNotFound)
+	}
+
+	return nil
+}
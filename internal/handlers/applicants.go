@@ -2,27 +2,33 @@
 package handlers
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"time"
 	
 	"github.com/google/uuid"
 	"github.com/gorilla/mux"
 
+	"fas/internal/audit"
+	"fas/internal/logging"
 	"fas/internal/models"
 	"fas/internal/utils"
 )
 
 // GetApplicants retrieves all applicants from the database, returning them in JSON format.
+// Deleted applicants are only included when include_deleted=true.
 func GetApplicants(db *sql.DB) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		rows, err := db.Query(`
-			SELECT id, name, employment_status, marital_status, sex, date_of_birth 
+		ctx := r.Context()
+		rows, err := db.QueryContext(ctx, `
+			SELECT id, name, employment_status, marital_status, sex, date_of_birth, bank_account_holder, bank_account_number, bank_bic, version, deleted_at 
 			FROM applicants
-		`)
+		` + notDeleted(r, "WHERE"))
 		if err != nil {
-			http.Error(w, "Failed to retrieve applicants", http.StatusInternalServerError)
+			utils.Error(w, http.StatusInternalServerError, utils.CodeInternal, "Failed to retrieve applicants")
 			return
 		}
 		defer rows.Close()
@@ -32,6 +38,7 @@ func GetApplicants(db *sql.DB) http.HandlerFunc {
 		// Parse applicants
 		for rows.Next() {
 			var applicant models.Applicant
+			var holder, number, bic sql.NullString
 			err := rows.Scan(
 				&applicant.ID, 
 				&applicant.Name, 
@@ -39,84 +46,173 @@ func GetApplicants(db *sql.DB) http.HandlerFunc {
 				&applicant.MaritalStatus, 
 				&applicant.Sex, 
 				&applicant.DateOfBirth,
+				&holder,
+				&number,
+				&bic,
+				&applicant.Version,
+				&applicant.DeletedAt,
 			)
 			if err != nil {
-				http.Error(w, "Failed to scan applicants", http.StatusInternalServerError)
+				utils.Error(w, http.StatusInternalServerError, utils.CodeInternal, "Failed to scan applicants")
 				return
 			}
-
-			// Get household members for the current applicant
-			householdMembers, err := getHouseholdMembers(db, applicant.ID)
-			if err != nil {
-				http.Error(w, "Failed to retrieve household members", http.StatusInternalServerError)
-				return
-			}
-			applicant.Household = householdMembers
+			applicant.BankAccount = bankAccount(holder, number, bic)
 
 			applicants = append(applicants, applicant)
 		}
 		if err := rows.Err(); err != nil {
-			http.Error(w, "Error iterating over applicants", http.StatusInternalServerError)
+			utils.Error(w, http.StatusInternalServerError, utils.CodeInternal, "Error iterating over applicants")
 			return
 		}
 
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusOK)
-		json.NewEncoder(w).Encode(applicants)
+		// Get the household members of every applicant at once
+		ids := make([]string, len(applicants))
+		for i, applicant := range applicants {
+			ids[i] = applicant.ID
+		}
+		households, err := getHouseholdMembersByApplicant(ctx, db, ids)
+		if err != nil {
+			utils.Error(w, http.StatusInternalServerError, utils.CodeInternal, "Failed to retrieve household members")
+			return
+		}
+		for i := range applicants {
+			applicants[i].Household = households[applicants[i].ID]
+		}
+
+		utils.WriteConditionalJSON(w, r, "", applicants)
 	}
 }
 
-// getHouseholdMembers retrieves the household members for a given applicant ID
-func getHouseholdMembers(db *sql.DB, applicantID string) ([]models.Household, error) {
-	rows, err := db.Query(
-		`SELECT id, applicant_id, name, relationship, sex, school_level, employment_status, date_of_birth 
-		FROM household WHERE applicant_id = ?`, 
-		applicantID,
+// GetApplicant retrieves a single applicant and their household members, tagged with the applicant's version.
+func GetApplicant(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		applicantID := mux.Vars(r)["id"]
+		if err := utils.ValidateUUID(applicantID); err != nil {
+			utils.HandleLookupError(w, err)
+			return
+		}
+
+		applicant, err := loadApplicant(ctx, db, applicantID)
+		if err == sql.ErrNoRows || (err == nil && !visible(r, applicant.DeletedAt)) {
+			utils.Error(w, http.StatusNotFound, utils.CodeNotFound, "Applicant not found")
+			return
+		}
+		if err != nil {
+			utils.Error(w, http.StatusInternalServerError, utils.CodeInternal, "Failed to retrieve applicant")
+			return
+		}
+
+		utils.WriteConditionalJSON(w, r, utils.VersionETag(applicant.Version), applicant)
+	}
+}
+
+// loadApplicant retrieves an applicant and their household members, whether deleted or not,
+// returning sql.ErrNoRows if there is no such applicant.
+func loadApplicant(ctx context.Context, q queryer, applicantID string) (models.Applicant, error) {
+	var applicant models.Applicant
+	var holder, number, bic sql.NullString
+	err := q.QueryRowContext(ctx, `
+		SELECT id, name, employment_status, marital_status, sex, date_of_birth, bank_account_holder, bank_account_number, bank_bic, version, deleted_at 
+		FROM applicants WHERE id = ?
+	`, applicantID).Scan(
+		&applicant.ID, 
+		&applicant.Name, 
+		&applicant.EmploymentStatus, 
+		&applicant.MaritalStatus, 
+		&applicant.Sex, 
+		&applicant.DateOfBirth,
+		&holder,
+		&number,
+		&bic,
+		&applicant.Version,
+		&applicant.DeletedAt,
 	)
 	if err != nil {
-		return nil, err
+		return models.Applicant{}, err
 	}
-	defer rows.Close()
+	applicant.BankAccount = bankAccount(holder, number, bic)
 
-	var householdMembers []models.Household
+	applicant.Household, err = getHouseholdMembers(ctx, q, applicant.ID)
+	return applicant, err
+}
 
-	// Parse household members
-	for rows.Next() {
-		var member models.Household
-		err := rows.Scan(&member.ID, &member.ApplicantID, &member.Name, &member.Relationship, &member.Sex, &member.SchoolLevel, &member.EmploymentStatus, &member.DateOfBirth)
-		if err != nil {
-			return nil, err
-		}
+// bankAccount builds an applicant's bank account from its columns, which are NULL when the applicant has none.
+func bankAccount(holder, number, bic sql.NullString) *models.BankAccount {
+	if !number.Valid {
+		return nil
+	}
+	return &models.BankAccount{Holder: holder.String, Number: number.String, BIC: bic.String}
+}
 
-		householdMembers = append(householdMembers, member)
+// bankAccountValues returns the columns of an applicant's bank account, NULL when the applicant has none.
+func bankAccountValues(account *models.BankAccount) (holder, number, bic interface{}) {
+	if account == nil {
+		return nil, nil, nil
 	}
+	if account.BIC != "" {
+		bic = account.BIC
+	}
+	return account.Holder, account.Number, bic
+}
 
-	return householdMembers, rows.Err()
+// getHouseholdMembers retrieves the household members for a given applicant ID
+func getHouseholdMembers(ctx context.Context, q queryer, applicantID string) ([]models.Household, error) {
+	households, err := getHouseholdMembersByApplicant(ctx, q, []string{applicantID})
+	return households[applicantID], err
+}
+
+// getHouseholdMembersByApplicant retrieves the household members of many applicants in one query,
+// keyed by applicant ID.
+func getHouseholdMembersByApplicant(ctx context.Context, q queryer, applicantIDs []string) (map[string][]models.Household, error) {
+	households := make(map[string][]models.Household)
+	err := queryIn(ctx, q,
+		`SELECT id, applicant_id, name, relationship, sex, school_level, employment_status, date_of_birth 
+		FROM household WHERE applicant_id IN (%s)`,
+		applicantIDs,
+		func(rows *sql.Rows) error {
+			var member models.Household
+			err := rows.Scan(&member.ID, &member.ApplicantID, &member.Name, &member.Relationship, &member.Sex, &member.SchoolLevel, &member.EmploymentStatus, &member.DateOfBirth)
+			if err != nil {
+				return err
+			}
+			households[member.ApplicantID] = append(households[member.ApplicantID], member)
+			return nil
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+	return households, nil
 }
 
 // CreateApplicant creates a new applicant in the database from the JSON input.
 func CreateApplicant(db *sql.DB) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
 		var applicant models.Applicant
 		if err := json.NewDecoder(r.Body).Decode(&applicant); err != nil {
-			http.Error(w, "Invalid input", http.StatusBadRequest)
+			utils.Error(w, http.StatusBadRequest, utils.CodeInvalidRequest, "Invalid input")
 			return
 		}
 
 		// Begin transaction
-		tx, err := db.Begin()
+		tx, err := db.BeginTx(ctx, nil)
 		if err != nil {
-			http.Error(w, "Failed to begin transaction", http.StatusInternalServerError)
+			utils.Error(w, http.StatusInternalServerError, utils.CodeInternal, "Failed to begin transaction")
 			return
 		}
 		defer tx.Rollback()
 
 		// Insert the applicant
-		fmt.Println("Inserting applicant:", applicant)
+		logging.FromContext(r.Context()).Debug("inserting applicant", "applicant", applicant)
 		applicant.ID = uuid.New().String()
-		_, err = tx.Exec(`INSERT INTO applicants (id, name, employment_status, marital_status, sex, date_of_birth) 
-			VALUES (?, ?, ?, ?, ?, ?)`, 
-			applicant.ID, applicant.Name, applicant.EmploymentStatus, applicant.MaritalStatus, applicant.Sex, applicant.DateOfBirth)
+		applicant.Version = 1
+		holder, number, bic := bankAccountValues(applicant.BankAccount)
+		_, err = tx.ExecContext(ctx, `INSERT INTO applicants (id, name, employment_status, marital_status, sex, date_of_birth,
+			bank_account_holder, bank_account_number, bank_bic) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`, 
+			applicant.ID, applicant.Name, applicant.EmploymentStatus, applicant.MaritalStatus, applicant.Sex, applicant.DateOfBirth,
+			holder, number, bic)
 
 		if err != nil {
 			utils.HandleInsertError(w, err, "applicant")
@@ -126,10 +222,9 @@ func CreateApplicant(db *sql.DB) http.HandlerFunc {
 		// Insert household members (if any)
 		for i := range applicant.Household {
 			member := &applicant.Household[i]
-			fmt.Println("Inserting household member:", *member)
 			member.ID = uuid.New().String()
 			member.ApplicantID = applicant.ID
-			_, err = tx.Exec(`INSERT INTO household (id, applicant_id, name, relationship, sex, school_level, employment_status, date_of_birth) 
+			_, err = tx.ExecContext(ctx, `INSERT INTO household (id, applicant_id, name, relationship, sex, school_level, employment_status, date_of_birth) 
 				VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
 				member.ID, applicant.ID, member.Name, member.Relationship, member.Sex, member.SchoolLevel, member.EmploymentStatus, member.DateOfBirth)
 			
@@ -139,13 +234,21 @@ func CreateApplicant(db *sql.DB) http.HandlerFunc {
 			}
 		}
 
+		// Record the change
+		err = audit.Record(r.Context(), tx, audit.Entry{Action: audit.ActionCreate, EntityType: "applicant", EntityID: applicant.ID, After: applicant})
+		if err != nil {
+			utils.Error(w, http.StatusInternalServerError, utils.CodeInternal, "Failed to record audit log")
+			return
+		}
+
 		// Commit the transaction
 		err = tx.Commit()
 		if err != nil {
-			http.Error(w, "Failed to commit", http.StatusInternalServerError)
+			utils.Error(w, http.StatusInternalServerError, utils.CodeInternal, "Failed to commit")
 			return
 		}
 
+		w.Header().Set("ETag", utils.VersionETag(applicant.Version))
 		w.WriteHeader(http.StatusCreated)
 		json.NewEncoder(w).Encode(applicant)
 	}
@@ -154,40 +257,58 @@ func CreateApplicant(db *sql.DB) http.HandlerFunc {
 // UpdateApplicant updates an existing applicant and their household members in the database.
 func UpdateApplicant(db *sql.DB) http.HandlerFunc {
     return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
 		// Validate the applicant
         vars := mux.Vars(r)
         applicantID := vars["id"]
-        if err := checkApplicant(db, applicantID); err != nil {
-            http.Error(w, err.Error(), http.StatusBadRequest)
+        if err := checkApplicant(ctx, db, applicantID); err != nil {
+            utils.HandleLookupError(w, err)
+            return
+        }
+        version, ok := utils.RequireIfMatch(w, r)
+        if !ok {
             return
         }
 
 		var applicant models.Applicant
         if err := json.NewDecoder(r.Body).Decode(&applicant); err != nil {
-            http.Error(w, "Invalid input", http.StatusBadRequest)
+            utils.Error(w, http.StatusBadRequest, utils.CodeInvalidRequest, "Invalid input")
             return
         }
 
 		// Begin transaction
-        tx, err := db.Begin()
+        tx, err := db.BeginTx(ctx, nil)
         if err != nil {
-            http.Error(w, "Failed to begin transaction", http.StatusInternalServerError)
+            utils.Error(w, http.StatusInternalServerError, utils.CodeInternal, "Failed to begin transaction")
             return
         }
         defer tx.Rollback()
 
-		// Update the applicant
-        _, err = tx.Exec(`UPDATE applicants SET name=?, employment_status=?, marital_status=?, sex=?, date_of_birth=? WHERE id=?`,
-            applicant.Name, applicant.EmploymentStatus, applicant.MaritalStatus, applicant.Sex, applicant.DateOfBirth, applicantID)
+        before, err := loadApplicant(ctx, tx, applicantID)
         if err != nil {
-            http.Error(w, "Failed to update applicant", http.StatusInternalServerError)
+            utils.Error(w, http.StatusInternalServerError, utils.CodeInternal, "Failed to retrieve applicant")
+            return
+        }
+
+		// Update the applicant, provided nobody has changed it since the client read it
+        holder, number, bic := bankAccountValues(applicant.BankAccount)
+        result, err := tx.ExecContext(ctx, `UPDATE applicants SET name=?, employment_status=?, marital_status=?, sex=?, date_of_birth=?, 
+            bank_account_holder=?, bank_account_number=?, bank_bic=?, version=version+1 WHERE id=? AND version=?`,
+            applicant.Name, applicant.EmploymentStatus, applicant.MaritalStatus, applicant.Sex, applicant.DateOfBirth,
+            holder, number, bic, applicantID, version)
+        if err != nil {
+            utils.Error(w, http.StatusInternalServerError, utils.CodeInternal, "Failed to update applicant")
+            return
+        }
+        if n, err := result.RowsAffected(); err != nil || n == 0 {
+            utils.Error(w, http.StatusPreconditionFailed, utils.CodePreconditionFailed, "Applicant has been modified since it was retrieved")
             return
         }
 
         // Delete all existing household members
-        _, err = tx.Exec(`DELETE FROM household WHERE applicant_id=?`, applicantID)
+        _, err = tx.ExecContext(ctx, `DELETE FROM household WHERE applicant_id=?`, applicantID)
         if err != nil {
-            http.Error(w, "Failed to delete existing household members", http.StatusInternalServerError)
+            utils.Error(w, http.StatusInternalServerError, utils.CodeInternal, "Failed to delete existing household members")
             return
         }
 
@@ -195,7 +316,7 @@ func UpdateApplicant(db *sql.DB) http.HandlerFunc {
         for i := range applicant.Household {
 			member := &applicant.Household[i]
             member.ID = uuid.New().String()
-            _, err = tx.Exec(`INSERT INTO household (id, applicant_id, name, relationship, sex, school_level, employment_status, date_of_birth) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+            _, err = tx.ExecContext(ctx, `INSERT INTO household (id, applicant_id, name, relationship, sex, school_level, employment_status, date_of_birth) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
                 member.ID, applicantID, member.Name, member.Relationship, member.Sex, member.SchoolLevel, member.EmploymentStatus, member.DateOfBirth)
             if err != nil {
                 utils.HandleInsertError(w, err, "household member")
@@ -203,55 +324,115 @@ func UpdateApplicant(db *sql.DB) http.HandlerFunc {
             }
         }
 
+        // Record the change
+        after, err := loadApplicant(ctx, tx, applicantID)
+        if err != nil {
+            utils.Error(w, http.StatusInternalServerError, utils.CodeInternal, "Failed to retrieve applicant")
+            return
+        }
+        err = audit.Record(r.Context(), tx, audit.Entry{Action: audit.ActionUpdate, EntityType: "applicant", EntityID: applicantID, Before: before, After: after})
+        if err != nil {
+            utils.Error(w, http.StatusInternalServerError, utils.CodeInternal, "Failed to record audit log")
+            return
+        }
+
 		// Commit the transaction
         if err = tx.Commit(); err != nil {
-            http.Error(w, "Failed to commit", http.StatusInternalServerError)
+            utils.Error(w, http.StatusInternalServerError, utils.CodeInternal, "Failed to commit")
             return
         }
 
+        w.Header().Set("ETag", utils.VersionETag(version+1))
         w.WriteHeader(http.StatusNoContent)
     }
 }
 
-// DeleteApplicant removes an applicant from the database.
+// DeleteApplicant marks an applicant as deleted. It can be restored until it is purged.
+// An applicant with applications is only deleted, along with the applications, when cascade=true.
 func DeleteApplicant(db *sql.DB) http.HandlerFunc {
     return func(w http.ResponseWriter, r *http.Request) {
+        ctx := r.Context()
         // Validate the applicant
 		vars := mux.Vars(r)
         applicantID := vars["id"]
-        if err := checkApplicant(db, applicantID); err != nil {
-            http.Error(w, err.Error(), http.StatusBadRequest)
+        if err := checkApplicant(ctx, db, applicantID); err != nil {
+            utils.HandleLookupError(w, err)
+            return
+        }
+        version, ok := utils.RequireIfMatch(w, r)
+        if !ok {
             return
         }
 
 		// Begin transaction
-        tx, err := db.Begin()
+        tx, err := db.BeginTx(ctx, nil)
         if err != nil {
-            http.Error(w, "Failed to begin transaction", http.StatusInternalServerError)
+            utils.Error(w, http.StatusInternalServerError, utils.CodeInternal, "Failed to begin transaction")
             return
         }
         defer tx.Rollback()
 
-		// Delete the applicant
-        _, err = tx.Exec(`DELETE FROM applicants WHERE id=?`, applicantID)
+        before, err := loadApplicant(ctx, tx, applicantID)
+        if err != nil {
+            utils.Error(w, http.StatusInternalServerError, utils.CodeInternal, "Failed to retrieve applicant")
+            return
+        }
+
+        // Refuse to delete the applications of the applicant unless asked to
+        applications, err := dependentApplications(ctx, tx, "applicant_id", applicantID, false)
+        if err != nil {
+            utils.Error(w, http.StatusInternalServerError, utils.CodeInternal, "Failed to retrieve applications")
+            return
+        }
+        if !refuseDependents(w, r, "applicant", applications) {
+            return
+        }
+
+		// Delete the applicant, provided nobody has changed it since the client read it
+        result, err := tx.ExecContext(ctx, `UPDATE applicants SET deleted_at=?, version=version+1 WHERE id=? AND version=? AND deleted_at IS NULL`,
+            time.Now().UTC(), applicantID, version)
+        if err != nil {
+            utils.Error(w, http.StatusInternalServerError, utils.CodeInternal, "Failed to delete applicant")
+            return
+        }
+        if n, err := result.RowsAffected(); err != nil || n == 0 {
+            utils.Error(w, http.StatusPreconditionFailed, utils.CodePreconditionFailed, "Applicant has been modified since it was retrieved")
+            return
+        }
+
+        // Record the change
+        after, err := loadApplicant(ctx, tx, applicantID)
+        if err != nil {
+            utils.Error(w, http.StatusInternalServerError, utils.CodeInternal, "Failed to retrieve applicant")
+            return
+        }
+        err = audit.Record(r.Context(), tx, audit.Entry{Action: audit.ActionDelete, EntityType: "applicant", EntityID: applicantID, Before: before, After: after})
         if err != nil {
-            http.Error(w, "Failed to delete applicant", http.StatusInternalServerError)
+            utils.Error(w, http.StatusInternalServerError, utils.CodeInternal, "Failed to record audit log")
+            return
+        }
+
+        // Delete the applications of the applicant
+        removed := removal{"applicant": {applicantID}}
+        removed["application"], err = cascadeDeleteApplications(r.Context(), tx, applications)
+        if err != nil {
+            utils.Error(w, http.StatusInternalServerError, utils.CodeInternal, "Failed to delete applications")
             return
         }
 
 		// Commit the transaction
         err = tx.Commit()
         if err != nil {
-            http.Error(w, "Failed to commit", http.StatusInternalServerError)
+            utils.Error(w, http.StatusInternalServerError, utils.CodeInternal, "Failed to commit")
             return
         }
 
-        w.WriteHeader(http.StatusNoContent)
+        writeRemoval(w, r, removed)
     }
 }
 
-// checkApplicant validates the UUID and checks if an applicant exists in the database.
-func checkApplicant(db *sql.DB, applicantID string) error {
+// checkApplicant validates the UUID and checks if an applicant exists in the database and has not been deleted.
+func checkApplicant(ctx context.Context, db *sql.DB, applicantID string) error {
     // Validate the UUID for security
     if err := utils.ValidateUUID(applicantID); err != nil {
         return fmt.Errorf("invalid UUID: %w", err)
@@ -259,12 +440,12 @@ func checkApplicant(db *sql.DB, applicantID string) error {
 
     // Check if the applicant exists
     var exists bool
-    err := db.QueryRow("SELECT EXISTS(SELECT 1 FROM applicants WHERE id = ?)", applicantID).Scan(&exists)
+    err := db.QueryRowContext(ctx, "SELECT EXISTS(SELECT 1 FROM applicants WHERE id = ? AND deleted_at IS NULL)", applicantID).Scan(&exists)
     if err != nil {
         return fmt.Errorf("error checking applicant existence: %w", err)
     }
     if !exists {
-        return fmt.Errorf("applicant not found")
+        return fmt.Errorf("applicant %w", utils.ErrNotFound)
     }
 
     return nil
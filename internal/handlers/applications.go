@@ -2,8 +2,10 @@
 package handlers
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
+    "errors"
     "fmt"
 	"net/http"
 	"time"
@@ -11,16 +13,24 @@ import (
 	"github.com/google/uuid"
     "github.com/gorilla/mux"
     
+    "fas/internal/audit"
+    "fas/internal/auth"
+    "fas/internal/logging"
+    "fas/internal/metrics"
+    "fas/internal/middleware"
     "fas/internal/models"
 	"fas/internal/utils"
+	"fas/internal/validation"
 )
 
 // GetApplications retrieves all applications from the database.
+// Deleted applications are only included when include_deleted=true.
 func GetApplications(db *sql.DB) http.HandlerFunc {
     return func(w http.ResponseWriter, r *http.Request) {
-        rows, err := db.Query("SELECT id, applicant_id, scheme_id, status, applied_date FROM applications")
+        ctx := r.Context()
+        rows, err := db.QueryContext(ctx, "SELECT id, applicant_id, scheme_id, status, applied_date, version, deleted_at FROM applications" + notDeleted(r, " WHERE"))
         if err != nil {
-            http.Error(w, "Failed to retrieve applications", http.StatusInternalServerError)
+            utils.Error(w, http.StatusInternalServerError, utils.CodeInternal, "Failed to retrieve applications")
             return
         }
         defer rows.Close()
@@ -28,50 +38,113 @@ func GetApplications(db *sql.DB) http.HandlerFunc {
         var applications []models.Application
         for rows.Next() {
             var application models.Application
-            if err := rows.Scan(&application.ID, &application.ApplicantID, &application.SchemeID, &application.Status, &application.AppliedDate); err != nil {
-                http.Error(w, "Failed to scan application", http.StatusInternalServerError)
+            if err := rows.Scan(&application.ID, &application.ApplicantID, &application.SchemeID, &application.Status, &application.AppliedDate, &application.Version, &application.DeletedAt); err != nil {
+                utils.Error(w, http.StatusInternalServerError, utils.CodeInternal, "Failed to scan application")
                 return
             }
             applications = append(applications, application)
         }
         if err := rows.Err(); err != nil {
-            http.Error(w, "Failed to read application data", http.StatusInternalServerError)
+            utils.Error(w, http.StatusInternalServerError, utils.CodeInternal, "Failed to read application data")
             return
         }
+        rows.Close()
 
-        json.NewEncoder(w).Encode(applications)
+        // Fetch the entitlements of the approved applications
+        ids := make([]string, len(applications))
+        for i, application := range applications {
+            ids[i] = application.ID
+        }
+        entitlements, err := getEntitlementsByApplication(ctx, db, ids)
+        if err != nil {
+            utils.Error(w, http.StatusInternalServerError, utils.CodeInternal, "Failed to retrieve entitlements")
+            return
+        }
+        for i := range applications {
+            applications[i].Entitlements = entitlements[applications[i].ID]
+            applications[i].TotalEntitlement = models.TotalEntitlements(applications[i].Entitlements)
+        }
+
+        utils.WriteConditionalJSON(w, r, "", applications)
+    }
+}
+
+// GetApplication retrieves a single application, tagged with its version.
+func GetApplication(db *sql.DB) http.HandlerFunc {
+    return func(w http.ResponseWriter, r *http.Request) {
+        ctx := r.Context()
+        applicationID := mux.Vars(r)["id"]
+        if err := utils.ValidateUUID(applicationID); err != nil {
+            utils.HandleLookupError(w, err)
+            return
+        }
+
+        application, err := loadApplication(ctx, db, applicationID)
+        if err == sql.ErrNoRows || (err == nil && !visible(r, application.DeletedAt)) {
+            utils.Error(w, http.StatusNotFound, utils.CodeNotFound, "Application not found")
+            return
+        }
+        if err != nil {
+            utils.Error(w, http.StatusInternalServerError, utils.CodeInternal, "Failed to retrieve application")
+            return
+        }
+
+        utils.WriteConditionalJSON(w, r, utils.VersionETag(application.Version), application)
     }
 }
 
+// loadApplication retrieves an application, whether deleted or not, returning sql.ErrNoRows if there is no such application.
+func loadApplication(ctx context.Context, q queryer, applicationID string) (models.Application, error) {
+    var application models.Application
+    err := q.QueryRowContext(ctx, "SELECT id, applicant_id, scheme_id, status, applied_date, version, deleted_at FROM applications WHERE id = ?", applicationID).
+        Scan(&application.ID, &application.ApplicantID, &application.SchemeID, &application.Status, &application.AppliedDate, &application.Version, &application.DeletedAt)
+    if err != nil {
+        return models.Application{}, err
+    }
+
+    // Fetch the entitlement of an approved application
+    entitlements, err := getEntitlementsByApplication(ctx, q, []string{application.ID})
+    application.Entitlements = entitlements[application.ID]
+    application.TotalEntitlement = models.TotalEntitlements(application.Entitlements)
+    return application, err
+}
+
 // CreateApplication creates a new application in the database
 func CreateApplication(db *sql.DB) http.HandlerFunc {
     return func(w http.ResponseWriter, r *http.Request) {
+        ctx := r.Context()
         var application models.Application
         if err := json.NewDecoder(r.Body).Decode(&application); err != nil {
-            http.Error(w, "Invalid input", http.StatusBadRequest)
+            utils.Error(w, http.StatusBadRequest, utils.CodeInvalidRequest, "Invalid input")
             return
         }
 
 		// Begin transaction
-		tx, err := db.Begin()
+		tx, err := db.BeginTx(ctx, nil)
         if err != nil {
-            http.Error(w, "Failed to begin transaction", http.StatusInternalServerError)
+            utils.Error(w, http.StatusInternalServerError, utils.CodeInternal, "Failed to begin transaction")
             return
         }
         defer tx.Rollback()
 
+        // Applications can only be made by current applicants for current schemes
+        if !checkApplicationParties(ctx, w, db, application) {
+            return
+        }
+
         // Check if an application already exists
-        if applicationExists(db, application.ApplicantID, application.SchemeID) {
-            http.Error(w, "Application already exists", http.StatusConflict)
+        if applicationExists(ctx, db, application.ApplicantID, application.SchemeID) {
+            utils.Error(w, http.StatusConflict, utils.CodeDuplicateEntry, "Application already exists")
             return
         }
 
         application.ID = uuid.New().String()
-        application.Status = "Pending"
+        application.Status = models.StatusPending
+        application.Version = 1
 		application.AppliedDate = time.Now().Format("2006-01-02")
 
         // Insert the application
-        _, err = tx.Exec(`INSERT INTO applications (id, applicant_id, scheme_id, status, applied_date) 
+        _, err = tx.ExecContext(ctx, `INSERT INTO applications (id, applicant_id, scheme_id, status, applied_date) 
 			VALUES (?, ?, ?, ?, ?)`, 
 			application.ID, application.ApplicantID, application.SchemeID, application.Status, application.AppliedDate)
         if err != nil {
@@ -79,24 +152,61 @@ func CreateApplication(db *sql.DB) http.HandlerFunc {
             return
         }
 
+        // Record the change
+        err = audit.Record(r.Context(), tx, audit.Entry{Action: audit.ActionCreate, EntityType: "application", EntityID: application.ID, After: application})
+        if err != nil {
+            utils.Error(w, http.StatusInternalServerError, utils.CodeInternal, "Failed to record audit log")
+            return
+        }
+
 		// Commit the transaction
 		err = tx.Commit()
 		if err != nil {
-			http.Error(w, "Failed to commit", http.StatusInternalServerError)
+			utils.Error(w, http.StatusInternalServerError, utils.CodeInternal, "Failed to commit")
 			return
 		}
 
+        metrics.ApplicationsCreated.Inc(application.SchemeID)
+
         w.Header().Set("Content-Type", "application/json")
+        w.Header().Set("ETag", utils.VersionETag(application.Version))
         w.WriteHeader(http.StatusCreated)
         json.NewEncoder(w).Encode(application)
     }
 }
 
+// checkApplicationParties checks that the applicant and scheme of an application exist and have not been deleted,
+// writing the error response if either does not.
+func checkApplicationParties(ctx context.Context, w http.ResponseWriter, db *sql.DB, application models.Application) bool {
+    for _, party := range []struct {
+        field string
+        check func(context.Context, *sql.DB, string) error
+        id    string
+    }{
+        {"applicant_id", checkApplicant, application.ApplicantID},
+        {"scheme_id", checkScheme, application.SchemeID},
+    } {
+        err := party.check(ctx, db, party.id)
+        switch {
+        case err == nil:
+            continue
+        case errors.Is(err, utils.ErrNotFound), errors.Is(err, utils.ErrMissingID), errors.Is(err, utils.ErrInvalidID):
+            utils.WriteError(w, http.StatusBadRequest, utils.APIError{Code: utils.CodeForeignKeyViolation, Field: party.field,
+                Message: fmt.Sprintf("The application refers to an entry that does not exist: %v", err)})
+        case !utils.HandleContextError(w, err):
+            logging.FromContext(ctx).Error("checking application parties failed", "field", party.field, "error", err)
+            utils.Error(w, http.StatusInternalServerError, utils.CodeInternal, "Failed to check the applicant and scheme")
+        }
+        return false
+    }
+    return true
+}
+
 // Checks if an application already exists with the same applicant and scheme IDs
-func applicationExists(db *sql.DB, applicantID, schemeID string) bool {
+func applicationExists(ctx context.Context, db *sql.DB, applicantID, schemeID string) bool {
     var exists bool
     query := `SELECT EXISTS(SELECT 1 FROM applications WHERE applicant_id = ? AND scheme_id = ?)`
-    err := db.QueryRow(query, applicantID, schemeID).Scan(&exists)
+    err := db.QueryRowContext(ctx, query, applicantID, schemeID).Scan(&exists)
     if err != nil {
         return false
     }
@@ -106,75 +216,265 @@ func applicationExists(db *sql.DB, applicantID, schemeID string) bool {
 // UpdateApplication updates an existing application in the database.
 func UpdateApplication(db *sql.DB) http.HandlerFunc {
     return func(w http.ResponseWriter, r *http.Request) {
+        ctx := r.Context()
         // Validate the application
         vars := mux.Vars(r)
         applicationID := vars["id"]
-        if err := checkApplication(db, applicationID); err != nil {
-            http.Error(w, err.Error(), http.StatusBadRequest)
+        if err := checkApplication(ctx, db, applicationID); err != nil {
+            utils.HandleLookupError(w, err)
+            return
+        }
+        version, ok := utils.RequireIfMatch(w, r)
+        if !ok {
             return
         }
 
         var application models.Application
         if err := json.NewDecoder(r.Body).Decode(&application); err != nil {
-            http.Error(w, "Invalid input", http.StatusBadRequest)
+            utils.Error(w, http.StatusBadRequest, utils.CodeInvalidRequest, "Invalid input")
+            return
+        }
+        if errs := validation.ApplicationStatus(application.Status); len(errs) > 0 {
+            utils.WriteError(w, http.StatusBadRequest, errs.ToAPIError())
+            return
+        }
+        application.Status = validation.CanonicalStatus(application.Status)
+        if !checkApplicationParties(ctx, w, db, application) {
             return
         }
 
         // Begin transaction
-        tx, err := db.Begin()
+        tx, err := db.BeginTx(ctx, nil)
         if err != nil {
-            http.Error(w, "Failed to begin transaction", http.StatusInternalServerError)
+            utils.Error(w, http.StatusInternalServerError, utils.CodeInternal, "Failed to begin transaction")
             return
         }
         defer tx.Rollback()
 
-        // Update the application
-        _, err = tx.Exec(`UPDATE applications SET applicant_id=?, scheme_id=?, status=?, applied_date=? WHERE id=?`,
-            application.ApplicantID, application.SchemeID, application.Status, application.AppliedDate, applicationID)
+        before, err := loadApplication(ctx, tx, applicationID)
         if err != nil {
-            http.Error(w, "Failed to update application", http.StatusInternalServerError)
+            utils.Error(w, http.StatusInternalServerError, utils.CodeInternal, "Failed to retrieve application")
+            return
+        }
+
+        // Changing the status, or who an approved entitlement is paid to, is reserved for those who review applications
+        if needsReview(before, application) && !auth.Allowed(r.Context(), auth.PermApplicationsReview) {
+            middleware.Forbidden(w, r, auth.PermApplicationsReview)
+            return
+        }
+
+        // Update the application, provided nobody has changed it since the client read it
+        result, err := tx.ExecContext(ctx, `UPDATE applications SET applicant_id=?, scheme_id=?, status=?, applied_date=?, version=version+1 
+            WHERE id=? AND version=?`,
+            application.ApplicantID, application.SchemeID, application.Status, application.AppliedDate, applicationID, version)
+        if err != nil {
+            utils.Error(w, http.StatusInternalServerError, utils.CodeInternal, "Failed to update application")
+            return
+        }
+        if n, err := result.RowsAffected(); err != nil || n == 0 {
+            utils.Error(w, http.StatusPreconditionFailed, utils.CodePreconditionFailed, "Application has been modified since it was retrieved")
+            return
+        }
+
+        // Grant the entitlement of an approved application
+        if !settleEntitlements(w, r, tx, before) {
+            return
+        }
+
+        // Record the change
+        after, ok := recordApplicationUpdate(w, r, tx, before)
+        if !ok {
             return
         }
 
         // Commit the transaction
         if err = tx.Commit(); err != nil {
-            http.Error(w, "Failed to commit", http.StatusInternalServerError)
+            utils.Error(w, http.StatusInternalServerError, utils.CodeInternal, "Failed to commit")
             return
         }
 
+        countStatusTransition(before, after)
+        w.Header().Set("ETag", utils.VersionETag(version+1))
         w.WriteHeader(http.StatusNoContent)
     }
 }
 
-// DeleteApplication deletes an application from the database.
+// needsReview reports whether updating the application to after needs PermApplicationsReview: changing its status,
+// or changing the applicant or scheme of an approved application, which moves its entitlement and payments.
+func needsReview(before, after models.Application) bool {
+    if after.Status != before.Status {
+        return true
+    }
+    return before.Status == models.StatusApproved &&
+        (after.ApplicantID != before.ApplicantID || after.SchemeID != before.SchemeID)
+}
+
+// applicationPatch holds the fields of an application that a PATCH request may change.
+type applicationPatch struct {
+    Status      *string `json:"status"`
+    AppliedDate *string `json:"applied_date"`
+}
+
+// PatchApplication updates only the fields present in the request body, such as the status when an application is reviewed.
+func PatchApplication(db *sql.DB) http.HandlerFunc {
+    return func(w http.ResponseWriter, r *http.Request) {
+        ctx := r.Context()
+        // Validate the application
+        vars := mux.Vars(r)
+        applicationID := vars["id"]
+        if err := checkApplication(ctx, db, applicationID); err != nil {
+            utils.HandleLookupError(w, err)
+            return
+        }
+        version, ok := utils.RequireIfMatch(w, r)
+        if !ok {
+            return
+        }
+
+        var patch applicationPatch
+        if err := json.NewDecoder(r.Body).Decode(&patch); err != nil {
+            utils.Error(w, http.StatusBadRequest, utils.CodeInvalidRequest, "Invalid input")
+            return
+        }
+        if patch.Status != nil {
+            if errs := validation.ApplicationStatus(*patch.Status); len(errs) > 0 {
+                utils.WriteError(w, http.StatusBadRequest, errs.ToAPIError())
+                return
+            }
+            *patch.Status = validation.CanonicalStatus(*patch.Status)
+        }
+
+        // Begin transaction
+        tx, err := db.BeginTx(ctx, nil)
+        if err != nil {
+            utils.Error(w, http.StatusInternalServerError, utils.CodeInternal, "Failed to begin transaction")
+            return
+        }
+        defer tx.Rollback()
+
+        before, err := loadApplication(ctx, tx, applicationID)
+        if err != nil {
+            utils.Error(w, http.StatusInternalServerError, utils.CodeInternal, "Failed to retrieve application")
+            return
+        }
+
+        // Update the supplied fields, provided nobody has changed the application since the client read it
+        result, err := tx.ExecContext(ctx, `UPDATE applications SET status=COALESCE(?, status), applied_date=COALESCE(?, applied_date), version=version+1 
+            WHERE id=? AND version=?`,
+            patch.Status, patch.AppliedDate, applicationID, version)
+        if err != nil {
+            utils.Error(w, http.StatusInternalServerError, utils.CodeInternal, "Failed to update application")
+            return
+        }
+        if n, err := result.RowsAffected(); err != nil || n == 0 {
+            utils.Error(w, http.StatusPreconditionFailed, utils.CodePreconditionFailed, "Application has been modified since it was retrieved")
+            return
+        }
+
+        // Grant the entitlement of an approved application
+        if !settleEntitlements(w, r, tx, before) {
+            return
+        }
+
+        // Record the change
+        after, ok := recordApplicationUpdate(w, r, tx, before)
+        if !ok {
+            return
+        }
+
+        // Commit the transaction
+        if err = tx.Commit(); err != nil {
+            utils.Error(w, http.StatusInternalServerError, utils.CodeInternal, "Failed to commit")
+            return
+        }
+
+        countStatusTransition(before, after)
+        w.Header().Set("ETag", utils.VersionETag(version+1))
+        w.WriteHeader(http.StatusNoContent)
+    }
+}
+
+// recordApplicationUpdate records an updated application in the audit log, returning the application as updated.
+// It writes the error response if it fails.
+func recordApplicationUpdate(w http.ResponseWriter, r *http.Request, tx *sql.Tx, before models.Application) (models.Application, bool) {
+    ctx := r.Context()
+    after, err := loadApplication(ctx, tx, before.ID)
+    if err != nil {
+        utils.Error(w, http.StatusInternalServerError, utils.CodeInternal, "Failed to retrieve application")
+        return models.Application{}, false
+    }
+    err = audit.Record(r.Context(), tx, audit.Entry{Action: audit.ActionUpdate, EntityType: "application", EntityID: before.ID, Before: before, After: after})
+    if err != nil {
+        utils.Error(w, http.StatusInternalServerError, utils.CodeInternal, "Failed to record audit log")
+        return models.Application{}, false
+    }
+    return after, true
+}
+
+// countStatusTransition counts a committed change to the status of an application.
+func countStatusTransition(before, after models.Application) {
+    if before.Status != after.Status {
+        metrics.StatusTransitions.Inc(after.SchemeID, before.Status, after.Status)
+    }
+}
+
+// DeleteApplication marks an application as deleted. It can be restored until it is purged.
 func DeleteApplication(db *sql.DB) http.HandlerFunc {
     return func(w http.ResponseWriter, r *http.Request) {
+        ctx := r.Context()
         // Validate the application
         vars := mux.Vars(r)
         applicationID := vars["id"]
-        if err := checkApplication(db, applicationID); err != nil {
-            http.Error(w, err.Error(), http.StatusBadRequest)
+        if err := checkApplication(ctx, db, applicationID); err != nil {
+            utils.HandleLookupError(w, err)
+            return
+        }
+        version, ok := utils.RequireIfMatch(w, r)
+        if !ok {
             return
         }
 
         // Begin transaction
-        tx, err := db.Begin()
+        tx, err := db.BeginTx(ctx, nil)
         if err != nil {
-            http.Error(w, "Failed to begin transaction", http.StatusInternalServerError)
+            utils.Error(w, http.StatusInternalServerError, utils.CodeInternal, "Failed to begin transaction")
             return
         }
         defer tx.Rollback()
 
-        // Delete the application
-        _, err = tx.Exec(`DELETE FROM applications WHERE id=?`, applicationID)
+        before, err := loadApplication(ctx, tx, applicationID)
+        if err != nil {
+            utils.Error(w, http.StatusInternalServerError, utils.CodeInternal, "Failed to retrieve application")
+            return
+        }
+
+        // Delete the application, provided nobody has changed it since the client read it
+        result, err := tx.ExecContext(ctx, `UPDATE applications SET deleted_at=?, version=version+1 WHERE id=? AND version=? AND deleted_at IS NULL`,
+            time.Now().UTC(), applicationID, version)
+        if err != nil {
+            utils.Error(w, http.StatusInternalServerError, utils.CodeInternal, "Failed to delete application")
+            return
+        }
+        if n, err := result.RowsAffected(); err != nil || n == 0 {
+            utils.Error(w, http.StatusPreconditionFailed, utils.CodePreconditionFailed, "Application has been modified since it was retrieved")
+            return
+        }
+
+        // Record the change
+        after, err := loadApplication(ctx, tx, applicationID)
+        if err != nil {
+            utils.Error(w, http.StatusInternalServerError, utils.CodeInternal, "Failed to retrieve application")
+            return
+        }
+        err = audit.Record(r.Context(), tx, audit.Entry{Action: audit.ActionDelete, EntityType: "application", EntityID: applicationID, Before: before, After: after})
         if err != nil {
-            http.Error(w, "Failed to delete application", http.StatusInternalServerError)
+            utils.Error(w, http.StatusInternalServerError, utils.CodeInternal, "Failed to record audit log")
             return
         }
 
         // Commit the transaction
         if err = tx.Commit(); err != nil {
-            http.Error(w, "Failed to commit", http.StatusInternalServerError)
+            utils.Error(w, http.StatusInternalServerError, utils.CodeInternal, "Failed to commit")
             return
         }
 
@@ -182,8 +482,8 @@ func DeleteApplication(db *sql.DB) http.HandlerFunc {
     }
 }
 
-// checkApplication validates the UUID and checks if an application exists in the database.
-func checkApplication(db *sql.DB, applicationID string) error {
+// checkApplication validates the UUID and checks if an application exists in the database and has not been deleted.
+func checkApplication(ctx context.Context, db *sql.DB, applicationID string) error {
     // Validate the UUID for security
     if err := utils.ValidateUUID(applicationID); err != nil {
         return fmt.Errorf("invalid UUID: %w", err)
@@ -191,12 +491,12 @@ func checkApplication(db *sql.DB, applicationID string) error {
 
     // Check if the application exists
     var exists bool
-    err := db.QueryRow("SELECT EXISTS(SELECT 1 FROM applications WHERE id = ?)", applicationID).Scan(&exists)
+    err := db.QueryRowContext(ctx, "SELECT EXISTS(SELECT 1 FROM applications WHERE id = ? AND deleted_at IS NULL)", applicationID).Scan(&exists)
     if err != nil {
         return fmt.Errorf("error checking application existence: %w", err)
     }
     if !exists {
-        return fmt.Errorf("application not found")
+        return fmt.Errorf("application %w", utils.ErrNotFound)
     }
 
     return nil
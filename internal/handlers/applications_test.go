@@ -0,0 +1,122 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+
+	"fas/internal/auth"
+	"fas/internal/models"
+)
+
+// The update tests run UpdateApplication against a driver that holds one application, whose status is the DSN.
+// Every referenced entity exists, and no update matches, so a request that gets past authorization ends in 412.
+
+const applicationDriverName = "fas-fake-application"
+
+const (
+	testApplicationID = "11111111-1111-1111-1111-111111111111"
+	testApplicantID   = "22222222-2222-2222-2222-222222222222"
+	testSchemeID      = "33333333-3333-3333-3333-333333333333"
+	otherApplicantID  = "44444444-4444-4444-4444-444444444444"
+	otherSchemeID     = "55555555-5555-5555-5555-555555555555"
+)
+
+func init() {
+	sql.Register(applicationDriverName, applicationDriver{})
+}
+
+type applicationDriver struct{}
+
+func (applicationDriver) Open(status string) (driver.Conn, error) {
+	return applicationConn{status}, nil
+}
+
+type applicationConn struct{ status string }
+
+func (applicationConn) Prepare(string) (driver.Stmt, error) { return nil, errors.New("not supported") }
+func (applicationConn) Close() error                        { return nil }
+func (applicationConn) Begin() (driver.Tx, error)           { return applicationTx{}, nil }
+
+func (c applicationConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	switch {
+	case strings.Contains(query, "SELECT EXISTS"):
+		return &fakeRows{columns: 1, values: [][]driver.Value{{true}}}, nil
+	case strings.Contains(query, "FROM application_entitlements"):
+		return &fakeRows{columns: 10}, nil
+	case strings.Contains(query, "FROM applications"):
+		return &fakeRows{columns: 7, values: [][]driver.Value{
+			{testApplicationID, testApplicantID, testSchemeID, c.status, "2025-01-01", int64(1), nil},
+		}}, nil
+	}
+	return nil, fmt.Errorf("unexpected query: %s", query)
+}
+
+func (applicationConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	return driver.RowsAffected(0), nil
+}
+
+type applicationTx struct{}
+
+func (applicationTx) Commit() error   { return nil }
+func (applicationTx) Rollback() error { return nil }
+
+func TestUpdateApplicationReview(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   string // of the stored application
+		update   models.Application
+		role     string
+		wantCode int
+	}{
+		{"approved, applicant changed", models.StatusApproved,
+			models.Application{ApplicantID: otherApplicantID, SchemeID: testSchemeID, Status: models.StatusApproved},
+			auth.RoleCaseworker, http.StatusForbidden},
+		{"approved, scheme changed", models.StatusApproved,
+			models.Application{ApplicantID: testApplicantID, SchemeID: otherSchemeID, Status: models.StatusApproved},
+			auth.RoleCaseworker, http.StatusForbidden},
+		{"approved, applicant changed by a reviewer", models.StatusApproved,
+			models.Application{ApplicantID: otherApplicantID, SchemeID: testSchemeID, Status: models.StatusApproved},
+			auth.RoleAdmin, http.StatusPreconditionFailed},
+		{"approved, date changed", models.StatusApproved,
+			models.Application{ApplicantID: testApplicantID, SchemeID: testSchemeID, Status: models.StatusApproved, AppliedDate: "2025-02-01"},
+			auth.RoleCaseworker, http.StatusPreconditionFailed},
+		{"pending, applicant changed", models.StatusPending,
+			models.Application{ApplicantID: otherApplicantID, SchemeID: testSchemeID, Status: models.StatusPending},
+			auth.RoleCaseworker, http.StatusPreconditionFailed},
+		{"pending, approved", models.StatusPending,
+			models.Application{ApplicantID: testApplicantID, SchemeID: testSchemeID, Status: models.StatusApproved},
+			auth.RoleCaseworker, http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, err := sql.Open(applicationDriverName, tt.status)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer db.Close()
+
+			body := fmt.Sprintf(`{"applicant_id":%q,"scheme_id":%q,"status":%q,"applied_date":%q}`,
+				tt.update.ApplicantID, tt.update.SchemeID, tt.update.Status, tt.update.AppliedDate)
+			req := httptest.NewRequest(http.MethodPut, "/applications/"+testApplicationID, strings.NewReader(body))
+			req.Header.Set("If-Match", `"1"`)
+			req = mux.SetURLVars(req, map[string]string{"id": testApplicationID})
+			req = req.WithContext(auth.WithPrincipal(req.Context(), auth.Principal{ID: "staff", Roles: []string{tt.role}}))
+
+			rec := httptest.NewRecorder()
+			UpdateApplication(db)(rec, req)
+			if rec.Code != tt.wantCode {
+				t.Errorf("status %d, want %d: %s", rec.Code, tt.wantCode, rec.Body)
+			}
+		})
+	}
+}
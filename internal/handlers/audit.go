@@ -0,0 +1,125 @@
+// Handles all the requests related to the audit log.
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"fas/internal/models"
+	"fas/internal/utils"
+)
+
+const (
+	defaultAuditLimit = 100
+	maxAuditLimit     = 1000
+)
+
+// GetAuditLog retrieves audit log entries, newest first. They can be filtered by
+// entity_type, entity_id, actor and a from/to time range, and paged with limit and offset.
+func GetAuditLog(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		params := r.URL.Query()
+		query := `SELECT id, actor, COALESCE(actor_name, ''), action, entity_type, entity_id, COALESCE(request_id, ''),
+			before_json, after_json, created_at FROM audit_log WHERE 1=1`
+		var args []interface{}
+
+		for _, filter := range []string{"entity_type", "entity_id", "actor"} {
+			if value := params.Get(filter); value != "" {
+				query += ` AND ` + filter + ` = ?`
+				args = append(args, value)
+			}
+		}
+
+		// The time range is inclusive of from and exclusive of to
+		for _, bound := range []struct{ param, op string }{{"from", ">="}, {"to", "<"}} {
+			value := params.Get(bound.param)
+			if value == "" {
+				continue
+			}
+			t, ok := parseAuditTime(value)
+			if !ok {
+				utils.WriteError(w, http.StatusBadRequest, utils.APIError{Code: utils.CodeInvalidValue, Field: bound.param,
+					Message: "Time must be in RFC 3339 or YYYY-MM-DD format"})
+				return
+			}
+			query += ` AND created_at ` + bound.op + ` ?`
+			args = append(args, t)
+		}
+
+		limit, ok := auditPaging(w, params.Get("limit"), "limit", defaultAuditLimit)
+		if !ok {
+			return
+		}
+		offset, ok := auditPaging(w, params.Get("offset"), "offset", 0)
+		if !ok {
+			return
+		}
+		if limit > maxAuditLimit {
+			limit = maxAuditLimit
+		}
+		query += ` ORDER BY created_at DESC LIMIT ? OFFSET ?`
+		args = append(args, limit, offset)
+
+		rows, err := db.QueryContext(ctx, query, args...)
+		if err != nil {
+			utils.Error(w, http.StatusInternalServerError, utils.CodeInternal, "Failed to retrieve audit log")
+			return
+		}
+		defer rows.Close()
+
+		entries := []models.AuditEntry{}
+		for rows.Next() {
+			var entry models.AuditEntry
+			var before, after []byte
+			err := rows.Scan(&entry.ID, &entry.Actor, &entry.ActorName, &entry.Action, &entry.EntityType, &entry.EntityID,
+				&entry.RequestID, &before, &after, &entry.CreatedAt)
+			if err != nil {
+				utils.Error(w, http.StatusInternalServerError, utils.CodeInternal, "Failed to scan audit log entry")
+				return
+			}
+			if before != nil {
+				entry.Before = json.RawMessage(before)
+			}
+			if after != nil {
+				entry.After = json.RawMessage(after)
+			}
+			entries = append(entries, entry)
+		}
+		if err := rows.Err(); err != nil {
+			utils.Error(w, http.StatusInternalServerError, utils.CodeInternal, "Failed to read audit log data")
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(entries)
+	}
+}
+
+// parseAuditTime parses an RFC 3339 timestamp or a date, which is taken to be midnight UTC.
+func parseAuditTime(value string) (time.Time, bool) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t.UTC(), true
+	}
+	if t, err := time.Parse("2006-01-02", value); err == nil {
+		return t, true
+	}
+	return time.Time{}, false
+}
+
+// auditPaging parses a non-negative paging parameter, writing the error response if it is invalid.
+func auditPaging(w http.ResponseWriter, value, param string, fallback int) (int, bool) {
+	if value == "" {
+		return fallback, true
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		utils.WriteError(w, http.StatusBadRequest, utils.APIError{Code: utils.CodeInvalidValue, Field: param,
+			Message: "Must be a non-negative integer"})
+		return 0, false
+	}
+	return n, true
+}
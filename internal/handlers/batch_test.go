@@ -0,0 +1,217 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// The benchmarks run the list handlers against a fake driver that answers every query with made-up rows
+// after a short delay standing in for a network round trip, and count how many queries each request makes.
+
+const (
+	benchRows      = 500
+	benchRelated   = 2
+	benchRoundTrip = 50 * time.Microsecond
+	fakeDriverName = "fas-fake"
+)
+
+var fakeQueries atomic.Int64
+
+func init() {
+	sql.Register(fakeDriverName, fakeDriver{})
+}
+
+type fakeDriver struct{}
+
+func (fakeDriver) Open(string) (driver.Conn, error) { return fakeConn{}, nil }
+
+type fakeConn struct{}
+
+func (fakeConn) Prepare(string) (driver.Stmt, error) { return nil, errors.New("not supported") }
+func (fakeConn) Close() error                        { return nil }
+func (fakeConn) Begin() (driver.Tx, error)           { return nil, errors.New("not supported") }
+
+// QueryContext returns benchRows parents for a list query, and benchRelated children for each parent ID in args.
+func (fakeConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	fakeQueries.Add(1)
+	time.Sleep(benchRoundTrip)
+
+	rows := &fakeRows{}
+	related := func(columns int, row func(parent string, i int) []driver.Value) {
+		for _, arg := range args {
+			for i := 0; i < benchRelated; i++ {
+				rows.values = append(rows.values, row(arg.Value.(string), i))
+			}
+		}
+		rows.columns = columns
+	}
+	switch {
+	case strings.Contains(query, "FROM applicants"):
+		rows.columns = 11
+		for i := 0; i < benchRows; i++ {
+			rows.values = append(rows.values, []driver.Value{fmt.Sprintf("applicant-%d", i), "Name", "employed", "single", "female", "1990-01-01", nil, nil, nil, int64(1), nil})
+		}
+	case strings.Contains(query, "FROM schemes"):
+		rows.columns = 4
+		for i := 0; i < benchRows; i++ {
+			rows.values = append(rows.values, []driver.Value{fmt.Sprintf("scheme-%d", i), "Scheme", int64(1), nil})
+		}
+	case strings.Contains(query, "FROM household"):
+		related(8, func(parent string, i int) []driver.Value {
+			return []driver.Value{fmt.Sprintf("%s-member-%d", parent, i), parent, "Name", "son", "male", "primary", "unemployed", "2015-01-01"}
+		})
+	case strings.Contains(query, "FROM criteria"):
+		related(5, func(parent string, i int) []driver.Value {
+			return []driver.Value{parent, fmt.Sprintf("criterion-%d", i), "individual", "employment_status", "unemployed"}
+		})
+	case strings.Contains(query, "FROM benefits"):
+		related(10, func(parent string, i int) []driver.Value {
+			return []driver.Value{parent, fmt.Sprintf("benefit-%d", i), "Benefit", []byte("100.00"), "", "SGD", "cash", "monthly", int64(12), false}
+		})
+	default:
+		return nil, fmt.Errorf("unexpected query: %s", query)
+	}
+	return rows, nil
+}
+
+type fakeRows struct {
+	columns int
+	values  [][]driver.Value
+}
+
+func (r *fakeRows) Columns() []string {
+	columns := make([]string, r.columns)
+	for i := range columns {
+		columns[i] = fmt.Sprintf("c%d", i)
+	}
+	return columns
+}
+
+func (r *fakeRows) Close() error { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.values) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.values[0])
+	r.values = r.values[1:]
+	return nil
+}
+
+func openFakeDB(b *testing.B) *sql.DB {
+	db, err := sql.Open(fakeDriverName, "")
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.Cleanup(func() { db.Close() })
+	return db
+}
+
+// benchmarkList runs fn b.N times and reports the queries it made per run.
+func benchmarkList(b *testing.B, fn func() error) {
+	fakeQueries.Store(0)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := fn(); err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.ReportMetric(float64(fakeQueries.Load())/float64(b.N), "queries/op")
+}
+
+func serve(handler http.HandlerFunc) error {
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if rec.Code != http.StatusOK {
+		return fmt.Errorf("status %d: %s", rec.Code, rec.Body)
+	}
+	return nil
+}
+
+func BenchmarkGetApplicants(b *testing.B) {
+	db := openFakeDB(b)
+	ctx := context.Background()
+
+	// per-applicant loads the household of each applicant separately, as the handler used to
+	b.Run("per-applicant", func(b *testing.B) {
+		benchmarkList(b, func() error {
+			ids, err := listIDs(ctx, db, "SELECT id FROM applicants")
+			if err != nil {
+				return err
+			}
+			for _, id := range ids {
+				if _, err := getHouseholdMembers(ctx, db, id); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	})
+	b.Run("batched", func(b *testing.B) {
+		handler := GetApplicants(db)
+		benchmarkList(b, func() error { return serve(handler) })
+	})
+}
+
+func BenchmarkGetSchemes(b *testing.B) {
+	db := openFakeDB(b)
+	ctx := context.Background()
+
+	// per-scheme loads the criteria and benefits of each scheme separately, as the handler used to
+	b.Run("per-scheme", func(b *testing.B) {
+		benchmarkList(b, func() error {
+			ids, err := listIDs(ctx, db, "SELECT id FROM schemes")
+			if err != nil {
+				return err
+			}
+			for _, id := range ids {
+				if _, err := getCriteriaForScheme(ctx, db, id); err != nil {
+					return err
+				}
+				if _, err := getBenefitsForScheme(ctx, db, id); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	})
+	b.Run("batched", func(b *testing.B) {
+		handler := GetSchemes(db)
+		benchmarkList(b, func() error { return serve(handler) })
+	})
+}
+
+// listIDs returns the first column of every row of a list query.
+func listIDs(ctx context.Context, db *sql.DB, query string) ([]string, error) {
+	rows, err := db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	columns, _ := rows.Columns()
+	var ids []string
+	for rows.Next() {
+		values := make([]interface{}, len(columns))
+		for i := range values {
+			values[i] = new(interface{})
+		}
+		var id string
+		values[0] = &id
+		if err := rows.Scan(values...); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
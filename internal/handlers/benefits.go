@@ -0,0 +1,362 @@
+// Handles all the requests related to the benefit catalogue.
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+
+	"fas/internal/audit"
+	"fas/internal/models"
+	"fas/internal/money"
+	"fas/internal/utils"
+	"fas/internal/validation"
+)
+
+// GetBenefits retrieves every benefit, whether it was added to the catalogue or inline with a scheme.
+// Only catalogue benefits are returned when catalogue=true.
+func GetBenefits(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		query := `SELECT id, name, amount, amount_formula, currency, benefit_type, frequency, duration, catalogue, version FROM benefits`
+		if r.URL.Query().Get("catalogue") == "true" {
+			query += ` WHERE catalogue = TRUE`
+		}
+		rows, err := db.QueryContext(ctx, query+` ORDER BY name, currency, amount`)
+		if err != nil {
+			utils.Error(w, http.StatusInternalServerError, utils.CodeInternal, "Failed to retrieve benefits")
+			return
+		}
+		defer rows.Close()
+
+		benefits := []models.Benefit{}
+		for rows.Next() {
+			var benefit models.Benefit
+			if err := rows.Scan(&benefit.ID, &benefit.Name, &benefit.Amount, &benefit.AmountFormula, &benefit.Currency, &benefit.Type, &benefit.Frequency,
+				&benefit.Duration, &benefit.Catalogue, &benefit.Version); err != nil {
+				utils.Error(w, http.StatusInternalServerError, utils.CodeInternal, "Failed to scan benefit")
+				return
+			}
+			benefit.Total = benefit.FixedTotal()
+			benefits = append(benefits, benefit)
+		}
+		if err := rows.Err(); err != nil {
+			utils.Error(w, http.StatusInternalServerError, utils.CodeInternal, "Failed to read benefit data")
+			return
+		}
+
+		utils.WriteConditionalJSON(w, r, "", benefits)
+	}
+}
+
+// GetBenefit retrieves a single benefit, tagged with its version.
+func GetBenefit(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		benefitID := mux.Vars(r)["id"]
+		if err := utils.ValidateUUID(benefitID); err != nil {
+			utils.HandleLookupError(w, err)
+			return
+		}
+
+		benefit, err := loadBenefit(ctx, db, benefitID)
+		if err == sql.ErrNoRows {
+			utils.Error(w, http.StatusNotFound, utils.CodeNotFound, "Benefit not found")
+			return
+		}
+		if err != nil {
+			utils.Error(w, http.StatusInternalServerError, utils.CodeInternal, "Failed to retrieve benefit")
+			return
+		}
+
+		utils.WriteConditionalJSON(w, r, utils.VersionETag(benefit.Version), benefit)
+	}
+}
+
+// GetBenefitSchemes retrieves the schemes that use a benefit.
+// Deleted schemes are only included when include_deleted=true.
+func GetBenefitSchemes(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		benefitID := mux.Vars(r)["id"]
+		if err := checkBenefit(ctx, db, benefitID); err != nil {
+			utils.HandleLookupError(w, err)
+			return
+		}
+
+		schemes, err := querySchemes(ctx, db, `SELECT id, name, version, deleted_at FROM schemes
+			WHERE id IN (SELECT scheme_id FROM scheme_benefits WHERE benefit_id = ?)`+notDeleted(r, " AND")+` ORDER BY name`, benefitID)
+		if err != nil {
+			utils.Error(w, http.StatusInternalServerError, utils.CodeInternal, "Failed to retrieve schemes")
+			return
+		}
+		if schemes == nil {
+			schemes = []models.Scheme{}
+		}
+
+		utils.WriteConditionalJSON(w, r, "", schemes)
+	}
+}
+
+// CreateBenefit adds a benefit to the catalogue, from which schemes can link it by ID.
+func CreateBenefit(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		var benefit models.Benefit
+		if err := json.NewDecoder(r.Body).Decode(&benefit); err != nil {
+			utils.Error(w, http.StatusBadRequest, utils.CodeInvalidRequest, "Invalid input")
+			return
+		}
+		setBenefitDefaults(&benefit)
+		if errs := validation.Benefit(benefit); len(errs) > 0 {
+			utils.WriteError(w, http.StatusBadRequest, errs.ToAPIError())
+			return
+		}
+
+		// Begin transaction
+		tx, err := db.BeginTx(ctx, nil)
+		if err != nil {
+			utils.Error(w, http.StatusInternalServerError, utils.CodeInternal, "Failed to begin transaction")
+			return
+		}
+		defer tx.Rollback()
+
+		// Insert the benefit
+		benefit.ID = uuid.New().String()
+		benefit.Catalogue = true
+		benefit.Version = 1
+		benefit.Total = benefit.FixedTotal()
+		_, err = tx.ExecContext(ctx, `INSERT INTO benefits (id, name, amount, amount_formula, currency, benefit_type, frequency, duration, catalogue, version)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, TRUE, 1)`,
+			benefit.ID, benefit.Name, benefit.Amount, benefit.AmountFormula, benefit.Currency, benefit.Type, benefit.Frequency, benefit.Duration)
+		if err != nil {
+			utils.HandleInsertError(w, err, "benefit")
+			return
+		}
+
+		// Record the change
+		err = audit.Record(ctx, tx, audit.Entry{Action: audit.ActionCreate, EntityType: "benefit", EntityID: benefit.ID, After: benefit})
+		if err != nil {
+			utils.Error(w, http.StatusInternalServerError, utils.CodeInternal, "Failed to record audit log")
+			return
+		}
+
+		// Commit the transaction
+		if err := tx.Commit(); err != nil {
+			utils.Error(w, http.StatusInternalServerError, utils.CodeInternal, "Failed to commit transaction")
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("ETag", utils.VersionETag(benefit.Version))
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(benefit)
+	}
+}
+
+// UpdateBenefit renames a benefit or changes its amount for every scheme that uses it.
+// A benefit first added inline with a scheme joins the catalogue, so it is kept when no scheme uses it.
+func UpdateBenefit(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		benefitID := mux.Vars(r)["id"]
+		if err := checkBenefit(ctx, db, benefitID); err != nil {
+			utils.HandleLookupError(w, err)
+			return
+		}
+		version, ok := utils.RequireIfMatch(w, r)
+		if !ok {
+			return
+		}
+
+		var benefit models.Benefit
+		if err := json.NewDecoder(r.Body).Decode(&benefit); err != nil {
+			utils.Error(w, http.StatusBadRequest, utils.CodeInvalidRequest, "Invalid input")
+			return
+		}
+		setBenefitDefaults(&benefit)
+		if errs := validation.Benefit(benefit); len(errs) > 0 {
+			utils.WriteError(w, http.StatusBadRequest, errs.ToAPIError())
+			return
+		}
+
+		// Begin transaction
+		tx, err := db.BeginTx(ctx, nil)
+		if err != nil {
+			utils.Error(w, http.StatusInternalServerError, utils.CodeInternal, "Failed to begin transaction")
+			return
+		}
+		defer tx.Rollback()
+
+		before, err := loadBenefit(ctx, tx, benefitID)
+		if err != nil {
+			utils.Error(w, http.StatusInternalServerError, utils.CodeInternal, "Failed to retrieve benefit")
+			return
+		}
+
+		// Update the benefit, provided nobody has changed it since the client read it
+		result, err := tx.ExecContext(ctx, `UPDATE benefits SET name=?, amount=?, amount_formula=?, currency=?, benefit_type=?, frequency=?, duration=?, catalogue=TRUE,
+			version=version+1 WHERE id=? AND version=?`,
+			benefit.Name, benefit.Amount, benefit.AmountFormula, benefit.Currency, benefit.Type, benefit.Frequency, benefit.Duration, benefitID, version)
+		if err != nil {
+			utils.HandleInsertError(w, err, "benefit")
+			return
+		}
+		if n, err := result.RowsAffected(); err != nil || n == 0 {
+			utils.Error(w, http.StatusPreconditionFailed, utils.CodePreconditionFailed, "Benefit has been modified since it was retrieved")
+			return
+		}
+
+		// The schemes using the benefit have changed too, so their cached copies and versions are no longer current
+		_, err = tx.ExecContext(ctx, `UPDATE schemes SET version=version+1 WHERE id IN (SELECT scheme_id FROM scheme_benefits WHERE benefit_id = ?)`, benefitID)
+		if err != nil {
+			utils.Error(w, http.StatusInternalServerError, utils.CodeInternal, "Failed to update schemes")
+			return
+		}
+
+		// Record the change
+		after, err := loadBenefit(ctx, tx, benefitID)
+		if err != nil {
+			utils.Error(w, http.StatusInternalServerError, utils.CodeInternal, "Failed to retrieve benefit")
+			return
+		}
+		err = audit.Record(ctx, tx, audit.Entry{Action: audit.ActionUpdate, EntityType: "benefit", EntityID: benefitID, Before: before, After: after})
+		if err != nil {
+			utils.Error(w, http.StatusInternalServerError, utils.CodeInternal, "Failed to record audit log")
+			return
+		}
+
+		// Commit the transaction
+		if err := tx.Commit(); err != nil {
+			utils.Error(w, http.StatusInternalServerError, utils.CodeInternal, "Failed to commit")
+			return
+		}
+
+		w.Header().Set("ETag", utils.VersionETag(after.Version))
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// DeleteBenefit removes a benefit from the catalogue. A benefit that any scheme uses, including a deleted one, is kept.
+func DeleteBenefit(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		benefitID := mux.Vars(r)["id"]
+		if err := checkBenefit(ctx, db, benefitID); err != nil {
+			utils.HandleLookupError(w, err)
+			return
+		}
+		version, ok := utils.RequireIfMatch(w, r)
+		if !ok {
+			return
+		}
+
+		// Begin transaction
+		tx, err := db.BeginTx(ctx, nil)
+		if err != nil {
+			utils.Error(w, http.StatusInternalServerError, utils.CodeInternal, "Failed to begin transaction")
+			return
+		}
+		defer tx.Rollback()
+
+		before, err := loadBenefit(ctx, tx, benefitID)
+		if err != nil {
+			utils.Error(w, http.StatusInternalServerError, utils.CodeInternal, "Failed to retrieve benefit")
+			return
+		}
+
+		// Refuse to delete a benefit that is still in use
+		var schemes int
+		err = tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM scheme_benefits WHERE benefit_id = ? FOR UPDATE`, benefitID).Scan(&schemes)
+		if err != nil {
+			utils.Error(w, http.StatusInternalServerError, utils.CodeInternal, "Failed to retrieve schemes")
+			return
+		}
+		if schemes > 0 {
+			utils.WriteError(w, http.StatusConflict, utils.APIError{
+				Code:    utils.CodeHasDependents,
+				Message: fmt.Sprintf("The benefit is used by %d schemes; remove it from them first", schemes),
+				Details: map[string]int{"schemes": schemes},
+			})
+			return
+		}
+
+		// Delete the benefit, provided nobody has changed it since the client read it
+		result, err := tx.ExecContext(ctx, `DELETE FROM benefits WHERE id=? AND version=?`, benefitID, version)
+		if err != nil {
+			utils.Error(w, http.StatusInternalServerError, utils.CodeInternal, "Failed to delete benefit")
+			return
+		}
+		if n, err := result.RowsAffected(); err != nil || n == 0 {
+			utils.Error(w, http.StatusPreconditionFailed, utils.CodePreconditionFailed, "Benefit has been modified since it was retrieved")
+			return
+		}
+
+		// Record the change
+		err = audit.Record(ctx, tx, audit.Entry{Action: audit.ActionDelete, EntityType: "benefit", EntityID: benefitID, Before: before})
+		if err != nil {
+			utils.Error(w, http.StatusInternalServerError, utils.CodeInternal, "Failed to record audit log")
+			return
+		}
+
+		// Commit the transaction
+		if err := tx.Commit(); err != nil {
+			utils.Error(w, http.StatusInternalServerError, utils.CodeInternal, "Failed to commit")
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// loadBenefit retrieves a benefit, returning sql.ErrNoRows if there is no such benefit.
+func loadBenefit(ctx context.Context, q queryer, benefitID string) (models.Benefit, error) {
+	var benefit models.Benefit
+	err := q.QueryRowContext(ctx, `SELECT id, name, amount, amount_formula, currency, benefit_type, frequency, duration, catalogue, version FROM benefits WHERE id = ?`, benefitID).
+		Scan(&benefit.ID, &benefit.Name, &benefit.Amount, &benefit.AmountFormula, &benefit.Currency, &benefit.Type, &benefit.Frequency, &benefit.Duration,
+			&benefit.Catalogue, &benefit.Version)
+	benefit.Total = benefit.FixedTotal()
+	return benefit, err
+}
+
+// setBenefitDefaults fills in the currency, type, frequency and duration of a benefit given without them.
+func setBenefitDefaults(benefit *models.Benefit) {
+	if benefit.Currency == "" {
+		benefit.Currency = money.DefaultCurrency
+	}
+	if benefit.Type == "" {
+		benefit.Type = models.DefaultBenefitType
+	}
+	if benefit.Frequency == "" {
+		benefit.Frequency = models.FrequencyOneOff
+	}
+	benefit.Frequency = utils.Canonical(models.Frequencies, benefit.Frequency)
+	if benefit.Frequency == models.FrequencyOneOff {
+		benefit.Duration = 1
+	}
+}
+
+// checkBenefit validates the UUID and checks if a benefit exists.
+func checkBenefit(ctx context.Context, db *sql.DB, benefitID string) error {
+	// Validate the UUID for security
+	if err := utils.ValidateUUID(benefitID); err != nil {
+		return fmt.Errorf("invalid UUID: %w", err)
+	}
+
+	// Check if the benefit exists
+	var exists bool
+	err := db.QueryRowContext(ctx, "SELECT EXISTS(SELECT 1 FROM benefits WHERE id = ?)", benefitID).Scan(&exists)
+	if err != nil {
+		return fmt.Errorf("error checking benefit existence: %w", err)
+	}
+	if !exists {
+		return fmt.Errorf("benefit %w", utils.ErrNotFound)
+	}
+
+	return nil
+}
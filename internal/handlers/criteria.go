@@ -0,0 +1,233 @@
+// Handles all the requests related to criteria.
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"fas/internal/audit"
+	"fas/internal/models"
+	"fas/internal/utils"
+	"fas/internal/validation"
+)
+
+// GetCriteriaTypes returns each criteria type with the levels it may be used at and the statuses it accepts.
+func GetCriteriaTypes() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		utils.WriteConditionalJSON(w, r, "", validation.CriteriaRules())
+	}
+}
+
+// GetCriteria retrieves the criteria used by schemes. They can be filtered by criteria_level, criteria_type and status.
+func GetCriteria(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		query := `SELECT id, criteria_level, criteria_type, status FROM criteria WHERE 1=1`
+		var args []interface{}
+		for _, filter := range []string{"criteria_level", "criteria_type", "status"} {
+			if value := r.URL.Query().Get(filter); value != "" {
+				query += ` AND ` + filter + ` = ?`
+				args = append(args, value)
+			}
+		}
+
+		rows, err := db.QueryContext(ctx, query+` ORDER BY criteria_type, criteria_level, status`, args...)
+		if err != nil {
+			utils.Error(w, http.StatusInternalServerError, utils.CodeInternal, "Failed to retrieve criteria")
+			return
+		}
+		defer rows.Close()
+
+		criteria := []models.Criteria{}
+		for rows.Next() {
+			var criterion models.Criteria
+			if err := rows.Scan(&criterion.ID, &criterion.CriteriaLevel, &criterion.CriteriaType, &criterion.Status); err != nil {
+				utils.Error(w, http.StatusInternalServerError, utils.CodeInternal, "Failed to scan criteria")
+				return
+			}
+			criteria = append(criteria, criterion)
+		}
+		if err := rows.Err(); err != nil {
+			utils.Error(w, http.StatusInternalServerError, utils.CodeInternal, "Failed to read criteria data")
+			return
+		}
+
+		utils.WriteConditionalJSON(w, r, "", criteria)
+	}
+}
+
+// GetCriterion retrieves a single criteria.
+func GetCriterion(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		criteriaID := mux.Vars(r)["id"]
+		if err := utils.ValidateUUID(criteriaID); err != nil {
+			utils.HandleLookupError(w, err)
+			return
+		}
+
+		criterion, err := loadCriterion(ctx, db, criteriaID)
+		if err == sql.ErrNoRows {
+			utils.Error(w, http.StatusNotFound, utils.CodeNotFound, "Criteria not found")
+			return
+		}
+		if err != nil {
+			utils.Error(w, http.StatusInternalServerError, utils.CodeInternal, "Failed to retrieve criteria")
+			return
+		}
+
+		utils.WriteConditionalJSON(w, r, "", criterion)
+	}
+}
+
+// GetCriteriaSchemes retrieves the schemes that use a criteria.
+// Deleted schemes are only included when include_deleted=true.
+func GetCriteriaSchemes(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		criteriaID := mux.Vars(r)["id"]
+		if err := checkCriterion(ctx, db, criteriaID); err != nil {
+			utils.HandleLookupError(w, err)
+			return
+		}
+
+		schemes, err := querySchemes(ctx, db, `SELECT id, name, version, deleted_at FROM schemes
+			WHERE id IN (SELECT scheme_id FROM scheme_criteria WHERE criteria_id = ?)`+notDeleted(r, " AND")+` ORDER BY name`, criteriaID)
+		if err != nil {
+			utils.Error(w, http.StatusInternalServerError, utils.CodeInternal, "Failed to retrieve schemes")
+			return
+		}
+		if schemes == nil {
+			schemes = []models.Scheme{}
+		}
+
+		utils.WriteConditionalJSON(w, r, "", schemes)
+	}
+}
+
+// AttachCriteria adds an existing criteria to a scheme. Attaching a criteria the scheme already has changes nothing.
+func AttachCriteria(db *sql.DB) http.HandlerFunc { return changeSchemeCriteria(db, true) }
+
+// DetachCriteria removes a criteria from a scheme. A criteria no scheme uses any more is deleted.
+func DetachCriteria(db *sql.DB) http.HandlerFunc { return changeSchemeCriteria(db, false) }
+
+// changeSchemeCriteria attaches a criteria to a scheme or detaches it, as a change to the scheme's version.
+func changeSchemeCriteria(db *sql.DB, attach bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		vars := mux.Vars(r)
+		schemeID, criteriaID := vars["id"], vars["criteria_id"]
+		if err := checkScheme(ctx, db, schemeID); err != nil {
+			utils.HandleLookupError(w, err)
+			return
+		}
+		if err := checkCriterion(ctx, db, criteriaID); err != nil {
+			utils.HandleLookupError(w, err)
+			return
+		}
+		version, ok := utils.RequireIfMatch(w, r)
+		if !ok {
+			return
+		}
+
+		// Begin transaction
+		tx, err := db.BeginTx(ctx, nil)
+		if err != nil {
+			utils.Error(w, http.StatusInternalServerError, utils.CodeInternal, "Failed to begin transaction")
+			return
+		}
+		defer tx.Rollback()
+
+		before, err := loadScheme(ctx, tx, schemeID)
+		if err != nil {
+			utils.Error(w, http.StatusInternalServerError, utils.CodeInternal, "Failed to retrieve scheme")
+			return
+		}
+
+		// Update the scheme, provided nobody has changed it since the client read it
+		result, err := tx.ExecContext(ctx, `UPDATE schemes SET version=version+1 WHERE id=? AND version=? AND deleted_at IS NULL`, schemeID, version)
+		if err != nil {
+			utils.Error(w, http.StatusInternalServerError, utils.CodeInternal, "Failed to update scheme")
+			return
+		}
+		if n, err := result.RowsAffected(); err != nil || n == 0 {
+			utils.Error(w, http.StatusPreconditionFailed, utils.CodePreconditionFailed, "Scheme has been modified since it was retrieved")
+			return
+		}
+
+		if attach {
+			_, err = tx.ExecContext(ctx, `INSERT IGNORE INTO scheme_criteria (scheme_id, criteria_id) VALUES (?, ?)`, schemeID, criteriaID)
+			if err != nil {
+				utils.Error(w, http.StatusInternalServerError, utils.CodeInternal, "Failed to attach criteria")
+				return
+			}
+		} else {
+			result, err := tx.ExecContext(ctx, `DELETE FROM scheme_criteria WHERE scheme_id=? AND criteria_id=?`, schemeID, criteriaID)
+			if err != nil {
+				utils.Error(w, http.StatusInternalServerError, utils.CodeInternal, "Failed to detach criteria")
+				return
+			}
+			if n, err := result.RowsAffected(); err != nil || n == 0 {
+				utils.Error(w, http.StatusNotFound, utils.CodeNotFound, "The scheme does not use this criteria")
+				return
+			}
+			if err := deleteOrphanedCriteria(ctx, tx); err != nil {
+				utils.Error(w, http.StatusInternalServerError, utils.CodeInternal, "Failed to delete unused criteria")
+				return
+			}
+		}
+
+		// Record the change
+		after, err := loadScheme(ctx, tx, schemeID)
+		if err != nil {
+			utils.Error(w, http.StatusInternalServerError, utils.CodeInternal, "Failed to retrieve scheme")
+			return
+		}
+		err = audit.Record(ctx, tx, audit.Entry{Action: audit.ActionUpdate, EntityType: "scheme", EntityID: schemeID, Before: before, After: after})
+		if err != nil {
+			utils.Error(w, http.StatusInternalServerError, utils.CodeInternal, "Failed to record audit log")
+			return
+		}
+
+		// Commit the transaction
+		if err := tx.Commit(); err != nil {
+			utils.Error(w, http.StatusInternalServerError, utils.CodeInternal, "Failed to commit")
+			return
+		}
+
+		w.Header().Set("ETag", utils.VersionETag(after.Version))
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// loadCriterion retrieves a criteria, returning sql.ErrNoRows if there is no such criteria.
+func loadCriterion(ctx context.Context, q queryer, criteriaID string) (models.Criteria, error) {
+	var criterion models.Criteria
+	err := q.QueryRowContext(ctx, `SELECT id, criteria_level, criteria_type, status FROM criteria WHERE id = ?`, criteriaID).
+		Scan(&criterion.ID, &criterion.CriteriaLevel, &criterion.CriteriaType, &criterion.Status)
+	return criterion, err
+}
+
+// checkCriterion validates the UUID and checks if a criteria exists.
+func checkCriterion(ctx context.Context, db *sql.DB, criteriaID string) error {
+	// Validate the UUID for security
+	if err := utils.ValidateUUID(criteriaID); err != nil {
+		return fmt.Errorf("invalid UUID: %w", err)
+	}
+
+	// Check if the criteria exists
+	var exists bool
+	err := db.QueryRowContext(ctx, "SELECT EXISTS(SELECT 1 FROM criteria WHERE id = ?)", criteriaID).Scan(&exists)
+	if err != nil {
+		return fmt.Errorf("error checking criteria existence: %w", err)
+	}
+	if !exists {
+		return fmt.Errorf("criteria %w", utils.ErrNotFound)
+	}
+
+	return nil
+}
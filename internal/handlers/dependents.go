@@ -0,0 +1,196 @@
+// Handles the applications that depend on applicants and schemes when those are deleted.
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"fas/internal/audit"
+	"fas/internal/models"
+	"fas/internal/utils"
+)
+
+// dependents summarises the applications that depend on an applicant or scheme, and when purging,
+// the entitlements and disbursements of the payment ledger that are kept with them.
+type dependents struct {
+	Applications          int            `json:"applications"`
+	ApplicationsByStatus  map[string]int `json:"applications_by_status"`
+	Entitlements          int            `json:"entitlements,omitempty"`
+	Disbursements         int            `json:"disbursements,omitempty"`
+	DisbursementsByStatus map[string]int `json:"disbursements_by_status,omitempty"`
+}
+
+// removal lists the IDs of the entries removed by a cascading delete, keyed by entity.
+type removal map[string][]string
+
+// cascadeRequested reports whether the caller asked for dependents to be deleted as well.
+func cascadeRequested(r *http.Request) bool {
+	return r.URL.Query().Get("cascade") == "true"
+}
+
+// dependentApplications locks and retrieves the applications whose column (applicant_id or scheme_id)
+// refers to the given ID. Deleted applications are only included when includeDeleted is set.
+func dependentApplications(ctx context.Context, tx *sql.Tx, column, id string, includeDeleted bool) ([]models.Application, error) {
+	query := fmt.Sprintf(`SELECT id, applicant_id, scheme_id, status, applied_date, version, deleted_at
+		FROM applications WHERE %s = ?`, column)
+	if !includeDeleted {
+		query += ` AND deleted_at IS NULL`
+	}
+	rows, err := tx.QueryContext(ctx, query+` ORDER BY id FOR UPDATE`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var applications []models.Application
+	for rows.Next() {
+		var application models.Application
+		err := rows.Scan(&application.ID, &application.ApplicantID, &application.SchemeID, &application.Status,
+			&application.AppliedDate, &application.Version, &application.DeletedAt)
+		if err != nil {
+			return nil, err
+		}
+		applications = append(applications, application)
+	}
+	return applications, rows.Err()
+}
+
+// refuseDependents writes a 409 response summarising the applications that prevent a delete,
+// unless there are none or the caller asked to cascade. It reports whether the delete may go ahead.
+func refuseDependents(w http.ResponseWriter, r *http.Request, entity string, applications []models.Application) bool {
+	if len(applications) == 0 || cascadeRequested(r) {
+		return true
+	}
+
+	summary := summarise(applications)
+	utils.WriteError(w, http.StatusConflict, utils.APIError{
+		Code: utils.CodeHasDependents,
+		Message: fmt.Sprintf("The %s has %d applications (%s); pass cascade=true to delete them as well",
+			entity, summary.Applications, countsByStatus(summary.ApplicationsByStatus)),
+		Details: summary,
+	})
+	return false
+}
+
+// refuseLedger writes a 409 response summarising the payment ledger that prevents a purge, unless there is none,
+// as entitlements and disbursements are never removed, even with cascade=true. It reports whether the purge may go ahead.
+// The applications are those whose column (id, applicant_id or scheme_id) refers to the purged row.
+func refuseLedger(ctx context.Context, w http.ResponseWriter, tx *sql.Tx, entity, column, id string, applications []models.Application) bool {
+	summary := summarise(applications)
+	err := tx.QueryRowContext(ctx, fmt.Sprintf(`SELECT COUNT(*) FROM application_entitlements
+		WHERE application_id IN (SELECT id FROM applications WHERE %s = ?)`, column), id).Scan(&summary.Entitlements)
+	if err != nil {
+		utils.Error(w, http.StatusInternalServerError, utils.CodeInternal, "Failed to retrieve entitlements")
+		return false
+	}
+	rows, err := tx.QueryContext(ctx, fmt.Sprintf(`SELECT status, COUNT(*) FROM disbursements
+		WHERE application_id IN (SELECT id FROM applications WHERE %s = ?) GROUP BY status`, column), id)
+	if err != nil {
+		utils.Error(w, http.StatusInternalServerError, utils.CodeInternal, "Failed to retrieve disbursements")
+		return false
+	}
+	defer rows.Close()
+	summary.DisbursementsByStatus = make(map[string]int)
+	for rows.Next() {
+		var status string
+		var count int
+		if err := rows.Scan(&status, &count); err != nil {
+			utils.Error(w, http.StatusInternalServerError, utils.CodeInternal, "Failed to retrieve disbursements")
+			return false
+		}
+		summary.Disbursements += count
+		summary.DisbursementsByStatus[status] = count
+	}
+	if err := rows.Err(); err != nil {
+		utils.Error(w, http.StatusInternalServerError, utils.CodeInternal, "Failed to retrieve disbursements")
+		return false
+	}
+
+	if summary.Entitlements == 0 && summary.Disbursements == 0 {
+		return true
+	}
+	message := fmt.Sprintf("The %s has %d entitlements and %d disbursements", entity, summary.Entitlements, summary.Disbursements)
+	if summary.Disbursements > 0 {
+		message += " (" + countsByStatus(summary.DisbursementsByStatus) + ")"
+	}
+	utils.WriteError(w, http.StatusConflict, utils.APIError{
+		Code:    utils.CodeHasDependents,
+		Message: message + ", which are kept in the payment ledger, so it cannot be purged",
+		Details: summary,
+	})
+	return false
+}
+
+// summarise counts the applications by status.
+func summarise(applications []models.Application) dependents {
+	summary := dependents{Applications: len(applications), ApplicationsByStatus: make(map[string]int)}
+	for _, application := range applications {
+		summary.ApplicationsByStatus[application.Status]++
+	}
+	return summary
+}
+
+// countsByStatus lists counts as "2 Approved, 1 Pending", in order of status.
+func countsByStatus(counts map[string]int) string {
+	statuses := make([]string, 0, len(counts))
+	for status, count := range counts {
+		statuses = append(statuses, fmt.Sprintf("%d %s", count, status))
+	}
+	sort.Strings(statuses)
+	return strings.Join(statuses, ", ")
+}
+
+// cascadeDeleteApplications marks the applications as deleted, recording each in the audit log, and returns their IDs.
+func cascadeDeleteApplications(ctx context.Context, tx *sql.Tx, applications []models.Application) ([]string, error) {
+	ids := []string{}
+	now := time.Now().UTC()
+	for _, before := range applications {
+		_, err := tx.ExecContext(ctx, `UPDATE applications SET deleted_at=?, version=version+1 WHERE id=?`, now, before.ID)
+		if err != nil {
+			return nil, err
+		}
+		after, err := loadApplication(ctx, tx, before.ID)
+		if err != nil {
+			return nil, err
+		}
+		err = audit.Record(ctx, tx, audit.Entry{Action: audit.ActionDelete, EntityType: "application", EntityID: before.ID, Before: before, After: after})
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, before.ID)
+	}
+	return ids, nil
+}
+
+// recordPurgedApplications records in the audit log the applications the database removes along with their applicant or scheme,
+// and returns their IDs.
+func recordPurgedApplications(ctx context.Context, tx *sql.Tx, applications []models.Application) ([]string, error) {
+	ids := []string{}
+	for _, before := range applications {
+		err := audit.Record(ctx, tx, audit.Entry{Action: audit.ActionPurge, EntityType: "application", EntityID: before.ID, Before: before})
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, before.ID)
+	}
+	return ids, nil
+}
+
+// writeRemoval reports what a cascading delete removed, or writes 204 No Content for a plain delete.
+func writeRemoval(w http.ResponseWriter, r *http.Request, removed removal) {
+	if !cascadeRequested(r) {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		Removed removal `json:"removed"`
+	}{removed})
+}
@@ -0,0 +1,380 @@
+// Handles the ledger of payments made to approved applicants.
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+
+	"fas/internal/audit"
+	"fas/internal/models"
+	"fas/internal/utils"
+	"fas/internal/validation"
+)
+
+// disbursementColumns are the columns scanned by scanDisbursement, in order.
+const disbursementColumns = `id, application_id, applicant_id, scheme_id, benefit_id, name, installment, amount, currency,
+	due_date, status, reference, paid_at, batch_id, version`
+
+// errNoSchedule reports a benefit frequency that payments cannot be scheduled for.
+var errNoSchedule = errors.New("no payment schedule")
+
+// disbursementTransitions lists the states each state of a disbursement may change to.
+var disbursementTransitions = map[string][]string{
+	models.DisbursementScheduled: {models.DisbursementPaid, models.DisbursementFailed, models.DisbursementCancelled},
+	models.DisbursementSubmitted: {models.DisbursementPaid, models.DisbursementFailed},
+	models.DisbursementFailed:    {models.DisbursementPaid, models.DisbursementScheduled, models.DisbursementCancelled},
+	models.DisbursementPaid:      {models.DisbursementReversed},
+}
+
+// scheduleDisbursements adds a scheduled payment to the ledger for each installment of the entitlements of an
+// approved application, the first falling due on the given day. Installments already paid, or submitted to the bank
+// for payment, are not scheduled again. A benefit whose frequency has no schedule is reported as a *benefitError;
+// the entitlements are in the order of the scheme's benefits.
+func scheduleDisbursements(ctx context.Context, tx *sql.Tx, application models.Application, entitlements []models.Entitlement, start time.Time) error {
+	made := make(map[string]bool)
+	rows, err := tx.QueryContext(ctx, `SELECT benefit_id, installment FROM disbursements WHERE application_id = ? AND status IN (?, ?)`,
+		application.ID, models.DisbursementPaid, models.DisbursementSubmitted)
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var benefitID string
+		var installment int
+		if err := rows.Scan(&benefitID, &installment); err != nil {
+			rows.Close()
+			return err
+		}
+		made[fmt.Sprintf("%s/%d", benefitID, installment)] = true
+	}
+	err = rows.Err()
+	rows.Close()
+	if err != nil {
+		return err
+	}
+
+	for index, e := range entitlements {
+		for i := 0; i < e.Payments; i++ {
+			if made[fmt.Sprintf("%s/%d", e.BenefitID, i+1)] {
+				continue
+			}
+			due, err := dueDate(e.Frequency, start, i)
+			if err != nil {
+				return &benefitError{index: index, field: "frequency", code: validation.CodeInvalidOption, err: err,
+					message: "Payments cannot be scheduled for this frequency"}
+			}
+			_, err = tx.ExecContext(ctx, `INSERT INTO disbursements (id, application_id, applicant_id, scheme_id, benefit_id, name,
+				installment, amount, currency, due_date, status, created_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+				uuid.New().String(), application.ID, application.ApplicantID, application.SchemeID, e.BenefitID, e.Name,
+				i+1, e.Amount, e.Currency, due.Format("2006-01-02"), models.DisbursementScheduled, time.Now().UTC())
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// cancelDisbursements cancels the payments of an application that are scheduled or failed, recording each in the
+// audit log. Like every payment, they stay in the ledger.
+func cancelDisbursements(ctx context.Context, tx *sql.Tx, applicationID string) error {
+	pending, err := queryDisbursements(ctx, tx, `SELECT `+disbursementColumns+` FROM disbursements
+		WHERE application_id = ? AND status IN (?, ?) ORDER BY id FOR UPDATE`,
+		applicationID, models.DisbursementScheduled, models.DisbursementFailed)
+	if err != nil {
+		return err
+	}
+
+	for _, before := range pending {
+		_, err := tx.ExecContext(ctx, `UPDATE disbursements SET status = ?, version = version + 1 WHERE id = ?`,
+			models.DisbursementCancelled, before.ID)
+		if err != nil {
+			return err
+		}
+		after := before
+		after.Status, after.Version = models.DisbursementCancelled, before.Version+1
+		err = audit.Record(ctx, tx, audit.Entry{Action: audit.ActionUpdate, EntityType: "disbursement", EntityID: before.ID, Before: before, After: after})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// dueDate returns the day the installment with the given index falls due, counting from the first on start.
+// Monthly and annual payments due on a day the month does not have fall due on its last day.
+func dueDate(frequency string, start time.Time, index int) (time.Time, error) {
+	switch frequency {
+	case models.FrequencyOneOff:
+		return start, nil
+	case models.FrequencyWeekly:
+		return start.AddDate(0, 0, 7*index), nil
+	case models.FrequencyMonthly:
+		return addMonths(start, index), nil
+	case models.FrequencyAnnually:
+		return addMonths(start, 12*index), nil
+	}
+	return time.Time{}, fmt.Errorf("frequency %s: %w", frequency, errNoSchedule)
+}
+
+// addMonths adds months to a day, keeping to the last day of a shorter month rather than overflowing into the next.
+func addMonths(t time.Time, months int) time.Time {
+	first := time.Date(t.Year(), t.Month()+time.Month(months), 1, 0, 0, 0, 0, t.Location())
+	last := first.AddDate(0, 1, -1).Day()
+	return first.AddDate(0, 0, min(t.Day(), last)-1)
+}
+
+// scanDisbursement reads a row of disbursementColumns.
+func scanDisbursement(row interface{ Scan(...interface{}) error }) (models.Disbursement, error) {
+	var d models.Disbursement
+	err := row.Scan(&d.ID, &d.ApplicationID, &d.ApplicantID, &d.SchemeID, &d.BenefitID, &d.Name, &d.Installment, &d.Amount,
+		&d.Currency, &d.DueDate, &d.Status, &d.Reference, &d.PaidAt, &d.BatchID, &d.Version)
+	return d, err
+}
+
+// queryDisbursements retrieves the disbursements a query selects with disbursementColumns.
+func queryDisbursements(ctx context.Context, q queryer, query string, args ...interface{}) ([]models.Disbursement, error) {
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	disbursements := []models.Disbursement{}
+	for rows.Next() {
+		d, err := scanDisbursement(rows)
+		if err != nil {
+			return nil, err
+		}
+		disbursements = append(disbursements, d)
+	}
+	return disbursements, rows.Err()
+}
+
+// GetApplicantDisbursements retrieves the payments of an applicant in the order they fall due.
+// They can be filtered by status.
+func GetApplicantDisbursements(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		applicantID := mux.Vars(r)["id"]
+		if err := checkApplicant(ctx, db, applicantID); err != nil {
+			utils.HandleLookupError(w, err)
+			return
+		}
+
+		query := `SELECT ` + disbursementColumns + ` FROM disbursements WHERE applicant_id = ?`
+		args := []interface{}{applicantID}
+		if status := r.URL.Query().Get("status"); status != "" {
+			query += ` AND status = ?`
+			args = append(args, status)
+		}
+
+		disbursements, err := queryDisbursements(ctx, db, query+` ORDER BY due_date, name, installment`, args...)
+		if err != nil {
+			utils.Error(w, http.StatusInternalServerError, utils.CodeInternal, "Failed to retrieve disbursements")
+			return
+		}
+
+		utils.WriteConditionalJSON(w, r, "", disbursements)
+	}
+}
+
+// GetDisbursement retrieves a single payment, tagged with its version.
+func GetDisbursement(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		disbursementID := mux.Vars(r)["id"]
+		if err := utils.ValidateUUID(disbursementID); err != nil {
+			utils.HandleLookupError(w, err)
+			return
+		}
+
+		disbursement, err := loadDisbursement(ctx, db, disbursementID)
+		if err == sql.ErrNoRows {
+			utils.Error(w, http.StatusNotFound, utils.CodeNotFound, "Disbursement not found")
+			return
+		}
+		if err != nil {
+			utils.Error(w, http.StatusInternalServerError, utils.CodeInternal, "Failed to retrieve disbursement")
+			return
+		}
+
+		utils.WriteConditionalJSON(w, r, utils.VersionETag(disbursement.Version), disbursement)
+	}
+}
+
+// disbursementPatch holds the fields of a disbursement that a PATCH request may change.
+type disbursementPatch struct {
+	Status    string  `json:"status"`
+	Reference *string `json:"reference"`
+}
+
+// PatchDisbursement records what happened to a payment: that it was paid, failed, rescheduled after failing,
+// cancelled before being made, or reversed after being paid. Payments are only submitted to the bank through payment batches. A payment reference, such as the bank's, may be recorded with it.
+func PatchDisbursement(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		disbursementID := mux.Vars(r)["id"]
+		if err := checkDisbursement(ctx, db, disbursementID); err != nil {
+			utils.HandleLookupError(w, err)
+			return
+		}
+		version, ok := utils.RequireIfMatch(w, r)
+		if !ok {
+			return
+		}
+
+		var patch disbursementPatch
+		if err := json.NewDecoder(r.Body).Decode(&patch); err != nil {
+			utils.Error(w, http.StatusBadRequest, utils.CodeInvalidRequest, "Invalid input")
+			return
+		}
+		if !utils.IsValid(models.DisbursementStatuses, patch.Status) {
+			utils.WriteError(w, http.StatusBadRequest, utils.APIError{Code: utils.CodeInvalidValue, Field: "status",
+				Message: "Invalid status, " + utils.FormatValidOptions(models.DisbursementStatuses)})
+			return
+		}
+		// Store the status as spelled in the list, since the transitions are looked up by it
+		patch.Status = utils.Canonical(models.DisbursementStatuses, patch.Status)
+		if patch.Reference != nil && len(*patch.Reference) > 100 {
+			utils.WriteError(w, http.StatusBadRequest, utils.APIError{Code: utils.CodeDataTooLong, Field: "reference",
+				Message: "Reference must be at most 100 characters"})
+			return
+		}
+
+		// Begin transaction
+		tx, err := db.BeginTx(ctx, nil)
+		if err != nil {
+			utils.Error(w, http.StatusInternalServerError, utils.CodeInternal, "Failed to begin transaction")
+			return
+		}
+		defer tx.Rollback()
+
+		before, err := loadDisbursement(ctx, tx, disbursementID)
+		if err != nil {
+			utils.Error(w, http.StatusInternalServerError, utils.CodeInternal, "Failed to retrieve disbursement")
+			return
+		}
+		if !utils.IsValid(disbursementTransitions[before.Status], patch.Status) {
+			utils.Error(w, http.StatusConflict, utils.CodeInvalidState,
+				fmt.Sprintf("A %s disbursement cannot become %s", before.Status, patch.Status))
+			return
+		}
+
+		// Update the disbursement, provided nobody has changed it since the client read it. A failed payment
+		// scheduled again leaves the batch it failed in, so that a later batch can submit it.
+		result, err := tx.ExecContext(ctx, `UPDATE disbursements SET status=?, reference=COALESCE(?, reference),
+			paid_at=IF(? = 'paid', UTC_TIMESTAMP(), paid_at), batch_id=IF(? = 'scheduled', NULL, batch_id),
+			version=version+1 WHERE id=? AND version=?`,
+			patch.Status, patch.Reference, patch.Status, patch.Status, disbursementID, version)
+		if err != nil {
+			utils.Error(w, http.StatusInternalServerError, utils.CodeInternal, "Failed to update disbursement")
+			return
+		}
+		if n, err := result.RowsAffected(); err != nil || n == 0 {
+			utils.Error(w, http.StatusPreconditionFailed, utils.CodePreconditionFailed, "Disbursement has been modified since it was retrieved")
+			return
+		}
+
+		// Record the change
+		after, err := loadDisbursement(ctx, tx, disbursementID)
+		if err != nil {
+			utils.Error(w, http.StatusInternalServerError, utils.CodeInternal, "Failed to retrieve disbursement")
+			return
+		}
+		err = audit.Record(ctx, tx, audit.Entry{Action: audit.ActionUpdate, EntityType: "disbursement", EntityID: disbursementID, Before: before, After: after})
+		if err != nil {
+			utils.Error(w, http.StatusInternalServerError, utils.CodeInternal, "Failed to record audit log")
+			return
+		}
+
+		// Commit the transaction
+		if err := tx.Commit(); err != nil {
+			utils.Error(w, http.StatusInternalServerError, utils.CodeInternal, "Failed to commit")
+			return
+		}
+
+		w.Header().Set("ETag", utils.VersionETag(after.Version))
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// GetDisbursementTotals adds up the ledger by state and currency, per scheme or, with by=applicant, per applicant.
+func GetDisbursementTotals(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		by := r.URL.Query().Get("by")
+		if by == "" {
+			by = "scheme"
+		}
+		if by != "scheme" && by != "applicant" {
+			utils.WriteError(w, http.StatusBadRequest, utils.APIError{Code: utils.CodeInvalidValue, Field: "by",
+				Message: "Invalid value, " + utils.FormatValidOptions([]string{"scheme", "applicant"})})
+			return
+		}
+		column := by + "_id"
+
+		rows, err := db.QueryContext(ctx, `SELECT `+column+`, currency,
+			SUM(IF(status = 'scheduled', amount, 0)), SUM(IF(status = 'submitted', amount, 0)), SUM(IF(status = 'paid', amount, 0)),
+			SUM(IF(status = 'failed', amount, 0)), SUM(IF(status = 'reversed', amount, 0)), SUM(IF(status = 'cancelled', amount, 0))
+			FROM disbursements GROUP BY `+column+`, currency ORDER BY `+column+`, currency`)
+		if err != nil {
+			utils.Error(w, http.StatusInternalServerError, utils.CodeInternal, "Failed to retrieve totals")
+			return
+		}
+		defer rows.Close()
+
+		totals := []models.DisbursementTotal{}
+		for rows.Next() {
+			var total models.DisbursementTotal
+			key := &total.SchemeID
+			if by == "applicant" {
+				key = &total.ApplicantID
+			}
+			if err := rows.Scan(key, &total.Currency, &total.Scheduled, &total.Submitted, &total.Paid, &total.Failed, &total.Reversed,
+				&total.Cancelled); err != nil {
+				utils.Error(w, http.StatusInternalServerError, utils.CodeInternal, "Failed to scan totals")
+				return
+			}
+			totals = append(totals, total)
+		}
+		if err := rows.Err(); err != nil {
+			utils.Error(w, http.StatusInternalServerError, utils.CodeInternal, "Failed to read totals")
+			return
+		}
+
+		utils.WriteConditionalJSON(w, r, "", totals)
+	}
+}
+
+// loadDisbursement retrieves a disbursement, returning sql.ErrNoRows if there is no such disbursement.
+func loadDisbursement(ctx context.Context, q queryer, disbursementID string) (models.Disbursement, error) {
+	return scanDisbursement(q.QueryRowContext(ctx, `SELECT `+disbursementColumns+` FROM disbursements WHERE id = ?`, disbursementID))
+}
+
+// checkDisbursement validates the UUID and checks if a disbursement exists.
+func checkDisbursement(ctx context.Context, db *sql.DB, disbursementID string) error {
+	// Validate the UUID for security
+	if err := utils.ValidateUUID(disbursementID); err != nil {
+		return fmt.Errorf("invalid UUID: %w", err)
+	}
+
+	// Check if the disbursement exists
+	var exists bool
+	err := db.QueryRowContext(ctx, "SELECT EXISTS(SELECT 1 FROM disbursements WHERE id = ?)", disbursementID).Scan(&exists)
+	if err != nil {
+		return fmt.Errorf("error checking disbursement existence: %w", err)
+	}
+	if !exists {
+		return fmt.Errorf("disbursement %w", utils.ErrNotFound)
+	}
+
+	return nil
+}
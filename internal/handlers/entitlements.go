@@ -0,0 +1,286 @@
+// Computes what applicants are entitled to from the benefits of schemes, and explains their eligibility.
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"fas/internal/formula"
+	"fas/internal/logging"
+	"fas/internal/models"
+	"fas/internal/money"
+	"fas/internal/utils"
+	"fas/internal/validation"
+)
+
+// benefitError reports a benefit of a scheme that an applicant's entitlement cannot be computed or scheduled for.
+// It names the benefit's field by its position in the scheme, as validation does.
+type benefitError struct {
+	index   int
+	field   string
+	code    string
+	message string
+	err     error
+}
+
+func (e *benefitError) Error() string {
+	return fmt.Sprintf("benefits[%d].%s: %v", e.index, e.field, e.err)
+}
+
+func (e *benefitError) Unwrap() error {
+	return e.err
+}
+
+// formulaError describes a benefit whose amount formula cannot be evaluated for an applicant.
+func formulaError(index int, err error) *benefitError {
+	var fe *formula.Error
+	if errors.As(err, &fe) {
+		return &benefitError{index: index, field: "amount_formula", code: validation.CodeInvalidFormat, err: err,
+			message: fmt.Sprintf("Formula cannot be evaluated for the applicant's household at position %d", fe.Pos+1)}
+	}
+	return &benefitError{index: index, field: "amount_formula", code: validation.CodeOutOfRange, err: err,
+		message: "Formula gives an amount larger than " + money.Max.String() + " for the applicant's household"}
+}
+
+// writeBenefitError writes the 422 response for a benefitError, logging what went wrong, and reports whether it did.
+func writeBenefitError(w http.ResponseWriter, r *http.Request, err error, message string) bool {
+	var be *benefitError
+	if !errors.As(err, &be) {
+		return false
+	}
+	logging.FromContext(r.Context()).Warn(message, "error", err)
+	apiErr := validation.Errors{{Field: fmt.Sprintf("benefits[%d].%s", be.index, be.field), Code: be.code, Message: be.message}}.ToAPIError()
+	apiErr.Message = message
+	utils.WriteError(w, http.StatusUnprocessableEntity, apiErr)
+	return true
+}
+
+// computeEntitlements works out what each benefit pays an applicant, evaluating the amount formulas against
+// the applicant's household with ages taken on the given day. A formula giving less than zero pays nothing.
+// A benefit whose formula cannot be evaluated is reported as a *benefitError.
+func computeEntitlements(applicant models.Applicant, benefits []models.Benefit, on time.Time) ([]models.Entitlement, error) {
+	env := formula.Household(applicant, on)
+	entitlements := make([]models.Entitlement, 0, len(benefits))
+	for i, benefit := range benefits {
+		amount := benefit.Amount
+		if !benefit.Fixed() {
+			f, err := formula.Parse(benefit.AmountFormula)
+			if err != nil {
+				return nil, formulaError(i, err)
+			}
+			value, err := f.Eval(env)
+			if err != nil {
+				return nil, formulaError(i, err)
+			}
+			if amount, err = money.FromRat(value); err != nil || amount > money.Max {
+				return nil, formulaError(i, money.ErrOutOfRange)
+			}
+			if amount < 0 {
+				amount = 0
+			}
+		}
+
+		entitlements = append(entitlements, models.Entitlement{
+			BenefitID:     benefit.ID,
+			Name:          benefit.Name,
+			Type:          benefit.Type,
+			Amount:        amount,
+			AmountFormula: benefit.AmountFormula,
+			Currency:      benefit.Currency,
+			Frequency:     benefit.Frequency,
+			Payments:      benefit.Payments(),
+			Total:         benefit.Entitlement(amount),
+		})
+	}
+	return entitlements, nil
+}
+
+// settleEntitlements keeps the entitlement of an updated application in step with its status, writing the error
+// response if it fails. Approving an application, or changing the applicant or scheme of an approved one, computes
+// the entitlement from the applicant's household as it is now and schedules its payments from today; an application
+// that is no longer approved has none, and its payments not yet made are cancelled.
+func settleEntitlements(w http.ResponseWriter, r *http.Request, tx *sql.Tx, before models.Application) bool {
+	ctx := r.Context()
+	current, err := loadApplication(ctx, tx, before.ID)
+	if err != nil {
+		utils.Error(w, http.StatusInternalServerError, utils.CodeInternal, "Failed to retrieve application")
+		return false
+	}
+
+	approved := current.Status == models.StatusApproved
+	unchanged := before.Status == models.StatusApproved && before.ApplicantID == current.ApplicantID && before.SchemeID == current.SchemeID
+	if approved && unchanged || !approved && len(current.Entitlements) == 0 {
+		return true
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM application_entitlements WHERE application_id = ?`, current.ID)
+	if err != nil {
+		utils.Error(w, http.StatusInternalServerError, utils.CodeInternal, "Failed to update entitlement")
+		return false
+	}
+	if err := cancelDisbursements(ctx, tx, current.ID); err != nil {
+		utils.Error(w, http.StatusInternalServerError, utils.CodeInternal, "Failed to cancel disbursements")
+		return false
+	}
+	if !approved {
+		return true
+	}
+
+	applicant, err := loadApplicant(ctx, tx, current.ApplicantID)
+	if err != nil {
+		utils.Error(w, http.StatusInternalServerError, utils.CodeInternal, "Failed to retrieve applicant")
+		return false
+	}
+	benefits, err := getBenefitsForScheme(ctx, tx, current.SchemeID)
+	if err != nil {
+		utils.Error(w, http.StatusInternalServerError, utils.CodeInternal, "Failed to retrieve benefits")
+		return false
+	}
+	now := time.Now()
+	entitlements, err := computeEntitlements(applicant, benefits, now)
+	if writeBenefitError(w, r, err, "The entitlement could not be computed") {
+		return false
+	}
+	if err != nil {
+		utils.Error(w, http.StatusInternalServerError, utils.CodeInternal, "Failed to compute entitlement")
+		return false
+	}
+
+	for _, e := range entitlements {
+		_, err = tx.ExecContext(ctx, `INSERT INTO application_entitlements
+			(application_id, benefit_id, name, benefit_type, amount, amount_formula, currency, frequency, payments, total)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			current.ID, e.BenefitID, e.Name, e.Type, e.Amount, e.AmountFormula, e.Currency, e.Frequency, e.Payments, e.Total)
+		if err != nil {
+			utils.Error(w, http.StatusInternalServerError, utils.CodeInternal, "Failed to record entitlement")
+			return false
+		}
+	}
+
+	err = scheduleDisbursements(ctx, tx, current, entitlements, now)
+	if writeBenefitError(w, r, err, "The payments could not be scheduled") {
+		return false
+	}
+	if err != nil {
+		utils.Error(w, http.StatusInternalServerError, utils.CodeInternal, "Failed to schedule disbursements")
+		return false
+	}
+	return true
+}
+
+// getEntitlementsByApplication retrieves the entitlements of many applications in one query, keyed by application ID.
+func getEntitlementsByApplication(ctx context.Context, q queryer, applicationIDs []string) (map[string][]models.Entitlement, error) {
+	entitlements := make(map[string][]models.Entitlement)
+	err := queryIn(ctx, q, `SELECT application_id, benefit_id, name, benefit_type, amount, amount_formula, currency, frequency, payments, total
+		FROM application_entitlements WHERE application_id IN (%s) ORDER BY name`, applicationIDs,
+		func(rows *sql.Rows) error {
+			var applicationID string
+			var e models.Entitlement
+			if err := rows.Scan(&applicationID, &e.BenefitID, &e.Name, &e.Type, &e.Amount, &e.AmountFormula, &e.Currency,
+				&e.Frequency, &e.Payments, &e.Total); err != nil {
+				return err
+			}
+			entitlements[applicationID] = append(entitlements[applicationID], e)
+			return nil
+		})
+	return entitlements, err
+}
+
+// GetEligibility explains whether an applicant is eligible for a scheme, criteria by criteria,
+// and what the scheme's benefits would pay the applicant's household today.
+func GetEligibility(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		schemeID := mux.Vars(r)["id"]
+		if err := checkScheme(ctx, db, schemeID); err != nil {
+			utils.HandleLookupError(w, err)
+			return
+		}
+		applicantID := r.URL.Query().Get("applicant")
+		if err := checkApplicant(ctx, db, applicantID); err != nil {
+			utils.HandleLookupError(w, err)
+			return
+		}
+
+		scheme, err := loadScheme(ctx, db, schemeID)
+		if err != nil {
+			utils.Error(w, http.StatusInternalServerError, utils.CodeInternal, "Failed to retrieve scheme")
+			return
+		}
+		applicant, err := loadApplicant(ctx, db, applicantID)
+		if err != nil {
+			utils.Error(w, http.StatusInternalServerError, utils.CodeInternal, "Failed to retrieve applicant")
+			return
+		}
+
+		eligibility := models.Eligibility{SchemeID: schemeID, ApplicantID: applicantID, Eligible: true,
+			Criteria: []models.CriterionResult{}}
+		for _, criterion := range scheme.Criteria {
+			met, reason := criterionMet(applicant, criterion)
+			eligibility.Eligible = eligibility.Eligible && met
+			eligibility.Criteria = append(eligibility.Criteria, models.CriterionResult{Criteria: criterion, Met: met, Reason: reason})
+		}
+
+		eligibility.Entitlements, err = computeEntitlements(applicant, scheme.Benefits, time.Now())
+		if writeBenefitError(w, r, err, "The entitlement could not be computed") {
+			return
+		}
+		if err != nil {
+			utils.Error(w, http.StatusInternalServerError, utils.CodeInternal, "Failed to compute entitlement")
+			return
+		}
+		eligibility.TotalEntitlement = models.TotalEntitlements(eligibility.Entitlements)
+
+		utils.WriteConditionalJSON(w, r, "", eligibility)
+	}
+}
+
+// criterionMet reports whether an applicant meets a criteria, and why. It follows the same rules as the
+// query in fetchEligibleSchemes: an individual criteria concerns the applicant, while a household criteria
+// is met when any household member matches it. Values are compared without regard to case, as MySQL does.
+func criterionMet(applicant models.Applicant, criterion models.Criteria) (bool, string) {
+	is := func(level, criteriaType string) bool {
+		return strings.EqualFold(criterion.CriteriaLevel, level) && strings.EqualFold(criterion.CriteriaType, criteriaType)
+	}
+	switch {
+	case is("individual", "employment_status"):
+		return strings.EqualFold(applicant.EmploymentStatus, criterion.Status), "The applicant's employment status is " + applicant.EmploymentStatus
+
+	case is("individual", "marital_status"):
+		return strings.EqualFold(applicant.MaritalStatus, criterion.Status), "The applicant's marital status is " + applicant.MaritalStatus
+
+	case is("individual", "has_children"):
+		children := 0
+		for _, member := range applicant.Household {
+			if member.IsChild() {
+				children++
+			}
+		}
+		return (children > 0) == strings.EqualFold(criterion.Status, "true"), fmt.Sprintf("The applicant has %d children in the household", children)
+
+	case is("household", "school_level"):
+		for _, member := range applicant.Household {
+			if strings.EqualFold(member.SchoolLevel, criterion.Status) {
+				return true, "A household member's school level is " + criterion.Status
+			}
+		}
+		return false, "No household member's school level is " + criterion.Status
+
+	case is("household", "employment_status"):
+		for _, member := range applicant.Household {
+			if strings.EqualFold(member.EmploymentStatus, criterion.Status) {
+				return true, "A household member's employment status is " + criterion.Status
+			}
+		}
+		return false, "No household member's employment status is " + criterion.Status
+	}
+	return false, fmt.Sprintf("Criteria type %s is not supported at the %s level by the eligibility checks",
+		criterion.CriteriaType, criterion.CriteriaLevel)
+}
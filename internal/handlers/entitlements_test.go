@@ -0,0 +1,51 @@
+package handlers
+
+import (
+	"testing"
+
+	"fas/internal/models"
+)
+
+func TestCriterionMet(t *testing.T) {
+	// Values are stored as typed, so an applicant may differ in case from the criteria they meet
+	applicant := models.Applicant{
+		EmploymentStatus: "Unemployed",
+		MaritalStatus:    "married",
+		Household: []models.Household{
+			{Relationship: "Son", SchoolLevel: "Primary", EmploymentStatus: "unemployed"},
+			{Relationship: "Wife", EmploymentStatus: "EMPLOYED"},
+		},
+	}
+	childless := models.Applicant{EmploymentStatus: "employed", Household: []models.Household{{Relationship: "Mother"}}}
+
+	tests := []struct {
+		name      string
+		applicant models.Applicant
+		criterion models.Criteria
+		want      bool
+	}{
+		{"employment status", applicant, models.Criteria{CriteriaLevel: "individual", CriteriaType: "employment_status", Status: "unemployed"}, true},
+		{"employment status differs", childless, models.Criteria{CriteriaLevel: "individual", CriteriaType: "employment_status", Status: "unemployed"}, false},
+		{"marital status", applicant, models.Criteria{CriteriaLevel: "individual", CriteriaType: "marital_status", Status: "Married"}, true},
+		{"has children", applicant, models.Criteria{CriteriaLevel: "individual", CriteriaType: "has_children", Status: "true"}, true},
+		{"has children, in upper case", applicant, models.Criteria{CriteriaLevel: "Individual", CriteriaType: "has_children", Status: "TRUE"}, true},
+		{"has no children", applicant, models.Criteria{CriteriaLevel: "individual", CriteriaType: "has_children", Status: "false"}, false},
+		{"childless has no children", childless, models.Criteria{CriteriaLevel: "individual", CriteriaType: "has_children", Status: "false"}, true},
+		{"household school level", applicant, models.Criteria{CriteriaLevel: "household", CriteriaType: "school_level", Status: "primary"}, true},
+		{"household school level differs", applicant, models.Criteria{CriteriaLevel: "household", CriteriaType: "school_level", Status: "secondary"}, false},
+		{"household employment status", applicant, models.Criteria{CriteriaLevel: "household", CriteriaType: "employment_status", Status: "employed"}, true},
+		{"unsupported", applicant, models.Criteria{CriteriaLevel: "household", CriteriaType: "marital_status", Status: "married"}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, reason := criterionMet(tt.applicant, tt.criterion)
+			if got != tt.want {
+				t.Errorf("got %v (%s), want %v", got, reason, tt.want)
+			}
+			if reason == "" {
+				t.Error("no reason was given")
+			}
+		})
+	}
+}
@@ -0,0 +1,47 @@
+// Contains helpers shared by the handlers.
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// queryer runs queries either directly on the database or within a transaction.
+type queryer interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// maxInList limits how many IDs go into a single IN list.
+const maxInList = 1000
+
+// queryIn runs a query with an IN (%s) list for the IDs, in as few batches as the limit allows,
+// and calls scan for each row returned.
+func queryIn(ctx context.Context, q queryer, query string, ids []string, scan func(*sql.Rows) error) error {
+	for start := 0; start < len(ids); start += maxInList {
+		batch := ids[start:min(start+maxInList, len(ids))]
+		args := make([]interface{}, len(batch))
+		for i, id := range batch {
+			args[i] = id
+		}
+
+		rows, err := q.QueryContext(ctx, fmt.Sprintf(query, strings.TrimSuffix(strings.Repeat("?, ", len(batch)), ", ")), args...)
+		if err != nil {
+			return err
+		}
+		for rows.Next() {
+			if err := scan(rows); err != nil {
+				rows.Close()
+				return err
+			}
+		}
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,50 @@
+// Handles the health and readiness checks of the server.
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// readinessTimeout bounds how long the readiness check waits for the database.
+const readinessTimeout = 2 * time.Second
+
+// Healthz reports that the server is running. It does not check its dependencies.
+func Healthz() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeStatus(w, http.StatusOK, "ok", "")
+	}
+}
+
+// Readyz reports whether the server can serve requests: it is not shutting down and the database answers.
+func Readyz(db *sql.DB, shuttingDown *atomic.Bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if shuttingDown.Load() {
+			writeStatus(w, http.StatusServiceUnavailable, "unavailable", "server is shutting down")
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), readinessTimeout)
+		defer cancel()
+		if err := db.PingContext(ctx); err != nil {
+			writeStatus(w, http.StatusServiceUnavailable, "unavailable", "database is unreachable")
+			return
+		}
+		writeStatus(w, http.StatusOK, "ok", "")
+	}
+}
+
+// writeStatus writes the body of a health or readiness check.
+func writeStatus(w http.ResponseWriter, status int, state, reason string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(struct {
+		Status string `json:"status"`
+		Reason string `json:"reason,omitempty"`
+	}{state, reason})
+}
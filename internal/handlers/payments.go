@@ -0,0 +1,157 @@
+// Handles the batches in which due disbursements are submitted to the bank.
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"fas/internal/money"
+	"fas/internal/payment"
+	"fas/internal/utils"
+)
+
+// paymentRun is the body of a request to create a payment batch. Every field is optional.
+type paymentRun struct {
+	Format        string `json:"format"`
+	Currency      string `json:"currency"`
+	ExecutionDate string `json:"execution_date"`
+}
+
+// CreatePaymentBatch submits the scheduled disbursements due by the execution date, today unless given, in a bank
+// file of the format, pain.001 unless given. Only disbursements in the currency, SGD unless given, are included.
+func CreatePaymentBatch(db *sql.DB, debtor payment.Debtor) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		var body paymentRun
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil && err != io.EOF {
+			utils.Error(w, http.StatusBadRequest, utils.CodeInvalidRequest, "Invalid input")
+			return
+		}
+
+		run := payment.Run{Format: body.Format, Currency: body.Currency, ExecutionDate: time.Now()}
+		if run.Format == "" {
+			run.Format = payment.FormatPain001
+		}
+		if run.Currency == "" {
+			run.Currency = money.DefaultCurrency
+		}
+		if !utils.IsValid(payment.Formats, run.Format) {
+			utils.WriteError(w, http.StatusBadRequest, utils.APIError{Code: utils.CodeInvalidValue, Field: "format",
+				Message: "Invalid format, " + utils.FormatValidOptions(payment.Formats)})
+			return
+		}
+		run.Format = payment.CanonicalFormat(run.Format)
+		if !money.IsCurrency(run.Currency) {
+			utils.WriteError(w, http.StatusBadRequest, utils.APIError{Code: utils.CodeInvalidValue, Field: "currency",
+				Message: "Currency must be the ISO 4217 code of a currency with 2 decimal places, such as SGD"})
+			return
+		}
+		if body.ExecutionDate != "" {
+			date, err := time.ParseInLocation("2006-01-02", body.ExecutionDate, time.Local)
+			if err != nil {
+				utils.WriteError(w, http.StatusBadRequest, utils.APIError{Code: utils.CodeInvalidValue, Field: "execution_date",
+					Message: "Date must be in the format YYYY-MM-DD"})
+				return
+			}
+			run.ExecutionDate = date
+		}
+
+		batch, err := payment.Submit(ctx, db, debtor, run)
+		switch {
+		case errors.Is(err, payment.ErrNoDebtor):
+			utils.Error(w, http.StatusServiceUnavailable, utils.CodeUnavailable, "Payment batches need the paying account to be configured")
+			return
+		case errors.Is(err, payment.ErrPastDate):
+			utils.WriteError(w, http.StatusBadRequest, utils.APIError{Code: utils.CodeInvalidValue, Field: "execution_date",
+				Message: "Execution date must be today or later"})
+			return
+		case errors.Is(err, payment.ErrNothingDue):
+			utils.Error(w, http.StatusConflict, utils.CodeInvalidState, "No disbursements in "+run.Currency+" with a bank account are due by "+
+				run.ExecutionDate.Format("2006-01-02"))
+			return
+		case err != nil:
+			utils.Error(w, http.StatusInternalServerError, utils.CodeInternal, "Failed to create payment batch")
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(batch)
+	}
+}
+
+// GetPaymentBatches retrieves every payment batch, the most recent first.
+func GetPaymentBatches(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		batches, err := payment.List(r.Context(), db)
+		if err != nil {
+			utils.Error(w, http.StatusInternalServerError, utils.CodeInternal, "Failed to retrieve payment batches")
+			return
+		}
+
+		utils.WriteConditionalJSON(w, r, "", batches)
+	}
+}
+
+// GetPaymentBatch retrieves a payment batch without its file.
+func GetPaymentBatch(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		batchID := mux.Vars(r)["id"]
+		if err := utils.ValidateUUID(batchID); err != nil {
+			utils.HandleLookupError(w, err)
+			return
+		}
+
+		batch, err := payment.Get(r.Context(), db, batchID)
+		if err == sql.ErrNoRows {
+			utils.Error(w, http.StatusNotFound, utils.CodeNotFound, "Payment batch not found")
+			return
+		}
+		if err != nil {
+			utils.Error(w, http.StatusInternalServerError, utils.CodeInternal, "Failed to retrieve payment batch")
+			return
+		}
+
+		utils.WriteConditionalJSON(w, r, "", batch)
+	}
+}
+
+// GetPaymentBatchFile downloads the file of a payment batch again, exactly as it was first written. A file that no
+// longer matches its checksum is refused rather than sent to the bank.
+func GetPaymentBatchFile(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		batchID := mux.Vars(r)["id"]
+		if err := utils.ValidateUUID(batchID); err != nil {
+			utils.HandleLookupError(w, err)
+			return
+		}
+
+		batch, content, err := payment.Download(r.Context(), db, batchID)
+		switch {
+		case err == sql.ErrNoRows:
+			utils.Error(w, http.StatusNotFound, utils.CodeNotFound, "Payment batch not found")
+			return
+		case errors.Is(err, payment.ErrChecksum):
+			utils.Error(w, http.StatusInternalServerError, utils.CodeInternal, "The payment file no longer matches its checksum")
+			return
+		case err != nil:
+			utils.Error(w, http.StatusInternalServerError, utils.CodeInternal, "Failed to retrieve payment file")
+			return
+		}
+
+		// The checksum tags the file, which never changes
+		w.Header().Set("ETag", `"`+batch.Checksum+`"`)
+		w.Header().Set("Content-Type", payment.ContentType(batch.Format))
+		w.Header().Set("Content-Disposition", `attachment; filename="`+batch.FileName+`"`)
+		w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+		w.WriteHeader(http.StatusOK)
+		w.Write(content)
+	}
+}
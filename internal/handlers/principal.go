@@ -0,0 +1,27 @@
+// Handles all the requests related to the authenticated principal.
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"fas/internal/auth"
+	"fas/internal/utils"
+)
+
+// GetMyPermissions returns the authenticated principal with every permission their roles grant.
+func GetMyPermissions() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		principal, ok := auth.PrincipalFrom(r.Context())
+		if !ok {
+			utils.Error(w, http.StatusUnauthorized, utils.CodeUnauthenticated, "Authentication is required")
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(struct {
+			Principal   auth.Principal    `json:"principal"`
+			Permissions []auth.Permission `json:"permissions"`
+		}{principal, principal.Permissions()})
+	}
+}
@@ -0,0 +1,327 @@
+// Handles all the requests related to reference data.
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+
+	"fas/internal/audit"
+	"fas/internal/models"
+	"fas/internal/refdata"
+	"fas/internal/utils"
+)
+
+// maxReferenceValueLength matches the VARCHAR(50) columns that store enumerated values.
+const maxReferenceValueLength = 50
+
+// GetReferenceData retrieves the reference data of every category, grouped by category.
+// Inactive values are only included when include_inactive=true.
+func GetReferenceData(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		items, err := queryReferenceData(ctx, db, "", r.URL.Query().Get("include_inactive") == "true")
+		if err != nil {
+			utils.Error(w, http.StatusInternalServerError, utils.CodeInternal, "Failed to retrieve reference data")
+			return
+		}
+
+		grouped := make(map[string][]models.ReferenceData)
+		for _, item := range items {
+			grouped[item.Category] = append(grouped[item.Category], item)
+		}
+
+		utils.WriteConditionalJSON(w, r, "", grouped)
+	}
+}
+
+// GetReferenceDataCategory retrieves the reference data of a single category, such as the options of a dropdown.
+func GetReferenceDataCategory(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		category := mux.Vars(r)["category"]
+		if !refdata.IsCategory(category) {
+			utils.Error(w, http.StatusNotFound, utils.CodeNotFound, "Reference data category not found")
+			return
+		}
+
+		items, err := queryReferenceData(ctx, db, category, r.URL.Query().Get("include_inactive") == "true")
+		if err != nil {
+			utils.Error(w, http.StatusInternalServerError, utils.CodeInternal, "Failed to retrieve reference data")
+			return
+		}
+
+		utils.WriteConditionalJSON(w, r, "", items)
+	}
+}
+
+// queryReferenceData retrieves the reference data of a category, or of every category when none is given.
+func queryReferenceData(ctx context.Context, db *sql.DB, category string, includeInactive bool) ([]models.ReferenceData, error) {
+	query := `SELECT id, category, value, COALESCE(label, value), sort_order, active FROM reference_data WHERE 1=1`
+	var args []interface{}
+	if category != "" {
+		query += ` AND category = ?`
+		args = append(args, category)
+	}
+	if !includeInactive {
+		query += ` AND active = TRUE`
+	}
+	query += ` ORDER BY category, sort_order, value`
+
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := []models.ReferenceData{}
+	for rows.Next() {
+		var item models.ReferenceData
+		if err := rows.Scan(&item.ID, &item.Category, &item.Value, &item.Label, &item.SortOrder, &item.Active); err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+// CreateReferenceData adds a value to a reference data category.
+func CreateReferenceData(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		category := mux.Vars(r)["category"]
+		if !refdata.IsCategory(category) {
+			utils.Error(w, http.StatusNotFound, utils.CodeNotFound, "Reference data category not found")
+			return
+		}
+
+		item := models.ReferenceData{Active: true}
+		if err := json.NewDecoder(r.Body).Decode(&item); err != nil {
+			utils.Error(w, http.StatusBadRequest, utils.CodeInvalidRequest, "Invalid input")
+			return
+		}
+		if !validReferenceData(w, category, &item) {
+			return
+		}
+
+		// Begin transaction
+		tx, err := db.BeginTx(ctx, nil)
+		if err != nil {
+			utils.Error(w, http.StatusInternalServerError, utils.CodeInternal, "Failed to begin transaction")
+			return
+		}
+		defer tx.Rollback()
+
+		// Insert the value
+		item.ID = uuid.New().String()
+		item.Category = category
+		_, err = tx.ExecContext(ctx, `INSERT INTO reference_data (id, category, value, label, sort_order, active) VALUES (?, ?, ?, ?, ?, ?)`,
+			item.ID, item.Category, item.Value, item.Label, item.SortOrder, item.Active)
+		if err != nil {
+			utils.HandleInsertError(w, err, "reference data value")
+			return
+		}
+
+		// Record the change
+		err = audit.Record(r.Context(), tx, audit.Entry{Action: audit.ActionCreate, EntityType: "reference_data", EntityID: item.ID, After: item})
+		if err != nil {
+			utils.Error(w, http.StatusInternalServerError, utils.CodeInternal, "Failed to record audit log")
+			return
+		}
+
+		// Commit the transaction
+		if err := tx.Commit(); err != nil {
+			utils.Error(w, http.StatusInternalServerError, utils.CodeInternal, "Failed to commit")
+			return
+		}
+
+		if err := refdata.Load(ctx, db); err != nil {
+			utils.Error(w, http.StatusInternalServerError, utils.CodeInternal, "Failed to refresh reference data")
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(item)
+	}
+}
+
+// UpdateReferenceData changes a reference data value, its label, display order or whether it is active.
+func UpdateReferenceData(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		vars := mux.Vars(r)
+		category, id := vars["category"], vars["id"]
+		if err := checkReferenceData(ctx, db, category, id); err != nil {
+			utils.HandleLookupError(w, err)
+			return
+		}
+
+		item := models.ReferenceData{Active: true}
+		if err := json.NewDecoder(r.Body).Decode(&item); err != nil {
+			utils.Error(w, http.StatusBadRequest, utils.CodeInvalidRequest, "Invalid input")
+			return
+		}
+		if !validReferenceData(w, category, &item) {
+			return
+		}
+
+		// Begin transaction
+		tx, err := db.BeginTx(ctx, nil)
+		if err != nil {
+			utils.Error(w, http.StatusInternalServerError, utils.CodeInternal, "Failed to begin transaction")
+			return
+		}
+		defer tx.Rollback()
+
+		before, err := loadReferenceData(ctx, tx, id)
+		if err != nil {
+			utils.Error(w, http.StatusInternalServerError, utils.CodeInternal, "Failed to retrieve reference data value")
+			return
+		}
+
+		// Update the value
+		_, err = tx.ExecContext(ctx, `UPDATE reference_data SET value=?, label=?, sort_order=?, active=? WHERE id=? AND category=?`,
+			item.Value, item.Label, item.SortOrder, item.Active, id, category)
+		if err != nil {
+			utils.HandleInsertError(w, err, "reference data value")
+			return
+		}
+
+		// Record the change
+		item.ID, item.Category = id, category
+		err = audit.Record(r.Context(), tx, audit.Entry{Action: audit.ActionUpdate, EntityType: "reference_data", EntityID: id, Before: before, After: item})
+		if err != nil {
+			utils.Error(w, http.StatusInternalServerError, utils.CodeInternal, "Failed to record audit log")
+			return
+		}
+
+		// Commit the transaction
+		if err := tx.Commit(); err != nil {
+			utils.Error(w, http.StatusInternalServerError, utils.CodeInternal, "Failed to commit")
+			return
+		}
+
+		if err := refdata.Load(ctx, db); err != nil {
+			utils.Error(w, http.StatusInternalServerError, utils.CodeInternal, "Failed to refresh reference data")
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// DeleteReferenceData removes a value from a reference data category.
+// Existing records keep the value; it is only no longer accepted on input.
+func DeleteReferenceData(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		vars := mux.Vars(r)
+		category, id := vars["category"], vars["id"]
+		if err := checkReferenceData(ctx, db, category, id); err != nil {
+			utils.HandleLookupError(w, err)
+			return
+		}
+
+		// Begin transaction
+		tx, err := db.BeginTx(ctx, nil)
+		if err != nil {
+			utils.Error(w, http.StatusInternalServerError, utils.CodeInternal, "Failed to begin transaction")
+			return
+		}
+		defer tx.Rollback()
+
+		before, err := loadReferenceData(ctx, tx, id)
+		if err != nil {
+			utils.Error(w, http.StatusInternalServerError, utils.CodeInternal, "Failed to retrieve reference data value")
+			return
+		}
+
+		// Delete the value
+		_, err = tx.ExecContext(ctx, `DELETE FROM reference_data WHERE id=? AND category=?`, id, category)
+		if err != nil {
+			utils.Error(w, http.StatusInternalServerError, utils.CodeInternal, "Failed to delete reference data value")
+			return
+		}
+
+		// Record the change
+		err = audit.Record(r.Context(), tx, audit.Entry{Action: audit.ActionDelete, EntityType: "reference_data", EntityID: id, Before: before})
+		if err != nil {
+			utils.Error(w, http.StatusInternalServerError, utils.CodeInternal, "Failed to record audit log")
+			return
+		}
+
+		// Commit the transaction
+		if err := tx.Commit(); err != nil {
+			utils.Error(w, http.StatusInternalServerError, utils.CodeInternal, "Failed to commit")
+			return
+		}
+
+		if err := refdata.Load(ctx, db); err != nil {
+			utils.Error(w, http.StatusInternalServerError, utils.CodeInternal, "Failed to refresh reference data")
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// loadReferenceData retrieves a single reference data value.
+func loadReferenceData(ctx context.Context, q queryer, id string) (models.ReferenceData, error) {
+	var item models.ReferenceData
+	err := q.QueryRowContext(ctx, `SELECT id, category, value, COALESCE(label, value), sort_order, active FROM reference_data WHERE id = ?`, id).
+		Scan(&item.ID, &item.Category, &item.Value, &item.Label, &item.SortOrder, &item.Active)
+	return item, err
+}
+
+// validReferenceData checks the value of a category and defaults its label, writing the error response if it is invalid.
+func validReferenceData(w http.ResponseWriter, category string, item *models.ReferenceData) bool {
+	item.Value = strings.TrimSpace(item.Value)
+	if item.Value == "" || len(item.Value) > maxReferenceValueLength {
+		utils.WriteError(w, http.StatusBadRequest, utils.APIError{
+			Code:    utils.CodeInvalidValue,
+			Message: fmt.Sprintf("Value is required and must be at most %d characters", maxReferenceValueLength),
+			Field:   "value",
+		})
+		return false
+	}
+	// Payments are only scheduled at the frequencies the scheduler knows
+	if category == refdata.BenefitFrequency && !utils.IsValid(models.Frequencies, item.Value) {
+		utils.WriteError(w, http.StatusBadRequest, utils.APIError{
+			Code:    utils.CodeInvalidValue,
+			Message: "Payments cannot be scheduled at this frequency, " + strings.TrimSpace(utils.FormatValidOptions(models.Frequencies)),
+			Field:   "value",
+		})
+		return false
+	}
+	if item.Label == "" {
+		item.Label = item.Value
+	}
+	return true
+}
+
+// checkReferenceData validates the UUID and checks if a reference data value exists in the category.
+func checkReferenceData(ctx context.Context, db *sql.DB, category, id string) error {
+	// Validate the UUID for security
+	if err := utils.ValidateUUID(id); err != nil {
+		return fmt.Errorf("invalid UUID: %w", err)
+	}
+
+	// Check if the value exists
+	var exists bool
+	err := db.QueryRowContext(ctx, "SELECT EXISTS(SELECT 1 FROM reference_data WHERE id = ? AND category = ?)", id, category).Scan(&exists)
+	if err != nil {
+		return fmt.Errorf("error checking reference data existence: %w", err)
+	}
+	if !exists {
+		return fmt.Errorf("reference data value %w", utils.ErrNotFound)
+	}
+
+	return nil
+}
@@ -2,128 +2,217 @@
 package handlers
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/gorilla/mux"
 
+    "fas/internal/audit"
+    "fas/internal/logging"
+    "fas/internal/metrics"
     "fas/internal/models"
 	"fas/internal/utils"
 )
 
 // GetSchemes retrieves all schemes from the database.
+// Deleted schemes are only included when include_deleted=true.
 func GetSchemes(db *sql.DB) http.HandlerFunc {
     return func(w http.ResponseWriter, r *http.Request) {
-        rows, err := db.Query("SELECT id, name FROM schemes")
+        schemes, err := querySchemes(r.Context(), db, "SELECT id, name, version, deleted_at FROM schemes" + notDeleted(r, " WHERE"))
         if err != nil {
-            http.Error(w, "Failed to retrieve schemes", http.StatusInternalServerError)
+            utils.Error(w, http.StatusInternalServerError, utils.CodeInternal, "Failed to retrieve schemes")
             return
         }
-        defer rows.Close()
 
-        var schemes []models.Scheme
-        for rows.Next() {
-            var scheme models.Scheme
-            if err := rows.Scan(&scheme.ID, &scheme.Name); err != nil {
-                http.Error(w, "Failed to scan scheme", http.StatusInternalServerError)
-                return
-            }
+        utils.WriteConditionalJSON(w, r, "", schemes)
+    }
+}
 
-            // Fetch criteria
-            scheme.Criteria, err = getCriteriaForScheme(db, scheme.ID)
-            if err != nil {
-				http.Error(w, "Failed to retrieve criteria", http.StatusInternalServerError)
-				return
-			}
+// querySchemes retrieves the schemes selected by a query for their id, name, version and deleted_at,
+// with the criteria and benefits of every scheme fetched at once.
+func querySchemes(ctx context.Context, q queryer, query string, args ...interface{}) ([]models.Scheme, error) {
+    rows, err := q.QueryContext(ctx, query, args...)
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
 
-            // Fetch benefits
-            scheme.Benefits, err = getBenefitsForScheme(db, scheme.ID)
-            if err != nil {
-				http.Error(w, "Failed to retrieve benefits", http.StatusInternalServerError)
-				return
-			}
+    var schemes []models.Scheme
+    for rows.Next() {
+        var scheme models.Scheme
+        if err := rows.Scan(&scheme.ID, &scheme.Name, &scheme.Version, &scheme.DeletedAt); err != nil {
+            return nil, err
+        }
+        schemes = append(schemes, scheme)
+    }
+    if err := rows.Err(); err != nil {
+        return nil, err
+    }
+    rows.Close()
+
+    ids := make([]string, len(schemes))
+    for i, scheme := range schemes {
+        ids[i] = scheme.ID
+    }
+
+    criteria, err := getCriteriaByScheme(ctx, q, ids)
+    if err != nil {
+        return nil, err
+    }
+    benefits, err := getBenefitsByScheme(ctx, q, ids)
+    if err != nil {
+        return nil, err
+    }
+    for i := range schemes {
+        schemes[i].Criteria = criteria[schemes[i].ID]
+        schemes[i].Benefits = benefits[schemes[i].ID]
+        schemes[i].TotalEntitlement = models.TotalEntitlement(schemes[i].Benefits)
+    }
+    return schemes, nil
+}
 
-            schemes = append(schemes, scheme)
+// GetScheme retrieves a single scheme with its criteria and benefits, tagged with the scheme's version.
+func GetScheme(db *sql.DB) http.HandlerFunc {
+    return func(w http.ResponseWriter, r *http.Request) {
+        ctx := r.Context()
+        schemeID := mux.Vars(r)["id"]
+        if err := utils.ValidateUUID(schemeID); err != nil {
+            utils.HandleLookupError(w, err)
+            return
         }
 
-        if err := rows.Err(); err != nil {
-            http.Error(w, "Failed to read scheme data", http.StatusInternalServerError)
+        scheme, err := loadScheme(ctx, db, schemeID)
+        if err == sql.ErrNoRows || (err == nil && !visible(r, scheme.DeletedAt)) {
+            utils.Error(w, http.StatusNotFound, utils.CodeNotFound, "Scheme not found")
+            return
+        }
+        if err != nil {
+            utils.Error(w, http.StatusInternalServerError, utils.CodeInternal, "Failed to retrieve scheme")
             return
         }
 
-        w.Header().Set("Content-Type", "application/json")
-        json.NewEncoder(w).Encode(schemes)
+        utils.WriteConditionalJSON(w, r, utils.VersionETag(scheme.Version), scheme)
     }
 }
 
+// loadScheme retrieves a scheme with its criteria and benefits, whether deleted or not,
+// returning sql.ErrNoRows if there is no such scheme.
+func loadScheme(ctx context.Context, q queryer, schemeID string) (models.Scheme, error) {
+    var scheme models.Scheme
+    err := q.QueryRowContext(ctx, "SELECT id, name, version, deleted_at FROM schemes WHERE id = ?", schemeID).
+        Scan(&scheme.ID, &scheme.Name, &scheme.Version, &scheme.DeletedAt)
+    if err != nil {
+        return models.Scheme{}, err
+    }
+
+    // Fetch criteria
+    scheme.Criteria, err = getCriteriaForScheme(ctx, q, scheme.ID)
+    if err != nil {
+        return models.Scheme{}, err
+    }
+
+    // Fetch benefits
+    scheme.Benefits, err = getBenefitsForScheme(ctx, q, scheme.ID)
+    if err != nil {
+        return models.Scheme{}, err
+    }
+    scheme.TotalEntitlement = models.TotalEntitlement(scheme.Benefits)
+
+    return scheme, nil
+}
+
 // getCriteriaForScheme retrieves all criteria for a scheme.
-func getCriteriaForScheme(db *sql.DB, schemeID string) ([]models.Criteria, error) {
-    var criteria []models.Criteria
-    rows, err := db.Query(`SELECT id, criteria_level, criteria_type, status FROM criteria 
+func getCriteriaForScheme(ctx context.Context, q queryer, schemeID string) ([]models.Criteria, error) {
+    criteria, err := getCriteriaByScheme(ctx, q, []string{schemeID})
+    return criteria[schemeID], err
+}
+
+// getCriteriaByScheme retrieves the criteria of many schemes in one query, keyed by scheme ID.
+func getCriteriaByScheme(ctx context.Context, q queryer, schemeIDs []string) (map[string][]models.Criteria, error) {
+    criteria := make(map[string][]models.Criteria)
+    err := queryIn(ctx, q, `SELECT scheme_criteria.scheme_id, id, criteria_level, criteria_type, status FROM criteria 
                             JOIN scheme_criteria ON criteria.id = scheme_criteria.criteria_id 
-                            WHERE scheme_criteria.scheme_id = ?`, schemeID)
+                            WHERE scheme_criteria.scheme_id IN (%s)`, schemeIDs,
+        func(rows *sql.Rows) error {
+            var schemeID string
+            var criterion models.Criteria
+            if err := rows.Scan(&schemeID, &criterion.ID, &criterion.CriteriaLevel, &criterion.CriteriaType, &criterion.Status); err != nil {
+                return err
+            }
+            criteria[schemeID] = append(criteria[schemeID], criterion)
+            return nil
+        })
     if err != nil {
         return nil, err
     }
-    defer rows.Close()
-
-    for rows.Next() {
-        var criterion models.Criteria
-        if err := rows.Scan(&criterion.ID, &criterion.CriteriaLevel, &criterion.CriteriaType, &criterion.Status); err != nil {
-            return nil, err
-        }
-        criteria = append(criteria, criterion)
-    }
     return criteria, nil
 }
 
 // getBenefitsForScheme retrieves all benefits for a scheme.
-func getBenefitsForScheme(db *sql.DB, schemeID string) ([]models.Benefit, error) {
-    var benefits []models.Benefit
-    rows, err := db.Query(`SELECT id, name, amount FROM benefits 
+func getBenefitsForScheme(ctx context.Context, q queryer, schemeID string) ([]models.Benefit, error) {
+    benefits, err := getBenefitsByScheme(ctx, q, []string{schemeID})
+    return benefits[schemeID], err
+}
+
+// getBenefitsByScheme retrieves the benefits of many schemes in one query, keyed by scheme ID.
+func getBenefitsByScheme(ctx context.Context, q queryer, schemeIDs []string) (map[string][]models.Benefit, error) {
+    benefits := make(map[string][]models.Benefit)
+    err := queryIn(ctx, q, `SELECT scheme_benefits.scheme_id, id, name, amount, amount_formula, currency, benefit_type, frequency, duration, catalogue FROM benefits 
                             JOIN scheme_benefits ON benefits.id = scheme_benefits.benefit_id 
-                            WHERE scheme_benefits.scheme_id = ?`, schemeID)
+                            WHERE scheme_benefits.scheme_id IN (%s)`, schemeIDs,
+        func(rows *sql.Rows) error {
+            var schemeID string
+            var benefit models.Benefit
+            if err := rows.Scan(&schemeID, &benefit.ID, &benefit.Name, &benefit.Amount, &benefit.AmountFormula, &benefit.Currency, &benefit.Type,
+                &benefit.Frequency, &benefit.Duration, &benefit.Catalogue); err != nil {
+                return err
+            }
+            benefit.Total = benefit.FixedTotal()
+            benefits[schemeID] = append(benefits[schemeID], benefit)
+            return nil
+        })
     if err != nil {
         return nil, err
     }
-    defer rows.Close()
-
-    for rows.Next() {
-        var benefit models.Benefit
-        if err := rows.Scan(&benefit.ID, &benefit.Name, &benefit.Amount); err != nil {
-            return nil, err
-        }
-        benefits = append(benefits, benefit)
-    }
     return benefits, nil
 }
 
 // GetEligibleSchemes returns the schemes an applicant is eligible for
 func GetEligibleSchemes(db *sql.DB) http.HandlerFunc {
     return func(w http.ResponseWriter, r *http.Request) {
+        ctx := r.Context()
         applicantID := r.URL.Query().Get("applicant")
 
         // Validate the UUID for security
         if err := utils.ValidateUUID(applicantID); err != nil {
-            http.Error(w, err.Error(), http.StatusBadRequest)
+            utils.HandleLookupError(w, err)
             return
         }
 
         // Check if applicant exist
         var exists bool
-        err := db.QueryRow("SELECT EXISTS(SELECT 1 FROM applicants WHERE id = ?)", applicantID).Scan(&exists)
-        if err != nil || !exists {
-            http.Error(w, "Applicant not found", http.StatusBadRequest)
+        err := db.QueryRowContext(ctx, "SELECT EXISTS(SELECT 1 FROM applicants WHERE id = ? AND deleted_at IS NULL)", applicantID).Scan(&exists)
+        if err != nil {
+            utils.Error(w, http.StatusInternalServerError, utils.CodeInternal, "Failed to check applicant")
+            return
+        }
+        if !exists {
+            utils.Error(w, http.StatusNotFound, utils.CodeNotFound, "Applicant not found")
             return
         }
 
         // Fetch schemes the applicant is eligible for
-        schemes, err := fetchEligibleSchemes(db, applicantID)
+        start := time.Now()
+        schemes, err := fetchEligibleSchemes(ctx, db, applicantID)
+        metrics.EligibilityDuration.Observe(time.Since(start).Seconds())
         if err != nil {
-            http.Error(w, "Error retrieving schemes", http.StatusInternalServerError)
+            utils.Error(w, http.StatusInternalServerError, utils.CodeInternal, "Error retrieving schemes")
             return
         }
 
@@ -133,7 +222,7 @@ func GetEligibleSchemes(db *sql.DB) http.HandlerFunc {
 }
 
 // fetchEligibleSchemes queries the database for schemes an applicant is eligible for.
-func fetchEligibleSchemes(db *sql.DB, applicantID string) ([]models.Scheme, error) {
+func fetchEligibleSchemes(ctx context.Context, db *sql.DB, applicantID string) ([]models.Scheme, error) {
     query := `SELECT s.id, s.name
     FROM schemes s
     LEFT JOIN (
@@ -166,11 +255,11 @@ func fetchEligibleSchemes(db *sql.DB, applicantID string) ([]models.Scheme, erro
             SELECT COUNT(*) FROM scheme_criteria WHERE scheme_id = sc.scheme_id
         )
     ) AS eligible_schemes ON s.id = eligible_schemes.scheme_id
-    WHERE eligible_schemes.scheme_id IS NOT NULL OR NOT EXISTS (
+    WHERE s.deleted_at IS NULL AND (eligible_schemes.scheme_id IS NOT NULL OR NOT EXISTS (
         SELECT 1 FROM scheme_criteria WHERE scheme_id = s.id
-    )
+    ))
   `
-	rows, err := db.Query(query, applicantID)
+	rows, err := db.QueryContext(ctx, query, applicantID)
     if err != nil {
         return nil, err
     }
@@ -192,23 +281,25 @@ func fetchEligibleSchemes(db *sql.DB, applicantID string) ([]models.Scheme, erro
 // CreateScheme creates a new scheme in the database.
 func CreateScheme(db *sql.DB) http.HandlerFunc {
     return func(w http.ResponseWriter, r *http.Request) {
+        ctx := r.Context()
         var scheme models.Scheme
         if err := json.NewDecoder(r.Body).Decode(&scheme); err != nil {
-            http.Error(w, "Invalid input", http.StatusBadRequest)
+            utils.Error(w, http.StatusBadRequest, utils.CodeInvalidRequest, "Invalid input")
             return
         }
 
         // Begin transaction
-        tx, err := db.Begin()
+        tx, err := db.BeginTx(ctx, nil)
         if err != nil {
-            http.Error(w, "Failed to begin transaction", http.StatusInternalServerError)
+            utils.Error(w, http.StatusInternalServerError, utils.CodeInternal, "Failed to begin transaction")
             return
         }
 		defer tx.Rollback()
 
         // Insert the scheme
 		scheme.ID = uuid.New().String()
-        _, err = tx.Exec(`INSERT INTO schemes (id, name) VALUES (?, ?)`,
+        scheme.Version = 1
+        _, err = tx.ExecContext(ctx, `INSERT INTO schemes (id, name) VALUES (?, ?)`,
             scheme.ID, scheme.Name)
         if err != nil {
             utils.HandleInsertError(w, err, "scheme")
@@ -216,29 +307,30 @@ func CreateScheme(db *sql.DB) http.HandlerFunc {
         }
 
         // Insert and link criteria
-        for i := range scheme.Criteria {
-            err = insertAndLinkCriteria(tx, db, scheme.ID, &scheme.Criteria[i])
-            if err != nil {
-                http.Error(w, err.Error(), http.StatusInternalServerError)
-                return
-            }
+        if !linkCriteria(w, r, tx, scheme.ID, scheme.Criteria) {
+            return
         }
 
         // Insert and link benefits
-        for i := range scheme.Benefits {
-            err = insertAndLinkBenefits(tx, db, scheme.ID, &scheme.Benefits[i])
-            if err != nil {
-                http.Error(w, err.Error(), http.StatusInternalServerError)
-                return
-            }
+        if !linkBenefits(w, r, tx, scheme.ID, scheme.Benefits) {
+            return
+        }
+        scheme.TotalEntitlement = models.TotalEntitlement(scheme.Benefits)
+
+        // Record the change
+        err = audit.Record(r.Context(), tx, audit.Entry{Action: audit.ActionCreate, EntityType: "scheme", EntityID: scheme.ID, After: scheme})
+        if err != nil {
+            utils.Error(w, http.StatusInternalServerError, utils.CodeInternal, "Failed to record audit log")
+            return
         }
 
         // Commit the transaction
         if err := tx.Commit(); err != nil {
-            http.Error(w, "Failed to commit transaction", http.StatusInternalServerError)
+            utils.Error(w, http.StatusInternalServerError, utils.CodeInternal, "Failed to commit transaction")
             return
         }
 
+        w.Header().Set("ETag", utils.VersionETag(scheme.Version))
         w.WriteHeader(http.StatusCreated)
         json.NewEncoder(w).Encode(scheme)
     }
@@ -247,96 +339,150 @@ func CreateScheme(db *sql.DB) http.HandlerFunc {
 // UpdateScheme updates an existing scheme.
 func UpdateScheme(db *sql.DB) http.HandlerFunc {
     return func(w http.ResponseWriter, r *http.Request) {
+        ctx := r.Context()
         // Validate the scheme
         vars := mux.Vars(r)
         schemeID := vars["id"]
-        if err := checkScheme(db, schemeID); err != nil {
-            http.Error(w, err.Error(), http.StatusBadRequest)
+        if err := checkScheme(ctx, db, schemeID); err != nil {
+            utils.HandleLookupError(w, err)
+            return
+        }
+        version, ok := utils.RequireIfMatch(w, r)
+        if !ok {
             return
         }
 
         var scheme models.Scheme
         if err := json.NewDecoder(r.Body).Decode(&scheme); err != nil {
-            http.Error(w, "Invalid input", http.StatusBadRequest)
+            utils.Error(w, http.StatusBadRequest, utils.CodeInvalidRequest, "Invalid input")
             return
         }
 
         // Begin transaction
-        tx, err := db.Begin()
+        tx, err := db.BeginTx(ctx, nil)
         if err != nil {
-            http.Error(w, "Failed to begin transaction", http.StatusInternalServerError)
+            utils.Error(w, http.StatusInternalServerError, utils.CodeInternal, "Failed to begin transaction")
             return
         }
         defer tx.Rollback()
 
-        // Update the scheme
-        _, err = tx.Exec(`UPDATE schemes SET name=? WHERE id=?`, scheme.Name, schemeID)
+        before, err := loadScheme(ctx, tx, schemeID)
         if err != nil {
-            http.Error(w, "Failed to update scheme", http.StatusInternalServerError)
+            utils.Error(w, http.StatusInternalServerError, utils.CodeInternal, "Failed to retrieve scheme")
+            return
+        }
+
+        // Update the scheme, provided nobody has changed it since the client read it
+        result, err := tx.ExecContext(ctx, `UPDATE schemes SET name=?, version=version+1 WHERE id=? AND version=?`, scheme.Name, schemeID, version)
+        if err != nil {
+            utils.Error(w, http.StatusInternalServerError, utils.CodeInternal, "Failed to update scheme")
+            return
+        }
+        if n, err := result.RowsAffected(); err != nil || n == 0 {
+            utils.Error(w, http.StatusPreconditionFailed, utils.CodePreconditionFailed, "Scheme has been modified since it was retrieved")
             return
         }
 
         // Delete all existing criteria
-        _, err = tx.Exec(`DELETE FROM scheme_criteria WHERE scheme_id=?`, schemeID)
+        _, err = tx.ExecContext(ctx, `DELETE FROM scheme_criteria WHERE scheme_id=?`, schemeID)
         if err != nil {
-            http.Error(w, "Failed to delete existing criteria", http.StatusInternalServerError)
+            utils.Error(w, http.StatusInternalServerError, utils.CodeInternal, "Failed to delete existing criteria")
             return
         }
 
         // Delete all existing benefits
-        _, err = tx.Exec(`DELETE FROM scheme_benefits WHERE scheme_id=?`, schemeID)
+        _, err = tx.ExecContext(ctx, `DELETE FROM scheme_benefits WHERE scheme_id=?`, schemeID)
         if err != nil {
-            http.Error(w, "Failed to delete existing benefits", http.StatusInternalServerError)
+            utils.Error(w, http.StatusInternalServerError, utils.CodeInternal, "Failed to delete existing benefits")
             return
         }
 
         // Insert and link criteria
-        for i := range scheme.Criteria {
-            err = insertAndLinkCriteria(tx, db, schemeID, &scheme.Criteria[i])
-            if err != nil {
-                http.Error(w, err.Error(), http.StatusInternalServerError)
-                return
-            }
+        if !linkCriteria(w, r, tx, schemeID, scheme.Criteria) {
+            return
         }
 
         // Insert and link benefits
-        for i := range scheme.Benefits {
-            err = insertAndLinkBenefits(tx, db, schemeID, &scheme.Benefits[i])
-            if err != nil {
-                http.Error(w, err.Error(), http.StatusInternalServerError)
-                return
-            }
+        if !linkBenefits(w, r, tx, schemeID, scheme.Benefits) {
+            return
         }
 
-        // Commit the transaction
-        if err = tx.Commit(); err != nil {
-            http.Error(w, "Failed to commit", http.StatusInternalServerError)
+        // Cleanup orphaned benefits and criteria
+        if err := deleteOrphanedBenefits(ctx, tx); err != nil {
+            utils.Error(w, http.StatusInternalServerError, utils.CodeInternal, "Failed to delete unused benefits")
+            return
+        }
+        if err := deleteOrphanedCriteria(ctx, tx); err != nil {
+            utils.Error(w, http.StatusInternalServerError, utils.CodeInternal, "Failed to delete unused criteria")
             return
         }
 
-        // Cleanup orphaned benefits and criteria
-        if err := deleteOrphanedBenefits(db); err != nil {
-            http.Error(w, "Failed to delete unused benefits", http.StatusInternalServerError)
+        // Record the change
+        after, err := loadScheme(ctx, tx, schemeID)
+        if err != nil {
+            utils.Error(w, http.StatusInternalServerError, utils.CodeInternal, "Failed to retrieve scheme")
             return
         }
-        if err := deleteOrphanedCriteria(db); err != nil {
-            http.Error(w, "Failed to delete unused criteria", http.StatusInternalServerError)
+        err = audit.Record(r.Context(), tx, audit.Entry{Action: audit.ActionUpdate, EntityType: "scheme", EntityID: schemeID, Before: before, After: after})
+        if err != nil {
+            utils.Error(w, http.StatusInternalServerError, utils.CodeInternal, "Failed to record audit log")
+            return
+        }
+
+        // Commit the transaction
+        if err = tx.Commit(); err != nil {
+            utils.Error(w, http.StatusInternalServerError, utils.CodeInternal, "Failed to commit")
             return
         }
 
+        w.Header().Set("ETag", utils.VersionETag(version+1))
         w.WriteHeader(http.StatusNoContent)
     }
 }
 
-// insertAndLinkCriteria inserts a criteria and links it to a scheme.
-func insertAndLinkCriteria(tx *sql.Tx, db *sql.DB, schemeID string, criteria *models.Criteria) error {
+// errAlreadyLinked is returned when a criteria or benefit is linked to a scheme twice.
+var errAlreadyLinked = errors.New("already linked to the scheme")
+
+// linkCriteria inserts and links each criteria of a scheme, writing the error response if it fails.
+func linkCriteria(w http.ResponseWriter, r *http.Request, tx *sql.Tx, schemeID string, criteria []models.Criteria) bool {
+    for i := range criteria {
+        err := insertAndLinkCriteria(r.Context(), tx, schemeID, &criteria[i])
+        switch {
+        case err == nil:
+            continue
+        case errors.Is(err, utils.ErrNotFound):
+            utils.WriteError(w, http.StatusBadRequest, utils.APIError{Code: utils.CodeForeignKeyViolation,
+                Field: fmt.Sprintf("criteria[%d].id", i), Message: "Criteria not found"})
+        case errors.Is(err, errAlreadyLinked):
+            utils.WriteError(w, http.StatusBadRequest, utils.APIError{Code: utils.CodeDuplicateEntry,
+                Field: fmt.Sprintf("criteria[%d]", i), Message: "Criteria is listed more than once"})
+        case !utils.HandleContextError(w, err):
+            logging.FromContext(r.Context()).Error("linking criteria failed", "scheme_id", schemeID, "error", err)
+            utils.Error(w, http.StatusInternalServerError, utils.CodeInternal, "Failed to link criteria to scheme")
+        }
+        return false
+    }
+    return true
+}
+
+// insertAndLinkCriteria links a criteria to a scheme. A criteria given by ID must already exist;
+// otherwise the criteria with the same level, type and status is reused, or inserted if there is none.
+func insertAndLinkCriteria(ctx context.Context, tx *sql.Tx, schemeID string, criteria *models.Criteria) error {
     var err error
-    err = db.QueryRow(`SELECT id FROM criteria WHERE criteria_level = ? AND criteria_type = ? AND status = ?`,
-        criteria.CriteriaLevel, criteria.CriteriaType, criteria.Status).Scan(&criteria.ID)
+    if criteria.ID != "" {
+        err = tx.QueryRowContext(ctx, `SELECT criteria_level, criteria_type, status FROM criteria WHERE id = ?`, criteria.ID).
+            Scan(&criteria.CriteriaLevel, &criteria.CriteriaType, &criteria.Status)
+        if err == sql.ErrNoRows {
+            return fmt.Errorf("criteria %w", utils.ErrNotFound)
+        }
+    } else {
+        err = tx.QueryRowContext(ctx, `SELECT id FROM criteria WHERE criteria_level = ? AND criteria_type = ? AND status = ?`,
+            criteria.CriteriaLevel, criteria.CriteriaType, criteria.Status).Scan(&criteria.ID)
+    }
 
     if err == sql.ErrNoRows {
         criteria.ID = uuid.New().String()
-        _, err = tx.Exec(`INSERT INTO criteria (id, criteria_level, criteria_type, status) VALUES (?, ?, ?, ?)`,
+        _, err = tx.ExecContext(ctx, `INSERT INTO criteria (id, criteria_level, criteria_type, status) VALUES (?, ?, ?, ?)`,
             criteria.ID, criteria.CriteriaLevel, criteria.CriteriaType, criteria.Status)
         if err != nil {
             return fmt.Errorf("failed to insert criteria: %w", err)
@@ -345,23 +491,61 @@ func insertAndLinkCriteria(tx *sql.Tx, db *sql.DB, schemeID string, criteria *mo
         return fmt.Errorf("failed to check criteria: %w", err)
     }
 
-    _, err = tx.Exec(`INSERT INTO scheme_criteria (scheme_id, criteria_id) VALUES (?, ?)`, schemeID, criteria.ID)
+    _, err = tx.ExecContext(ctx, `INSERT INTO scheme_criteria (scheme_id, criteria_id) VALUES (?, ?)`, schemeID, criteria.ID)
+    if utils.IsDuplicateEntry(err) {
+        return fmt.Errorf("criteria %s %w", criteria.ID, errAlreadyLinked)
+    }
     if err != nil {
         return fmt.Errorf("failed to link criteria to scheme: %w", err)
     }
     return nil
 }
 
-// insertAndLinkBenefits inserts a benefit and links it to a scheme.
-func insertAndLinkBenefits(tx *sql.Tx, db *sql.DB, schemeID string, benefit *models.Benefit) error {
+// linkBenefits inserts and links each benefit of a scheme, writing the error response if it fails.
+func linkBenefits(w http.ResponseWriter, r *http.Request, tx *sql.Tx, schemeID string, benefits []models.Benefit) bool {
+    for i := range benefits {
+        err := insertAndLinkBenefits(r.Context(), tx, schemeID, &benefits[i])
+        switch {
+        case err == nil:
+            continue
+        case errors.Is(err, utils.ErrNotFound):
+            utils.WriteError(w, http.StatusBadRequest, utils.APIError{Code: utils.CodeForeignKeyViolation,
+                Field: fmt.Sprintf("benefits[%d].id", i), Message: "Benefit not found"})
+        case errors.Is(err, errAlreadyLinked):
+            utils.WriteError(w, http.StatusBadRequest, utils.APIError{Code: utils.CodeDuplicateEntry,
+                Field: fmt.Sprintf("benefits[%d]", i), Message: "Benefit is listed more than once"})
+        case !utils.HandleContextError(w, err):
+            logging.FromContext(r.Context()).Error("linking benefit failed", "scheme_id", schemeID, "error", err)
+            utils.Error(w, http.StatusInternalServerError, utils.CodeInternal, "Failed to link benefit to scheme")
+        }
+        return false
+    }
+    return true
+}
+
+// insertAndLinkBenefits links a benefit to a scheme. A benefit given by ID must already exist;
+// otherwise the benefit with the same name, amount, formula, currency, type, frequency and duration is reused,
+// or inserted if there is none.
+func insertAndLinkBenefits(ctx context.Context, tx *sql.Tx, schemeID string, benefit *models.Benefit) error {
     var err error
-    err = db.QueryRow(`SELECT id FROM benefits WHERE name = ? AND amount = ?`,
-        benefit.Name, benefit.Amount).Scan(&benefit.ID)
+    if benefit.ID != "" {
+        err = tx.QueryRowContext(ctx, `SELECT name, amount, amount_formula, currency, benefit_type, frequency, duration, catalogue
+            FROM benefits WHERE id = ?`, benefit.ID).Scan(&benefit.Name, &benefit.Amount, &benefit.AmountFormula, &benefit.Currency, &benefit.Type, &benefit.Frequency, &benefit.Duration, &benefit.Catalogue)
+        if err == sql.ErrNoRows {
+            return fmt.Errorf("benefit %w", utils.ErrNotFound)
+        }
+    } else {
+        setBenefitDefaults(benefit)
+        err = tx.QueryRowContext(ctx, `SELECT id, catalogue FROM benefits
+            WHERE name = ? AND amount = ? AND amount_formula = ? AND currency = ? AND benefit_type = ? AND frequency = ? AND duration = ?`,
+            benefit.Name, benefit.Amount, benefit.AmountFormula, benefit.Currency, benefit.Type, benefit.Frequency, benefit.Duration).Scan(&benefit.ID, &benefit.Catalogue)
+    }
 
     if err == sql.ErrNoRows {
         benefit.ID = uuid.New().String()
-        _, err = tx.Exec(`INSERT INTO benefits (id, name, amount) VALUES (?, ?, ?)`,
-            benefit.ID, benefit.Name, benefit.Amount)
+        _, err = tx.ExecContext(ctx, `INSERT INTO benefits (id, name, amount, amount_formula, currency, benefit_type, frequency, duration)
+            VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+            benefit.ID, benefit.Name, benefit.Amount, benefit.AmountFormula, benefit.Currency, benefit.Type, benefit.Frequency, benefit.Duration)
         if err != nil {
             return fmt.Errorf("failed to insert benefit: %w", err)
         }
@@ -369,61 +553,102 @@ func insertAndLinkBenefits(tx *sql.Tx, db *sql.DB, schemeID string, benefit *mod
         return fmt.Errorf("failed to check benefit: %w", err)
     }
 
-    _, err = tx.Exec(`INSERT INTO scheme_benefits (scheme_id, benefit_id) VALUES (?, ?)`, schemeID, benefit.ID)
+    _, err = tx.ExecContext(ctx, `INSERT INTO scheme_benefits (scheme_id, benefit_id) VALUES (?, ?)`, schemeID, benefit.ID)
+    if utils.IsDuplicateEntry(err) {
+        return fmt.Errorf("benefit %s %w", benefit.ID, errAlreadyLinked)
+    }
     if err != nil {
         return fmt.Errorf("failed to link benefit to scheme: %w", err)
     }
+    benefit.Total = benefit.FixedTotal()
     return nil
 }
 
-// DeleteScheme removes a scheme from the database.
+// DeleteScheme marks a scheme as deleted, keeping its criteria and benefits. It can be restored until it is purged.
+// A scheme with applications is only deleted, along with the applications, when cascade=true.
 func DeleteScheme(db *sql.DB) http.HandlerFunc {
     return func(w http.ResponseWriter, r *http.Request) {
+        ctx := r.Context()
         // Validate the scheme
         vars := mux.Vars(r)
         schemeID := vars["id"]
-        if err := checkScheme(db, schemeID); err != nil {
-            http.Error(w, err.Error(), http.StatusBadRequest)
+        if err := checkScheme(ctx, db, schemeID); err != nil {
+            utils.HandleLookupError(w, err)
+            return
+        }
+        version, ok := utils.RequireIfMatch(w, r)
+        if !ok {
             return
         }
 
         // Begin transaction
-        tx, err := db.Begin()
+        tx, err := db.BeginTx(ctx, nil)
         if err != nil {
-            http.Error(w, "Failed to begin transaction", http.StatusInternalServerError)
+            utils.Error(w, http.StatusInternalServerError, utils.CodeInternal, "Failed to begin transaction")
             return
         }
         defer tx.Rollback()
 
-        // Delete the scheme
-        _, err = tx.Exec(`DELETE FROM schemes WHERE id=?`, schemeID)
+        before, err := loadScheme(ctx, tx, schemeID)
         if err != nil {
-            http.Error(w, "Failed to delete scheme", http.StatusInternalServerError)
+            utils.Error(w, http.StatusInternalServerError, utils.CodeInternal, "Failed to retrieve scheme")
             return
         }
 
-        // Commit the transaction
-        if err := tx.Commit(); err != nil {
-            http.Error(w, "Failed to commit", http.StatusInternalServerError)
+        // Refuse to delete the applications for the scheme unless asked to
+        applications, err := dependentApplications(ctx, tx, "scheme_id", schemeID, false)
+        if err != nil {
+            utils.Error(w, http.StatusInternalServerError, utils.CodeInternal, "Failed to retrieve applications")
+            return
+        }
+        if !refuseDependents(w, r, "scheme", applications) {
             return
         }
 
-        // Cleanup orphaned benefits and criteria
-        if err := deleteOrphanedBenefits(db); err != nil {
-            http.Error(w, "Failed to delete unused benefits", http.StatusInternalServerError)
+        // Delete the scheme, provided nobody has changed it since the client read it
+        result, err := tx.ExecContext(ctx, `UPDATE schemes SET deleted_at=?, version=version+1 WHERE id=? AND version=? AND deleted_at IS NULL`,
+            time.Now().UTC(), schemeID, version)
+        if err != nil {
+            utils.Error(w, http.StatusInternalServerError, utils.CodeInternal, "Failed to delete scheme")
             return
         }
-        if err := deleteOrphanedCriteria(db); err != nil {
-            http.Error(w, "Failed to delete unused criteria", http.StatusInternalServerError)
+        if n, err := result.RowsAffected(); err != nil || n == 0 {
+            utils.Error(w, http.StatusPreconditionFailed, utils.CodePreconditionFailed, "Scheme has been modified since it was retrieved")
             return
         }
 
-        w.WriteHeader(http.StatusNoContent)
+        // Record the change
+        after, err := loadScheme(ctx, tx, schemeID)
+        if err != nil {
+            utils.Error(w, http.StatusInternalServerError, utils.CodeInternal, "Failed to retrieve scheme")
+            return
+        }
+        err = audit.Record(r.Context(), tx, audit.Entry{Action: audit.ActionDelete, EntityType: "scheme", EntityID: schemeID, Before: before, After: after})
+        if err != nil {
+            utils.Error(w, http.StatusInternalServerError, utils.CodeInternal, "Failed to record audit log")
+            return
+        }
+
+        // Delete the applications for the scheme
+        removed := removal{"scheme": {schemeID}}
+        removed["application"], err = cascadeDeleteApplications(r.Context(), tx, applications)
+        if err != nil {
+            utils.Error(w, http.StatusInternalServerError, utils.CodeInternal, "Failed to delete applications")
+            return
+        }
+
+        // Commit the transaction
+        if err := tx.Commit(); err != nil {
+            utils.Error(w, http.StatusInternalServerError, utils.CodeInternal, "Failed to commit")
+            return
+        }
+
+        writeRemoval(w, r, removed)
     }
 }
 
-// checkScheme validates the UUID and checks if a scheme exists.
-func checkScheme(db *sql.DB, schemeID string) error {
+// checkScheme validates the UUID and checks if a scheme exists and has not been deleted.
+func checkScheme(ctx context.Context, db *sql.DB, schemeID string) error {
     // Validate the UUID for security
     if err := utils.ValidateUUID(schemeID); err != nil {
         return fmt.Errorf("invalid UUID: %w", err)
@@ -431,81 +656,32 @@ func checkScheme(db *sql.DB, schemeID string) error {
 
     // Check if scheme exists
     var exists bool
-    err := db.QueryRow("SELECT EXISTS(SELECT 1 FROM schemes WHERE id = ?)", schemeID).Scan(&exists)
+    err := db.QueryRowContext(ctx, "SELECT EXISTS(SELECT 1 FROM schemes WHERE id = ? AND deleted_at IS NULL)", schemeID).Scan(&exists)
     if err != nil {
         return fmt.Errorf("error checking scheme existence: %w", err)
     }
     if !exists {
-        return fmt.Errorf("scheme not found")
+        return fmt.Errorf("scheme %w", utils.ErrNotFound)
     }
 
     return nil
 }
 
-// deleteOrphanedBenefits deletes benefits that are not linked to any scheme.
-func deleteOrphanedBenefits(db *sql.DB) error {
-    // Fetch the IDs of unused benefits
-    rows, err := db.Query(`SELECT id FROM benefits WHERE id NOT IN (SELECT benefit_id FROM scheme_benefits)`)
-    if err != nil {
-        return fmt.Errorf("failed to fetch unused benefits: %v", err)
-    }
-    defer rows.Close()
-
-    delete, err := db.Prepare(`DELETE FROM benefits WHERE id = ?`)
+// deleteOrphanedBenefits deletes, within the transaction, the benefits that are not linked to any scheme,
+// unless they belong to the catalogue.
+func deleteOrphanedBenefits(ctx context.Context, tx *sql.Tx) error {
+    _, err := tx.ExecContext(ctx, `DELETE FROM benefits WHERE catalogue = FALSE AND id NOT IN (SELECT benefit_id FROM scheme_benefits)`)
     if err != nil {
-        return fmt.Errorf("failed to prepare delete statement: %v", err)
+        return fmt.Errorf("failed to delete unused benefits: %w", err)
     }
-    defer delete.Close()
-
-    var id string
-    // Execute a DELETE for each unused benefit
-    for rows.Next() {
-        if err := rows.Scan(&id); err != nil {
-            return fmt.Errorf("failed to scan benefit id: %v", err)
-        }
-
-        if _, err := delete.Exec(id); err != nil {
-            return fmt.Errorf("failed to delete benefit with id %s: %v", id, err)
-        }
-    }
-
-    if err := rows.Err(); err != nil {
-        return fmt.Errorf("iteration error: %v", err)
-    }
-
     return nil
 }
 
-// deleteOrphanedCriteria deletes criteria that are not linked to any scheme.
-func deleteOrphanedCriteria(db *sql.DB) error {
-    // Fetch the IDs of unused criteria
-    rows, err := db.Query(`SELECT id FROM criteria WHERE id NOT IN (SELECT criteria_id FROM scheme_criteria)`)
-    if err != nil {
-        return fmt.Errorf("failed to fetch unused benefits: %v", err)
-    }
-    defer rows.Close()
-
-    delete, err := db.Prepare(`DELETE FROM criteria WHERE id = ?`)
+// deleteOrphanedCriteria deletes, within the transaction, the criteria that are not linked to any scheme.
+func deleteOrphanedCriteria(ctx context.Context, tx *sql.Tx) error {
+    _, err := tx.ExecContext(ctx, `DELETE FROM criteria WHERE id NOT IN (SELECT criteria_id FROM scheme_criteria)`)
     if err != nil {
-        return fmt.Errorf("failed to prepare delete statement: %v", err)
+        return fmt.Errorf("failed to delete unused criteria: %w", err)
     }
-    defer delete.Close()
-
-    var id string
-    // Execute a DELETE for each unused criteria
-    for rows.Next() {
-        if err := rows.Scan(&id); err != nil {
-            return fmt.Errorf("failed to scan criteria id: %v", err)
-        }
-
-        if _, err := delete.Exec(id); err != nil {
-            return fmt.Errorf("failed to delete criteria with id %s: %v", id, err)
-        }
-    }
-
-    if err := rows.Err(); err != nil {
-        return fmt.Errorf("iteration error: %v", err)
-    }
-
     return nil
 }
@@ -0,0 +1,310 @@
+// Handles restoring and purging soft-deleted applicants, schemes and applications.
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"fas/internal/audit"
+	"fas/internal/logging"
+	"fas/internal/models"
+	"fas/internal/utils"
+)
+
+// includeDeleted reports whether the request asks for deleted entries as well.
+func includeDeleted(r *http.Request) bool {
+	return r.URL.Query().Get("include_deleted") == "true"
+}
+
+// notDeleted returns the condition excluding deleted rows, joined by the given keyword,
+// or nothing when the request asks for deleted entries as well.
+func notDeleted(r *http.Request, keyword string) string {
+	if includeDeleted(r) {
+		return ""
+	}
+	return keyword + " deleted_at IS NULL"
+}
+
+// visible reports whether an entry with the given deletion time should be returned for the request.
+func visible(r *http.Request, deletedAt *string) bool {
+	return deletedAt == nil || includeDeleted(r)
+}
+
+// softDeleted describes an entity whose rows are marked as deleted rather than removed.
+type softDeleted struct {
+	table  string
+	entity string
+	load   func(ctx context.Context, q queryer, id string) (interface{}, error)
+	// restorable reports why a deleted row cannot be restored, if it cannot
+	restorable func(ctx context.Context, q queryer, id string) (string, error)
+	// purged cleans up within the transaction after a row is purged
+	purged func(ctx context.Context, tx *sql.Tx) error
+	// dependentColumn is the column of applications that refers to this entity, if any
+	dependentColumn string
+	// removed lists the entries other than applications that the database removes along with a purged row
+	removed func(entity interface{}) removal
+}
+
+var (
+	applicantEntity = softDeleted{
+		table:           "applicants",
+		entity:          "applicant",
+		load:            func(ctx context.Context, q queryer, id string) (interface{}, error) { return loadApplicant(ctx, q, id) },
+		dependentColumn: "applicant_id",
+		removed: func(entity interface{}) removal {
+			household := []string{}
+			for _, member := range entity.(models.Applicant).Household {
+				household = append(household, member.ID)
+			}
+			return removal{"household": household}
+		},
+	}
+	schemeEntity = softDeleted{
+		table:           "schemes",
+		entity:          "scheme",
+		load:            func(ctx context.Context, q queryer, id string) (interface{}, error) { return loadScheme(ctx, q, id) },
+		dependentColumn: "scheme_id",
+		purged: func(ctx context.Context, tx *sql.Tx) error {
+			if err := deleteOrphanedBenefits(ctx, tx); err != nil {
+				return err
+			}
+			return deleteOrphanedCriteria(ctx, tx)
+		},
+	}
+	applicationEntity = softDeleted{
+		table:  "applications",
+		entity: "application",
+		load: func(ctx context.Context, q queryer, id string) (interface{}, error) {
+			return loadApplication(ctx, q, id)
+		},
+		restorable: applicationRestorable,
+	}
+)
+
+// applicationRestorable refuses to restore an application whose applicant or scheme is still deleted.
+func applicationRestorable(ctx context.Context, q queryer, id string) (string, error) {
+	var applicantDeleted, schemeDeleted bool
+	err := q.QueryRowContext(ctx, `SELECT a.deleted_at IS NOT NULL, s.deleted_at IS NOT NULL FROM applications app
+		JOIN applicants a ON a.id = app.applicant_id
+		JOIN schemes s ON s.id = app.scheme_id
+		WHERE app.id = ?`, id).Scan(&applicantDeleted, &schemeDeleted)
+	switch {
+	case err != nil:
+		return "", err
+	case applicantDeleted:
+		return "The applicant of this application must be restored first", nil
+	case schemeDeleted:
+		return "The scheme of this application must be restored first", nil
+	}
+	return "", nil
+}
+
+// RestoreApplicant restores a deleted applicant.
+func RestoreApplicant(db *sql.DB) http.HandlerFunc { return restore(db, applicantEntity) }
+
+// RestoreScheme restores a deleted scheme.
+func RestoreScheme(db *sql.DB) http.HandlerFunc { return restore(db, schemeEntity) }
+
+// RestoreApplication restores a deleted application, once its applicant and scheme are restored.
+func RestoreApplication(db *sql.DB) http.HandlerFunc { return restore(db, applicationEntity) }
+
+// PurgeApplicant permanently removes a deleted applicant and their household.
+// Any applications of the applicant are only removed as well when cascade=true, and never if they have payments in the ledger.
+func PurgeApplicant(db *sql.DB) http.HandlerFunc { return purge(db, applicantEntity) }
+
+// PurgeScheme permanently removes a deleted scheme.
+// Any applications for the scheme are only removed as well when cascade=true, and never if they have payments in the ledger.
+func PurgeScheme(db *sql.DB) http.HandlerFunc { return purge(db, schemeEntity) }
+
+// PurgeApplication permanently removes a deleted application, unless it has payments in the ledger.
+func PurgeApplication(db *sql.DB) http.HandlerFunc { return purge(db, applicationEntity) }
+
+// restore clears the deletion time of a deleted row, tagging the response with its new version.
+func restore(db *sql.DB, kind softDeleted) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		id := mux.Vars(r)["id"]
+		if err := utils.ValidateUUID(id); err != nil {
+			utils.HandleLookupError(w, err)
+			return
+		}
+
+		// Begin transaction
+		tx, err := db.BeginTx(ctx, nil)
+		if err != nil {
+			utils.Error(w, http.StatusInternalServerError, utils.CodeInternal, "Failed to begin transaction")
+			return
+		}
+		defer tx.Rollback()
+
+		before, ok := loadForLifecycle(ctx, w, tx, kind, id)
+		if !ok {
+			return
+		}
+		if kind.restorable != nil {
+			reason, err := kind.restorable(ctx, tx, id)
+			if err != nil {
+				utils.Error(w, http.StatusInternalServerError, utils.CodeInternal, fmt.Sprintf("Failed to check %s", kind.entity))
+				return
+			}
+			if reason != "" {
+				utils.Error(w, http.StatusConflict, utils.CodeInvalidState, reason)
+				return
+			}
+		}
+
+		// Restore the row, provided it is deleted
+		result, err := tx.ExecContext(ctx, fmt.Sprintf(`UPDATE %s SET deleted_at=NULL, version=version+1 WHERE id=? AND deleted_at IS NOT NULL`, kind.table), id)
+		if err != nil {
+			utils.Error(w, http.StatusInternalServerError, utils.CodeInternal, fmt.Sprintf("Failed to restore %s", kind.entity))
+			return
+		}
+		if n, err := result.RowsAffected(); err != nil || n == 0 {
+			utils.Error(w, http.StatusConflict, utils.CodeInvalidState, fmt.Sprintf("The %s has not been deleted", kind.entity))
+			return
+		}
+
+		// Record the change
+		after, err := kind.load(ctx, tx, id)
+		if err != nil {
+			utils.Error(w, http.StatusInternalServerError, utils.CodeInternal, fmt.Sprintf("Failed to retrieve %s", kind.entity))
+			return
+		}
+		err = audit.Record(r.Context(), tx, audit.Entry{Action: audit.ActionRestore, EntityType: kind.entity, EntityID: id, Before: before, After: after})
+		if err != nil {
+			utils.Error(w, http.StatusInternalServerError, utils.CodeInternal, "Failed to record audit log")
+			return
+		}
+
+		var version int
+		if err := tx.QueryRowContext(ctx, fmt.Sprintf(`SELECT version FROM %s WHERE id = ?`, kind.table), id).Scan(&version); err != nil {
+			utils.Error(w, http.StatusInternalServerError, utils.CodeInternal, fmt.Sprintf("Failed to retrieve %s", kind.entity))
+			return
+		}
+
+		// Commit the transaction
+		if err := tx.Commit(); err != nil {
+			utils.Error(w, http.StatusInternalServerError, utils.CodeInternal, "Failed to commit")
+			return
+		}
+
+		w.Header().Set("ETag", utils.VersionETag(version))
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// purge permanently removes a deleted row, reporting what was removed when cascade=true.
+func purge(db *sql.DB, kind softDeleted) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		id := mux.Vars(r)["id"]
+		if err := utils.ValidateUUID(id); err != nil {
+			utils.HandleLookupError(w, err)
+			return
+		}
+
+		// Begin transaction
+		tx, err := db.BeginTx(ctx, nil)
+		if err != nil {
+			utils.Error(w, http.StatusInternalServerError, utils.CodeInternal, "Failed to begin transaction")
+			return
+		}
+		defer tx.Rollback()
+
+		before, ok := loadForLifecycle(ctx, w, tx, kind, id)
+		if !ok {
+			return
+		}
+
+		// Only rows that have already been deleted can be purged
+		var deleted bool
+		if err := tx.QueryRowContext(ctx, fmt.Sprintf(`SELECT deleted_at IS NOT NULL FROM %s WHERE id = ? FOR UPDATE`, kind.table), id).Scan(&deleted); err != nil {
+			utils.Error(w, http.StatusInternalServerError, utils.CodeInternal, fmt.Sprintf("Failed to retrieve %s", kind.entity))
+			return
+		}
+		if !deleted {
+			utils.Error(w, http.StatusConflict, utils.CodeInvalidState, fmt.Sprintf("The %s must be deleted before it can be purged", kind.entity))
+			return
+		}
+
+		// The database removes every dependent application, deleted or not, so refuse unless asked to,
+		// and refuse in any case if those applications, or the purged one, have payments in the ledger
+		var applications []models.Application
+		ledgerColumn := "id"
+		if kind.dependentColumn != "" {
+			ledgerColumn = kind.dependentColumn
+			applications, err = dependentApplications(ctx, tx, kind.dependentColumn, id, true)
+			if err != nil {
+				utils.Error(w, http.StatusInternalServerError, utils.CodeInternal, "Failed to retrieve applications")
+				return
+			}
+		}
+		if !refuseLedger(ctx, w, tx, kind.entity, ledgerColumn, id, applications) {
+			return
+		}
+		if kind.dependentColumn != "" && !refuseDependents(w, r, kind.entity, applications) {
+			return
+		}
+
+		// Remove the row
+		_, err = tx.ExecContext(ctx, fmt.Sprintf(`DELETE FROM %s WHERE id=?`, kind.table), id)
+		if err != nil {
+			utils.Error(w, http.StatusInternalServerError, utils.CodeInternal, fmt.Sprintf("Failed to purge %s", kind.entity))
+			return
+		}
+
+		// Record the change
+		err = audit.Record(r.Context(), tx, audit.Entry{Action: audit.ActionPurge, EntityType: kind.entity, EntityID: id, Before: before})
+		if err != nil {
+			utils.Error(w, http.StatusInternalServerError, utils.CodeInternal, "Failed to record audit log")
+			return
+		}
+		removed := removal{kind.entity: {id}}
+		if kind.removed != nil {
+			for entity, ids := range kind.removed(before) {
+				removed[entity] = ids
+			}
+		}
+		if kind.dependentColumn != "" {
+			removed["application"], err = recordPurgedApplications(r.Context(), tx, applications)
+			if err != nil {
+				utils.Error(w, http.StatusInternalServerError, utils.CodeInternal, "Failed to record audit log")
+				return
+			}
+		}
+
+		if kind.purged != nil {
+			if err := kind.purged(ctx, tx); err != nil {
+				logging.FromContext(ctx).Error("cleaning up after purge failed", "entity", kind.entity, "id", id, "error", err)
+				utils.Error(w, http.StatusInternalServerError, utils.CodeInternal, "Failed to purge "+kind.entity)
+				return
+			}
+		}
+
+		// Commit the transaction
+		if err := tx.Commit(); err != nil {
+			utils.Error(w, http.StatusInternalServerError, utils.CodeInternal, "Failed to commit")
+			return
+		}
+
+		writeRemoval(w, r, removed)
+	}
+}
+
+// loadForLifecycle loads a row for restoring or purging, writing the error response if it cannot.
+func loadForLifecycle(ctx context.Context, w http.ResponseWriter, q queryer, kind softDeleted, id string) (interface{}, bool) {
+	entity, err := kind.load(ctx, q, id)
+	if err == sql.ErrNoRows {
+		utils.Error(w, http.StatusNotFound, utils.CodeNotFound, fmt.Sprintf("%s %v", kind.entity, utils.ErrNotFound))
+		return nil, false
+	}
+	if err != nil {
+		utils.Error(w, http.StatusInternalServerError, utils.CodeInternal, fmt.Sprintf("Failed to retrieve %s", kind.entity))
+		return nil, false
+	}
+	return entity, true
+}
@@ -0,0 +1,85 @@
+// Sets up structured logging, masking personal details and credentials wherever they are logged.
+package logging
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"strings"
+
+	"fas/internal/models"
+	"fas/internal/utils"
+)
+
+// redactedKeys are attribute keys whose values are never logged as they are.
+var redactedKeys = map[string]bool{
+	"date_of_birth": true,
+	"authorization": true,
+	"x-api-key":     true,
+	"api_key":       true,
+	"password":      true,
+	"token":         true,
+	"secret":        true,
+	"dsn":           true,
+	"bank_account":  true,
+}
+
+// New returns a logger writing JSON lines at or above the level, with personal details masked.
+func New(w io.Writer, level slog.Level) *slog.Logger {
+	return slog.New(slog.NewJSONHandler(w, &slog.HandlerOptions{Level: level, ReplaceAttr: redact}))
+}
+
+// Setup makes a logger writing to w the default, so that the log package writes through it too.
+func Setup(w io.Writer, level slog.Level) *slog.Logger {
+	logger := New(w, level)
+	slog.SetDefault(logger)
+	return logger
+}
+
+// FromContext returns the default logger annotated with the ID of the request the context belongs to.
+func FromContext(ctx context.Context) *slog.Logger {
+	if requestID := utils.RequestID(ctx); requestID != "" {
+		return slog.Default().With("request_id", requestID)
+	}
+	return slog.Default()
+}
+
+// redact masks sensitive attributes. Applicants and household members mask themselves through
+// their LogValue methods; this also covers slices of them and sensitive keys logged on their own.
+func redact(groups []string, attr slog.Attr) slog.Attr {
+	if redactedKeys[strings.ToLower(attr.Key)] {
+		if attr.Value.Kind() == slog.KindString && attr.Value.String() == "" {
+			return attr
+		}
+		return slog.String(attr.Key, "[REDACTED]")
+	}
+	if attr.Value.Kind() != slog.KindAny {
+		return attr
+	}
+
+	switch v := attr.Value.Any().(type) {
+	case []models.Applicant:
+		return slog.Any(attr.Key, logValues(v))
+	case []models.Household:
+		return slog.Any(attr.Key, logValues(v))
+	}
+	return attr
+}
+
+// logValues resolves each element of a slice to its masked log value.
+func logValues[T slog.LogValuer](items []T) []any {
+	values := make([]any, len(items))
+	for i, item := range items {
+		values[i] = attrMap(item.LogValue())
+	}
+	return values
+}
+
+// attrMap converts a group value to a map so that it can be encoded within a list.
+func attrMap(value slog.Value) map[string]any {
+	m := make(map[string]any)
+	for _, attr := range value.Group() {
+		m[attr.Key] = attr.Value.Any()
+	}
+	return m
+}
@@ -0,0 +1,51 @@
+// Declares the metrics of the service.
+package metrics
+
+import (
+	"database/sql"
+	"sync"
+)
+
+var (
+	// HTTPRequests counts requests by method, mux route template and status.
+	HTTPRequests = NewCounterVec("fas_http_requests_total",
+		"Number of HTTP requests served.", "method", "route", "status")
+	// HTTPDuration measures how long requests take to serve, by method and mux route template.
+	HTTPDuration = NewHistogramVec("fas_http_request_duration_seconds",
+		"Time taken to serve HTTP requests.", DefaultBuckets, "method", "route")
+	// EligibilityDuration measures how long the eligibility query takes.
+	EligibilityDuration = NewHistogramVec("fas_eligibility_query_duration_seconds",
+		"Time taken to query the schemes an applicant is eligible for.", DefaultBuckets)
+	// ApplicationsCreated counts applications by scheme.
+	ApplicationsCreated = NewCounterVec("fas_applications_created_total",
+		"Number of applications created.", "scheme_id")
+	// StatusTransitions counts changes to the status of applications by scheme.
+	StatusTransitions = NewCounterVec("fas_application_status_transitions_total",
+		"Number of changes to the status of applications.", "scheme_id", "from", "to")
+)
+
+var registerDBStats sync.Once
+
+// RegisterDBStats exposes the connection pool statistics of the database.
+func RegisterDBStats(db *sql.DB) {
+	registerDBStats.Do(func() {
+		NewGaugeFunc("fas_db_max_open_connections", "Maximum number of open connections to the database.",
+			func() float64 { return float64(db.Stats().MaxOpenConnections) })
+		NewGaugeFunc("fas_db_open_connections", "Number of established connections, both in use and idle.",
+			func() float64 { return float64(db.Stats().OpenConnections) })
+		NewGaugeFunc("fas_db_in_use_connections", "Number of connections currently in use.",
+			func() float64 { return float64(db.Stats().InUse) })
+		NewGaugeFunc("fas_db_idle_connections", "Number of idle connections.",
+			func() float64 { return float64(db.Stats().Idle) })
+		NewCounterFunc("fas_db_wait_count_total", "Number of connections waited for.",
+			func() float64 { return float64(db.Stats().WaitCount) })
+		NewCounterFunc("fas_db_wait_duration_seconds_total", "Time spent waiting for new connections.",
+			func() float64 { return db.Stats().WaitDuration.Seconds() })
+		NewCounterFunc("fas_db_max_idle_closed_total", "Number of connections closed due to SetMaxIdleConns.",
+			func() float64 { return float64(db.Stats().MaxIdleClosed) })
+		NewCounterFunc("fas_db_max_idle_time_closed_total", "Number of connections closed due to SetConnMaxIdleTime.",
+			func() float64 { return float64(db.Stats().MaxIdleTimeClosed) })
+		NewCounterFunc("fas_db_max_lifetime_closed_total", "Number of connections closed due to SetConnMaxLifetime.",
+			func() float64 { return float64(db.Stats().MaxLifetimeClosed) })
+	})
+}
@@ -0,0 +1,240 @@
+// Collects metrics and exposes them in the Prometheus text format.
+package metrics
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultBuckets are the upper bounds, in seconds, of the default latency histogram buckets.
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// collector writes its samples in the text format.
+type collector interface {
+	write(buf *bytes.Buffer)
+}
+
+// Registry holds the collectors exposed on an endpoint.
+type Registry struct {
+	mu         sync.Mutex
+	collectors []collector
+}
+
+// Default is the registry exposed by Handler.
+var Default = &Registry{}
+
+func (reg *Registry) register(c collector) {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	reg.collectors = append(reg.collectors, c)
+}
+
+// Handler serves every collector of the registry in the Prometheus text format.
+func (reg *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reg.mu.Lock()
+		collectors := append([]collector{}, reg.collectors...)
+		reg.mu.Unlock()
+
+		var buf bytes.Buffer
+		for _, c := range collectors {
+			c.write(&buf)
+		}
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		w.Write(buf.Bytes())
+	})
+}
+
+// Handler serves the default registry.
+func Handler() http.Handler {
+	return Default.Handler()
+}
+
+// series holds the label values of a sample, joined so that they can key a map.
+type series struct {
+	key    string
+	values []string
+}
+
+func newSeries(labels, values []string) series {
+	if len(values) != len(labels) {
+		panic(fmt.Sprintf("metrics: expected %d label values, got %d", len(labels), len(values)))
+	}
+	return series{key: strings.Join(values, "\xff"), values: values}
+}
+
+// CounterVec counts events, partitioned by labels.
+type CounterVec struct {
+	name, help string
+	labels     []string
+	mu         sync.Mutex
+	series     map[string]series
+	counts     map[string]float64
+}
+
+// NewCounterVec registers a counter with the default registry.
+func NewCounterVec(name, help string, labels ...string) *CounterVec {
+	c := &CounterVec{name: name, help: help, labels: labels, series: map[string]series{}, counts: map[string]float64{}}
+	Default.register(c)
+	return c
+}
+
+// Inc adds one to the count for the label values, given in the order of the labels.
+func (c *CounterVec) Inc(values ...string) {
+	s := newSeries(c.labels, values)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.series[s.key] = s
+	c.counts[s.key]++
+}
+
+func (c *CounterVec) write(buf *bytes.Buffer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	writeHeader(buf, c.name, c.help, "counter")
+	for _, key := range sortedKeys(c.series) {
+		writeSample(buf, c.name, c.labels, c.series[key].values, "", "", c.counts[key])
+	}
+}
+
+// HistogramVec counts observations into buckets, partitioned by labels.
+type HistogramVec struct {
+	name, help string
+	labels     []string
+	buckets    []float64
+	mu         sync.Mutex
+	series     map[string]series
+	histograms map[string]*histogram
+}
+
+type histogram struct {
+	counts []uint64 // per bucket, not cumulative; the last is for +Inf
+	sum    float64
+	count  uint64
+}
+
+// NewHistogramVec registers a histogram with the default registry. The buckets must be sorted.
+func NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	h := &HistogramVec{name: name, help: help, labels: labels, buckets: buckets,
+		series: map[string]series{}, histograms: map[string]*histogram{}}
+	Default.register(h)
+	return h
+}
+
+// Observe records a value for the label values, given in the order of the labels.
+func (h *HistogramVec) Observe(value float64, values ...string) {
+	s := newSeries(h.labels, values)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	hist, ok := h.histograms[s.key]
+	if !ok {
+		hist = &histogram{counts: make([]uint64, len(h.buckets)+1)}
+		h.series[s.key] = s
+		h.histograms[s.key] = hist
+	}
+	hist.counts[sort.SearchFloat64s(h.buckets, value)]++
+	hist.sum += value
+	hist.count++
+}
+
+func (h *HistogramVec) write(buf *bytes.Buffer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	writeHeader(buf, h.name, h.help, "histogram")
+	for _, key := range sortedKeys(h.series) {
+		values, hist := h.series[key].values, h.histograms[key]
+		var cumulative uint64
+		for i, bound := range h.buckets {
+			cumulative += hist.counts[i]
+			writeSample(buf, h.name+"_bucket", h.labels, values, "le", formatFloat(bound), float64(cumulative))
+		}
+		writeSample(buf, h.name+"_bucket", h.labels, values, "le", "+Inf", float64(hist.count))
+		writeSample(buf, h.name+"_sum", h.labels, values, "", "", hist.sum)
+		writeSample(buf, h.name+"_count", h.labels, values, "", "", float64(hist.count))
+	}
+}
+
+// GaugeFunc reports a value read when the metrics are collected.
+type GaugeFunc struct {
+	name, help, kind string
+	value            func() float64
+}
+
+// NewGaugeFunc registers a gauge with the default registry.
+func NewGaugeFunc(name, help string, value func() float64) *GaugeFunc {
+	g := &GaugeFunc{name: name, help: help, kind: "gauge", value: value}
+	Default.register(g)
+	return g
+}
+
+// NewCounterFunc registers a counter whose total is kept elsewhere, such as by database/sql.
+func NewCounterFunc(name, help string, value func() float64) *GaugeFunc {
+	g := &GaugeFunc{name: name, help: help, kind: "counter", value: value}
+	Default.register(g)
+	return g
+}
+
+func (g *GaugeFunc) write(buf *bytes.Buffer) {
+	writeHeader(buf, g.name, g.help, g.kind)
+	writeSample(buf, g.name, nil, nil, "", "", g.value())
+}
+
+func writeHeader(buf *bytes.Buffer, name, help, kind string) {
+	help = strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(help)
+	fmt.Fprintf(buf, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+// writeSample writes one sample line, with an extra label such as le when one is given.
+func writeSample(buf *bytes.Buffer, name string, labels, values []string, extraLabel, extraValue string, value float64) {
+	buf.WriteString(name)
+	if len(labels) > 0 || extraLabel != "" {
+		buf.WriteByte('{')
+		for i, label := range labels {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			fmt.Fprintf(buf, `%s="%s"`, label, escapeLabel(values[i]))
+		}
+		if extraLabel != "" {
+			if len(labels) > 0 {
+				buf.WriteByte(',')
+			}
+			fmt.Fprintf(buf, `%s="%s"`, extraLabel, extraValue)
+		}
+		buf.WriteByte('}')
+	}
+	buf.WriteByte(' ')
+	buf.WriteString(formatFloat(value))
+	buf.WriteByte('\n')
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabel(value string) string {
+	return labelEscaper.Replace(value)
+}
+
+func formatFloat(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+func sortedKeys(m map[string]series) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
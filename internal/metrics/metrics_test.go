@@ -0,0 +1,130 @@
+package metrics
+
+import (
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// scrape serves the registry as /metrics is served, returning the content type and body.
+func scrape(t *testing.T, reg *Registry) (string, string) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	reg.Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	body, err := io.ReadAll(rec.Result().Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return rec.Header().Get("Content-Type"), string(body)
+}
+
+func TestExposition(t *testing.T) {
+	counter := NewCounterVec("test_requests_total", "Requests, with a \\ and a\nnew line.", "method", "path")
+	counter.Inc("GET", "/x")
+	counter.Inc("GET", "/a\"b\\c\n")
+	counter.Inc("GET", "/x")
+
+	histogram := NewHistogramVec("test_duration_seconds", "Durations.", []float64{0.25, 0.5, 1}, "route")
+	for _, value := range []float64{0.125, 0.25, 0.375, 2} {
+		histogram.Observe(value, "/schemes")
+	}
+	histogram.Observe(0.5, "/applicants")
+
+	unlabelled := NewHistogramVec("test_query_seconds", "Queries.", []float64{0.5})
+	unlabelled.Observe(0.75)
+
+	gauge := NewGaugeFunc("test_connections", "Connections.", func() float64 { return 3 })
+	total := NewCounterFunc("test_waits_total", "Waits.", func() float64 { return 1.5 })
+
+	reg := &Registry{}
+	for _, c := range []collector{counter, histogram, unlabelled, gauge, total} {
+		reg.register(c)
+	}
+
+	contentType, body := scrape(t, reg)
+	if contentType != "text/plain; version=0.0.4; charset=utf-8" {
+		t.Errorf("Content-Type is %q", contentType)
+	}
+
+	want := `# HELP test_requests_total Requests, with a \\ and a\nnew line.
+# TYPE test_requests_total counter
+test_requests_total{method="GET",path="/a\"b\\c\n"} 1
+test_requests_total{method="GET",path="/x"} 2
+# HELP test_duration_seconds Durations.
+# TYPE test_duration_seconds histogram
+test_duration_seconds_bucket{route="/applicants",le="0.25"} 0
+test_duration_seconds_bucket{route="/applicants",le="0.5"} 1
+test_duration_seconds_bucket{route="/applicants",le="1"} 1
+test_duration_seconds_bucket{route="/applicants",le="+Inf"} 1
+test_duration_seconds_sum{route="/applicants"} 0.5
+test_duration_seconds_count{route="/applicants"} 1
+test_duration_seconds_bucket{route="/schemes",le="0.25"} 2
+test_duration_seconds_bucket{route="/schemes",le="0.5"} 3
+test_duration_seconds_bucket{route="/schemes",le="1"} 3
+test_duration_seconds_bucket{route="/schemes",le="+Inf"} 4
+test_duration_seconds_sum{route="/schemes"} 2.75
+test_duration_seconds_count{route="/schemes"} 4
+# HELP test_query_seconds Queries.
+# TYPE test_query_seconds histogram
+test_query_seconds_bucket{le="0.5"} 0
+test_query_seconds_bucket{le="+Inf"} 1
+test_query_seconds_sum 0.75
+test_query_seconds_count 1
+# HELP test_connections Connections.
+# TYPE test_connections gauge
+test_connections 3
+# HELP test_waits_total Waits.
+# TYPE test_waits_total counter
+test_waits_total 1.5
+`
+	if body != want {
+		t.Errorf("got\n%s\nwant\n%s", body, want)
+	}
+}
+
+func TestExpositionEmpty(t *testing.T) {
+	// A metric with no samples yet is still described
+	reg := &Registry{}
+	reg.register(NewCounterVec("test_unused_total", "Unused.", "label"))
+
+	_, body := scrape(t, reg)
+	if want := "# HELP test_unused_total Unused.\n# TYPE test_unused_total counter\n"; body != want {
+		t.Errorf("got %q, want %q", body, want)
+	}
+}
+
+func TestHandlerDescribesServiceMetrics(t *testing.T) {
+	_, body := scrape(t, Default)
+	lines := strings.Split(body, "\n")
+	for _, metric := range []struct{ name, kind string }{
+		{"fas_http_requests_total", "counter"},
+		{"fas_http_request_duration_seconds", "histogram"},
+		{"fas_eligibility_query_duration_seconds", "histogram"},
+		{"fas_applications_created_total", "counter"},
+		{"fas_application_status_transitions_total", "counter"},
+	} {
+		help, kind := "# HELP "+metric.name+" ", "# TYPE "+metric.name+" "+metric.kind
+		helpAt, kindAt := -1, -1
+		for i, line := range lines {
+			switch {
+			case strings.HasPrefix(line, help):
+				helpAt = i
+			case line == kind:
+				kindAt = i
+			}
+		}
+		if helpAt < 0 || kindAt != helpAt+1 {
+			t.Errorf("%s is not described by a HELP line followed by %q", metric.name, kind)
+		}
+	}
+}
+
+func TestSeriesLabelCount(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("a sample with the wrong number of label values was accepted")
+		}
+	}()
+	NewCounterVec("test_labels_total", "Labels.", "a", "b").Inc("only one")
+}
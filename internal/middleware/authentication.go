@@ -0,0 +1,58 @@
+// Handles authentication of administrators.
+package middleware
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strings"
+
+	"fas/internal/auth"
+	"fas/internal/utils"
+)
+
+// Authenticate requires every request to carry an API key or a signed JWT, either in the
+// X-API-Key header or as a bearer token, and stores the authenticated principal in the request context.
+func Authenticate(db *sql.DB, jwtSecret []byte) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			credential := r.Header.Get("X-API-Key")
+			if credential == "" {
+				if bearer := r.Header.Get("Authorization"); strings.HasPrefix(bearer, "Bearer ") {
+					credential = strings.TrimSpace(strings.TrimPrefix(bearer, "Bearer "))
+				}
+			}
+			if credential == "" {
+				unauthenticated(w, "Authentication is required")
+				return
+			}
+
+			var principal auth.Principal
+			var err error
+			switch {
+			case auth.IsAPIKey(credential):
+				principal, err = auth.AuthenticateAPIKey(r.Context(), db, credential)
+			case auth.IsJWT(credential):
+				principal, err = auth.AuthenticateJWT(credential, jwtSecret)
+			default:
+				err = auth.ErrInvalidCredentials
+			}
+			if errors.Is(err, auth.ErrInvalidCredentials) {
+				unauthenticated(w, err.Error())
+				return
+			}
+			if err != nil {
+				utils.Error(w, http.StatusInternalServerError, utils.CodeInternal, "Failed to authenticate")
+				return
+			}
+
+			next.ServeHTTP(w, r.WithContext(auth.WithPrincipal(r.Context(), principal)))
+		})
+	}
+}
+
+// unauthenticated writes a 401 response inviting the client to authenticate.
+func unauthenticated(w http.ResponseWriter, message string) {
+	w.Header().Set("WWW-Authenticate", `Bearer realm="fas"`)
+	utils.Error(w, http.StatusUnauthorized, utils.CodeUnauthenticated, message)
+}
@@ -0,0 +1,40 @@
+// Handles role-based access control.
+package middleware
+
+import (
+	"net/http"
+
+	"fas/internal/auth"
+	"fas/internal/logging"
+	"fas/internal/utils"
+)
+
+// Authorize only lets the request through to the handler if the principal holds the permission.
+// Denials are logged.
+func Authorize(permission auth.Permission, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		principal, ok := auth.PrincipalFrom(r.Context())
+		if !ok {
+			unauthenticated(w, "Authentication is required")
+			return
+		}
+		if !principal.Can(permission) {
+			Forbidden(w, r, permission)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Forbidden logs the denial of a permission and writes a 403 response.
+func Forbidden(w http.ResponseWriter, r *http.Request, permission auth.Permission) {
+	principal, _ := auth.PrincipalFrom(r.Context())
+	logging.FromContext(r.Context()).Warn("authorization denied",
+		"principal", principal.ID, "roles", principal.Roles, "permission", permission, "method", r.Method, "path", r.URL.Path)
+
+	utils.WriteError(w, http.StatusForbidden, utils.APIError{
+		Code:    utils.CodeForbidden,
+		Message: "You do not have permission to perform this action",
+		Details: map[string]auth.Permission{"required_permission": permission},
+	})
+}
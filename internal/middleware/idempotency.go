@@ -0,0 +1,210 @@
+// Handles idempotency keys for POST requests.
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+
+	"fas/internal/auth"
+	"fas/internal/utils"
+)
+
+const (
+	idempotencyHeader = "Idempotency-Key"
+	maxIdempotencyKey = 255
+	idempotencyTTL    = 24 * time.Hour
+)
+
+// Idempotency lets clients safely retry POST requests by sending an Idempotency-Key header.
+// The first response for a key is stored and replayed for repeats of the same request,
+// while a key reused with a different request is rejected. Responses marked Cache-Control: no-store
+// are replayed with their status and Location but without their body.
+func Idempotency(db *sql.DB) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := r.Header.Get(idempotencyHeader)
+			if r.Method != http.MethodPost || key == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if len(key) > maxIdempotencyKey {
+				utils.WriteError(w, http.StatusBadRequest, utils.APIError{Code: utils.CodeInvalidValue,
+					Field: idempotencyHeader, Message: "Idempotency-Key must be at most 255 characters"})
+				return
+			}
+
+			body, err := io.ReadAll(r.Body)
+			if err != nil {
+				utils.Error(w, http.StatusBadRequest, utils.CodeInvalidRequest, "could not read request body")
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewBuffer(body))
+			owner, fingerprint := keyOwner(r), requestFingerprint(r, body)
+
+			// Claim the key, or find the request that claimed it first
+			claimed, err := claimIdempotencyKey(r.Context(), db, owner, key, fingerprint)
+			if err != nil {
+				utils.Error(w, http.StatusInternalServerError, utils.CodeInternal, "Failed to record idempotency key")
+				return
+			}
+			if !claimed {
+				replayIdempotentResponse(r.Context(), db, w, owner, key, fingerprint)
+				return
+			}
+
+			recorder := &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+			next.ServeHTTP(recorder, r)
+
+			// The key is settled even if the request timed out or the client went away
+			ctx := context.WithoutCancel(r.Context())
+
+			// Server errors are not stored so that the client can retry them
+			if recorder.status >= http.StatusInternalServerError {
+				db.ExecContext(ctx, `DELETE FROM idempotency_keys WHERE principal = ? AND idempotency_key = ?`, owner, key)
+				return
+			}
+
+			// A response that must not be stored, such as one holding a new secret, is kept without its body
+			stored, body := storedHeaders(recorder.Header()), recorder.body.Bytes()
+			if noStore(recorder.Header()) {
+				stored, body = locationHeader(stored), nil
+			}
+			headers, _ := json.Marshal(stored)
+			db.ExecContext(ctx, `UPDATE idempotency_keys SET status_code = ?, response_headers = ?, response_body = ?
+				WHERE principal = ? AND idempotency_key = ?`,
+				recorder.status, headers, body, owner, key)
+		})
+	}
+}
+
+// keyOwner identifies the principal making a request, whose idempotency keys are kept apart from everyone else's.
+func keyOwner(r *http.Request) string {
+	principal, _ := auth.PrincipalFrom(r.Context())
+	return principal.Method + ":" + principal.ID
+}
+
+// requestFingerprint identifies a request by its principal, method, path and body,
+// so that one principal's key can never replay another principal's response.
+func requestFingerprint(r *http.Request, body []byte) string {
+	hash := sha256.New()
+	hash.Write([]byte(keyOwner(r) + "\n"))
+	hash.Write([]byte(r.Method + " " + r.URL.Path + "\n"))
+	hash.Write(body)
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// claimIdempotencyKey records the principal's key as in progress, reporting false if the principal has already used it.
+func claimIdempotencyKey(ctx context.Context, db *sql.DB, owner, key, fingerprint string) (bool, error) {
+	// Keys expire so that they can eventually be reused
+	_, err := db.ExecContext(ctx, `DELETE FROM idempotency_keys WHERE principal = ? AND idempotency_key = ? AND created_at < ?`,
+		owner, key, time.Now().Add(-idempotencyTTL))
+	if err != nil {
+		return false, err
+	}
+
+	_, err = db.ExecContext(ctx, `INSERT INTO idempotency_keys (principal, idempotency_key, request_hash, created_at) VALUES (?, ?, ?, ?)`,
+		owner, key, fingerprint, time.Now())
+	if mysqlErr, ok := err.(*mysql.MySQLError); ok && mysqlErr.Number == 1062 {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// replayIdempotentResponse writes the stored response for a key that the principal has already used.
+func replayIdempotentResponse(ctx context.Context, db *sql.DB, w http.ResponseWriter, owner, key, fingerprint string) {
+	var (
+		requestHash string
+		status      sql.NullInt64
+		headers     []byte
+		body        []byte
+	)
+	err := db.QueryRowContext(ctx, `SELECT request_hash, status_code, response_headers, response_body
+		FROM idempotency_keys WHERE principal = ? AND idempotency_key = ?`, owner, key).Scan(&requestHash, &status, &headers, &body)
+	if err != nil {
+		utils.Error(w, http.StatusInternalServerError, utils.CodeInternal, "Failed to retrieve idempotency key")
+		return
+	}
+
+	if requestHash != fingerprint {
+		utils.Error(w, http.StatusUnprocessableEntity, utils.CodeIdempotencyMismatch, "Idempotency-Key has already been used for a different request")
+		return
+	}
+	if !status.Valid {
+		utils.Error(w, http.StatusConflict, utils.CodeRequestInProgress, "A request with this Idempotency-Key is still being processed")
+		return
+	}
+
+	var stored http.Header
+	if err := json.Unmarshal(headers, &stored); err == nil {
+		for name, values := range stored {
+			w.Header()[name] = values
+		}
+	}
+	w.Header().Set("Idempotent-Replayed", "true")
+	w.WriteHeader(int(status.Int64))
+	w.Write(body)
+}
+
+// storedHeaders returns the response headers worth replaying.
+func storedHeaders(header http.Header) http.Header {
+	stored := http.Header{}
+	for _, name := range []string{"Content-Type", "ETag", "Location"} {
+		if values, ok := header[name]; ok {
+			stored[name] = values
+		}
+	}
+	return stored
+}
+
+// noStore reports whether a response has Cache-Control: no-store.
+func noStore(header http.Header) bool {
+	for _, value := range header.Values("Cache-Control") {
+		for _, directive := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(directive), "no-store") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// locationHeader keeps only the Location of the stored headers.
+func locationHeader(header http.Header) http.Header {
+	stored := http.Header{}
+	if values, ok := header["Location"]; ok {
+		stored["Location"] = values
+	}
+	return stored
+}
+
+// responseRecorder passes a response through while keeping a copy of its status and body.
+type responseRecorder struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+	body        bytes.Buffer
+}
+
+func (rec *responseRecorder) WriteHeader(status int) {
+	if !rec.wroteHeader {
+		rec.status = status
+		rec.wroteHeader = true
+	}
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *responseRecorder) Write(b []byte) (int, error) {
+	rec.wroteHeader = true
+	rec.body.Write(b)
+	return rec.ResponseWriter.Write(b)
+}
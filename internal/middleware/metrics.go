@@ -0,0 +1,23 @@
+// Handles request metrics.
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"fas/internal/metrics"
+)
+
+// Metrics counts every request and measures its latency, by method and route template.
+func Metrics(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(sw, r)
+
+		route := RouteTemplate(r)
+		metrics.HTTPRequests.Inc(r.Method, route, strconv.Itoa(sw.status))
+		metrics.HTTPDuration.Observe(time.Since(start).Seconds(), r.Method, route)
+	})
+}
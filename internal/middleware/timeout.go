@@ -0,0 +1,54 @@
+// Handles request deadlines.
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"fas/internal/utils"
+)
+
+// Timeout gives each request a deadline, which the handlers pass on to their database calls.
+// A server error written after the deadline has passed or the client has gone away is replaced
+// with 504 Gateway Timeout or 503 Service Unavailable, so clients can tell it apart from other failures.
+func Timeout(d time.Duration) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx, cancel := context.WithTimeout(r.Context(), d)
+			defer cancel()
+
+			next.ServeHTTP(&timeoutWriter{ResponseWriter: w, ctx: ctx}, r.WithContext(ctx))
+		})
+	}
+}
+
+// timeoutWriter rewrites server errors caused by the request's context ending.
+type timeoutWriter struct {
+	http.ResponseWriter
+	ctx         context.Context
+	wroteHeader bool
+	discard     bool
+}
+
+func (tw *timeoutWriter) WriteHeader(status int) {
+	if tw.wroteHeader {
+		return
+	}
+	tw.wroteHeader = true
+	if status >= http.StatusInternalServerError && utils.HandleContextError(tw.ResponseWriter, tw.ctx.Err()) {
+		tw.discard = true
+		return
+	}
+	tw.ResponseWriter.WriteHeader(status)
+}
+
+func (tw *timeoutWriter) Write(b []byte) (int, error) {
+	if !tw.wroteHeader {
+		tw.WriteHeader(http.StatusOK)
+	}
+	if tw.discard {
+		return len(b), nil
+	}
+	return tw.ResponseWriter.Write(b)
+}
@@ -0,0 +1,14 @@
+// Contains the structure of the entities involved.
+package models
+
+type APIKey struct {
+	ID         string  `json:"id"`
+	Name       string  `json:"name"`
+	Prefix     string  `json:"prefix"`
+	Role       string  `json:"role"`
+	CreatedBy  string  `json:"created_by"`
+	CreatedAt  string  `json:"created_at"`
+	LastUsedAt *string `json:"last_used_at"`
+	RevokedAt  *string `json:"revoked_at"`
+	Key        string  `json:"key,omitempty"`
+}
@@ -1,6 +1,11 @@
 // Contains the structure of the entities involved.
 package models
 
+import (
+	"log/slog"
+	"strings"
+)
+
 type Applicant struct {
 	ID               string      `json:"id"`
 	Name             string      `json:"name"`
@@ -9,6 +14,9 @@ type Applicant struct {
 	Sex			     string      `json:"sex"`
 	DateOfBirth      string      `json:"date_of_birth"`
 	Household       []Household  `json:"household"`
+	BankAccount     *BankAccount `json:"bank_account,omitempty"`
+	Version          int         `json:"version"`
+	DeletedAt        *string     `json:"deleted_at,omitempty"`
 }
 
 type Household struct {
@@ -20,4 +28,56 @@ type Household struct {
 	SchoolLevel      string      `json:"school_level"`
 	EmploymentStatus string      `json:"employment_status"`
 	DateOfBirth      string      `json:"date_of_birth"`
-}
\ No newline at end of file
+}
+
+// BankAccount is the account an applicant is paid into. Number is an IBAN or a local account number,
+// and BIC identifies the bank, which some countries' payments do without.
+type BankAccount struct {
+	Holder string `json:"holder"`
+	Number string `json:"number"`
+	BIC    string `json:"bic,omitempty"`
+}
+
+// LogValue masks the personal details of an applicant wherever the applicant is logged.
+func (a Applicant) LogValue() slog.Value {
+	return slog.GroupValue(
+		slog.String("id", a.ID),
+		slog.String("name", MaskName(a.Name)),
+		slog.String("date_of_birth", MaskDate(a.DateOfBirth)),
+		slog.Int("household_size", len(a.Household)),
+		slog.Int("version", a.Version),
+	)
+}
+
+// LogValue masks the personal details of a household member wherever the member is logged.
+func (h Household) LogValue() slog.Value {
+	return slog.GroupValue(
+		slog.String("id", h.ID),
+		slog.String("applicant_id", h.ApplicantID),
+		slog.String("name", MaskName(h.Name)),
+		slog.String("relationship", h.Relationship),
+		slog.String("date_of_birth", MaskDate(h.DateOfBirth)),
+	)
+}
+
+// IsChild reports whether the household member is the applicant's son or daughter, in any case,
+// as MySQL compares the relationship when it checks eligibility.
+func (h Household) IsChild() bool {
+	return strings.EqualFold(h.Relationship, "son") || strings.EqualFold(h.Relationship, "daughter")
+}
+
+// MaskName keeps only the first letter of a name.
+func MaskName(name string) string {
+	for _, r := range name {
+		return string(r) + "***"
+	}
+	return ""
+}
+
+// MaskDate hides a date entirely, keeping only whether one was given.
+func MaskDate(date string) string {
+	if date == "" {
+		return ""
+	}
+	return "****-**-**"
+}
@@ -1,10 +1,52 @@
 // Contains the structure of the entities involved.
 package models
 
+import "fas/internal/money"
+
 type Application struct {
 	ID          string `json:"id"`
 	ApplicantID string `json:"applicant_id"`
 	SchemeID    string `json:"scheme_id"`
 	Status      string `json:"status"`
 	AppliedDate string `json:"applied_date"`
+	Entitlements []Entitlement `json:"entitlements,omitempty"`
+	TotalEntitlement map[string]money.Amount `json:"total_entitlement,omitempty"`
+	Version     int     `json:"version"`
+	DeletedAt   *string `json:"deleted_at,omitempty"`
+}
+
+// Statuses of an application. StatusApproved is the status of an application whose entitlement has been granted.
+const (
+	StatusPending   = "Pending"
+	StatusApproved  = "Approved"
+	StatusRejected  = "Rejected"
+	StatusWithdrawn = "Withdrawn"
+)
+
+// ApplicationStatuses lists every status of an application.
+var ApplicationStatuses = []string{StatusPending, StatusApproved, StatusRejected, StatusWithdrawn}
+
+// Entitlement is what an applicant receives from one benefit of a scheme, as computed for their household.
+type Entitlement struct {
+	BenefitID     string       `json:"benefit_id"`
+	Name          string       `json:"name"`
+	Type          string       `json:"type"`
+	Amount        money.Amount `json:"amount"`
+	AmountFormula string       `json:"amount_formula,omitempty"`
+	Currency      string       `json:"currency"`
+	Frequency     string       `json:"frequency"`
+	Payments      int          `json:"payments"`
+	Total         money.Amount `json:"total"`
+}
+
+// TotalEntitlements returns the value of the entitlements together, in each of their currencies.
+func TotalEntitlements(entitlements []Entitlement) map[string]money.Amount {
+	if len(entitlements) == 0 {
+		return nil
+	}
+	totals := make(map[string]money.Amount)
+	for _, e := range entitlements {
+		totals[e.Currency] = totals[e.Currency].Add(e.Total)
+	}
+	return totals
 }
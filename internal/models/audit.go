@@ -0,0 +1,17 @@
+// Contains the structure of the entities involved.
+package models
+
+import "encoding/json"
+
+type AuditEntry struct {
+	ID         string          `json:"id"`
+	Actor      string          `json:"actor"`
+	ActorName  string          `json:"actor_name"`
+	Action     string          `json:"action"`
+	EntityType string          `json:"entity_type"`
+	EntityID   string          `json:"entity_id"`
+	RequestID  string          `json:"request_id"`
+	Before     json.RawMessage `json:"before"`
+	After      json.RawMessage `json:"after"`
+	CreatedAt  string          `json:"created_at"`
+}
@@ -0,0 +1,67 @@
+// Contains the structure of the entities involved.
+package models
+
+import "fas/internal/money"
+
+// Disbursement is one payment of a benefit to an approved applicant, as recorded in the ledger.
+type Disbursement struct {
+	ID            string       `json:"id"`
+	ApplicationID string       `json:"application_id"`
+	ApplicantID   string       `json:"applicant_id"`
+	SchemeID      string       `json:"scheme_id"`
+	BenefitID     string       `json:"benefit_id"`
+	Name          string       `json:"name"`
+	Installment   int          `json:"installment"`
+	Amount        money.Amount `json:"amount"`
+	Currency      string       `json:"currency"`
+	DueDate       string       `json:"due_date"`
+	Status        string       `json:"status"`
+	Reference     *string      `json:"reference,omitempty"`
+	PaidAt        *string      `json:"paid_at,omitempty"`
+	BatchID       *string      `json:"batch_id,omitempty"`
+	Version       int          `json:"version"`
+}
+
+// States of a disbursement.
+const (
+	DisbursementScheduled = "scheduled"
+	DisbursementSubmitted = "submitted"
+	DisbursementPaid      = "paid"
+	DisbursementFailed    = "failed"
+	DisbursementReversed  = "reversed"
+	DisbursementCancelled = "cancelled"
+)
+
+// DisbursementStatuses lists every state of a disbursement.
+var DisbursementStatuses = []string{DisbursementScheduled, DisbursementSubmitted, DisbursementPaid, DisbursementFailed, DisbursementReversed,
+	DisbursementCancelled}
+
+// DisbursementTotal adds up the disbursements of a scheme or an applicant in one currency, by state.
+type DisbursementTotal struct {
+	SchemeID    string       `json:"scheme_id,omitempty"`
+	ApplicantID string       `json:"applicant_id,omitempty"`
+	Currency    string       `json:"currency"`
+	Scheduled   money.Amount `json:"scheduled"`
+	Submitted   money.Amount `json:"submitted"`
+	Paid        money.Amount `json:"paid"`
+	Failed      money.Amount `json:"failed"`
+	Reversed    money.Amount `json:"reversed"`
+	Cancelled   money.Amount `json:"cancelled"`
+}
+
+// PaymentBatch is a bank file in which due disbursements were submitted for payment. The file itself is kept
+// with the batch and can be downloaded again; its checksum is the SHA-256 of its content, in hexadecimal.
+type PaymentBatch struct {
+	ID            string       `json:"id"`
+	Format        string       `json:"format"`
+	Currency      string       `json:"currency"`
+	ExecutionDate string       `json:"execution_date"`
+	FileName      string       `json:"file_name"`
+	Checksum      string       `json:"checksum"`
+	Payments      int          `json:"payments"`
+	Total         money.Amount `json:"total"`
+	CreatedAt     string       `json:"created_at"`
+	// Skipped counts the due disbursements left out for want of a bank account. It is only reported when
+	// the batch is created.
+	Skipped int `json:"skipped,omitempty"`
+}
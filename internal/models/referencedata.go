@@ -0,0 +1,11 @@
+// Contains the structure of the entities involved.
+package models
+
+type ReferenceData struct {
+	ID        string `json:"id"`
+	Category  string `json:"category"`
+	Value     string `json:"value"`
+	Label     string `json:"label"`
+	SortOrder int    `json:"sort_order"`
+	Active    bool   `json:"active"`
+}
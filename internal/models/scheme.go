@@ -1,11 +1,16 @@
 // Contains the structure of the entities involved.
 package models
 
+import "fas/internal/money"
+
 type Scheme struct {
 	ID   string `json:"id"`
 	Name string `json:"name"`
 	Criteria []Criteria `json:"criteria,omitempty"`
 	Benefits []Benefit `json:"benefits,omitempty"`
+	TotalEntitlement map[string]money.Amount `json:"total_entitlement,omitempty"`
+	Version int `json:"version"`
+	DeletedAt *string `json:"deleted_at,omitempty"`
 }
 
 type Criteria struct {
@@ -18,5 +23,88 @@ type Criteria struct {
 type Benefit struct {
 	ID string `json:"id"`
 	Name string `json:"name"`
-	Amount float64 `json:"amount"`
-}
\ No newline at end of file
+	Amount money.Amount `json:"amount"`
+	AmountFormula string `json:"amount_formula,omitempty"`
+	Currency string `json:"currency"`
+	Type string `json:"type"`
+	Frequency string `json:"frequency"`
+	Duration int `json:"duration"`
+	Total *money.Amount `json:"total,omitempty"`
+	Catalogue bool `json:"catalogue"`
+	Version int `json:"version,omitempty"`
+}
+
+// Defaults of the benefits given without a type or frequency.
+const (
+	DefaultBenefitType = "cash"
+	FrequencyOneOff    = "one_off"
+)
+
+// Frequencies at which a recurring benefit is paid.
+const (
+	FrequencyWeekly   = "weekly"
+	FrequencyMonthly  = "monthly"
+	FrequencyAnnually = "annually"
+)
+
+// Frequencies lists every frequency that disbursements can be scheduled at. The benefit_frequency
+// reference data may offer fewer of them, but no others.
+var Frequencies = []string{FrequencyOneOff, FrequencyWeekly, FrequencyMonthly, FrequencyAnnually}
+
+// Payments returns how many times the benefit is paid: once if it is one-off, otherwise once per period of its duration.
+func (b Benefit) Payments() int {
+	if b.Frequency == FrequencyOneOff || b.Duration < 1 {
+		return 1
+	}
+	return b.Duration
+}
+
+// Fixed reports whether the benefit pays its amount, rather than an amount computed by its formula for each household.
+func (b Benefit) Fixed() bool {
+	return b.AmountFormula == ""
+}
+
+// Entitlement returns the value of every payment of the benefit together, each paying the given amount.
+func (b Benefit) Entitlement(amount money.Amount) money.Amount {
+	return amount.Mul(int64(b.Payments()))
+}
+
+// FixedTotal returns the value of every payment of a benefit with a fixed amount, or nil if the amount depends on a formula.
+func (b Benefit) FixedTotal() *money.Amount {
+	if !b.Fixed() {
+		return nil
+	}
+	total := b.Entitlement(b.Amount)
+	return &total
+}
+
+// TotalEntitlement returns the value of all the benefits with fixed amounts together, in each of their currencies.
+func TotalEntitlement(benefits []Benefit) map[string]money.Amount {
+	totals := make(map[string]money.Amount)
+	for _, b := range benefits {
+		if b.Fixed() {
+			totals[b.Currency] = totals[b.Currency].Add(b.Entitlement(b.Amount))
+		}
+	}
+	if len(totals) == 0 {
+		return nil
+	}
+	return totals
+}
+
+// Eligibility explains whether an applicant is eligible for a scheme, and what its benefits would pay them.
+type Eligibility struct {
+	SchemeID         string                  `json:"scheme_id"`
+	ApplicantID      string                  `json:"applicant_id"`
+	Eligible         bool                    `json:"eligible"`
+	Criteria         []CriterionResult       `json:"criteria"`
+	Entitlements     []Entitlement           `json:"entitlements"`
+	TotalEntitlement map[string]money.Amount `json:"total_entitlement,omitempty"`
+}
+
+// CriterionResult tells whether an applicant meets one criteria of a scheme, and why.
+type CriterionResult struct {
+	Criteria
+	Met    bool   `json:"met"`
+	Reason string `json:"reason"`
+}
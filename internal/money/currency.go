@@ -0,0 +1,26 @@
+// Lists the currencies amounts can be held in.
+package money
+
+import "strings"
+
+// currencies are the active ISO 4217 currency codes of the currencies divided into hundredths, which an Amount
+// holds exactly. Currencies with no minor unit, such as JPY, or with thousandths, such as KWD, are left out.
+var currencies = make(map[string]bool)
+
+func init() {
+	for _, code := range strings.Fields(`
+		AED AFN ALL AMD ANG AOA ARS AUD AWG AZN BAM BBD BDT BGN BMD BND BOB BRL BSD BTN BWP BYN BZD CAD CDF
+		CHF CNY COP CRC CUP CVE CZK DKK DOP DZD EGP ERN ETB EUR FJD FKP GBP GEL GHS GIP GMD GTQ GYD HKD HNL
+		HTG HUF IDR ILS INR IRR JMD KES KGS KHR KPW KYD KZT LAK LBP LKR LRD LSL MAD MDL MGA MKD MMK MNT MOP
+		MRU MUR MVR MWK MXN MYR MZN NAD NGN NIO NOK NPR NZD PAB PEN PGK PHP PKR PLN QAR RON RSD RUB SAR SBD
+		SCR SDG SEK SGD SHP SLE SOS SRD SSP STN SVC SYP SZL THB TJS TMT TOP TRY TTD TWD TZS UAH USD UYU UZS
+		VES WST XCD YER ZAR ZMW ZWG`) {
+		currencies[code] = true
+	}
+}
+
+// IsCurrency reports whether the code is an active ISO 4217 currency code, such as "SGD", of a currency
+// divided into hundredths.
+func IsCurrency(code string) bool {
+	return currencies[code]
+}
@@ -0,0 +1,189 @@
+// Represents sums of money exactly, as a whole number of hundredths, together with ISO 4217 currency codes.
+package money
+
+import (
+	"bytes"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// DefaultCurrency is the currency of amounts given without one.
+const DefaultCurrency = "SGD"
+
+// Max is the largest amount the DECIMAL(10, 2) amount columns hold.
+const Max Amount = 99_999_999_99
+
+var (
+	ErrInvalidAmount = errors.New("amount must be a decimal number with at most 2 decimal places")
+	ErrOutOfRange    = errors.New("amount is too large")
+)
+
+// Amount is a sum of money counted in hundredths of the currency unit, so that it adds up without rounding errors.
+// It is exchanged with the API as a decimal string such as "12.50", and with the database as a DECIMAL.
+type Amount int64
+
+// FromMinor returns the amount of the given number of hundredths.
+func FromMinor(units int64) Amount {
+	return Amount(units)
+}
+
+// Parse reads a decimal such as "12", "12.5" or "-0.05", of at most Max either side of zero.
+// Decimal places beyond the second must be zero.
+func Parse(s string) (Amount, error) {
+	amount, err := parse(s)
+	if err == nil && (amount > Max || amount < -Max) {
+		return 0, ErrOutOfRange
+	}
+	return amount, err
+}
+
+// parse reads a decimal of any size an Amount holds, such as a total the database adds up beyond Max.
+func parse(s string) (Amount, error) {
+	s = strings.TrimSpace(s)
+	negative := strings.HasPrefix(s, "-")
+	if negative || strings.HasPrefix(s, "+") {
+		s = s[1:]
+	}
+
+	whole, fraction, _ := strings.Cut(s, ".")
+	if whole == "" || !digits(whole) || !digits(fraction) {
+		return 0, ErrInvalidAmount
+	}
+	if len(fraction) > 2 {
+		if strings.Trim(fraction[2:], "0") != "" {
+			return 0, ErrInvalidAmount
+		}
+		fraction = fraction[:2]
+	}
+	fraction += strings.Repeat("0", 2-len(fraction))
+
+	units, err := strconv.ParseInt(whole, 10, 64)
+	if err != nil || units > math.MaxInt64/100-1 {
+		return 0, ErrOutOfRange
+	}
+	cents, _ := strconv.ParseInt(fraction, 10, 64)
+	amount := Amount(units*100 + cents)
+	if negative {
+		amount = -amount
+	}
+	return amount, nil
+}
+
+// digits reports whether the string only holds decimal digits.
+func digits(s string) bool {
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// Minor returns the amount as a number of hundredths.
+func (a Amount) Minor() int64 {
+	return int64(a)
+}
+
+// Add returns the sum of the amounts.
+func (a Amount) Add(b Amount) Amount {
+	return a + b
+}
+
+// Sub returns the difference of the amounts.
+func (a Amount) Sub(b Amount) Amount {
+	return a - b
+}
+
+// Mul returns the amount multiplied by a whole number.
+func (a Amount) Mul(n int64) Amount {
+	return a * Amount(n)
+}
+
+// Sum returns the total of the amounts.
+func Sum(amounts ...Amount) Amount {
+	var total Amount
+	for _, a := range amounts {
+		total += a
+	}
+	return total
+}
+
+// String formats the amount with exactly 2 decimal places.
+func (a Amount) String() string {
+	sign, units := "", int64(a)
+	if units < 0 {
+		sign, units = "-", -units
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, units/100, units%100)
+}
+
+// MarshalJSON writes the amount as a decimal string, which no client has to read as a float.
+func (a Amount) MarshalJSON() ([]byte, error) {
+	return json.Marshal(a.String())
+}
+
+// UnmarshalJSON reads the amount from a decimal string or a JSON number, using the number's exact digits.
+func (a *Amount) UnmarshalJSON(data []byte) error {
+	if bytes.Equal(data, []byte("null")) {
+		return nil
+	}
+	text := string(data)
+	if strings.HasPrefix(text, `"`) {
+		if err := json.Unmarshal(data, &text); err != nil {
+			return err
+		}
+	}
+	amount, err := Parse(text)
+	if err != nil {
+		return err
+	}
+	*a = amount
+	return nil
+}
+
+// Scan reads a DECIMAL column, including totals beyond Max. NULL is read as zero.
+func (a *Amount) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case nil:
+		*a = 0
+	case []byte:
+		return a.Scan(string(v))
+	case string:
+		amount, err := parse(v)
+		if err != nil {
+			return err
+		}
+		*a = amount
+	case int64:
+		*a = Amount(v * 100)
+	case float64:
+		*a = Amount(math.Round(v * 100))
+	default:
+		return fmt.Errorf("cannot scan %T into an amount", src)
+	}
+	return nil
+}
+
+// Value writes the amount as a decimal string, so that the database never sees it as a float.
+func (a Amount) Value() (driver.Value, error) {
+	return a.String(), nil
+}
+
+// FromRat rounds an exact rational number to the nearest hundredth, halves away from zero.
+func FromRat(r *big.Rat) (Amount, error) {
+	hundredths := new(big.Rat).Mul(r, big.NewRat(100, 1))
+	quotient, remainder := new(big.Int).QuoRem(hundredths.Num(), hundredths.Denom(), new(big.Int))
+	if remainder.Abs(remainder).Lsh(remainder, 1).Cmp(hundredths.Denom()) >= 0 {
+		quotient.Add(quotient, big.NewInt(int64(hundredths.Sign())))
+	}
+	if !quotient.IsInt64() {
+		return 0, ErrOutOfRange
+	}
+	return Amount(quotient.Int64()), nil
+}
@@ -0,0 +1,212 @@
+package money
+
+import (
+	"encoding/json"
+	"errors"
+	"math/big"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		s    string
+		want Amount
+	}{
+		{"0", 0},
+		{"12", 1200},
+		{"12.5", 1250},
+		{"12.50", 1250},
+		{"12.05", 1205},
+		{"0.01", 1},
+		{"-0.05", -5},
+		{"+7", 700},
+		{" 3.10 ", 310},
+		{"1.000", 100}, // places beyond the second may be zero
+		{"007.5", 750},
+		{"5.", 500},
+		{"99999999.99", Max},
+		{"-99999999.99", -Max},
+	}
+	for _, tt := range tests {
+		got, err := Parse(tt.s)
+		if err != nil {
+			t.Errorf("Parse(%q): %v", tt.s, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("Parse(%q) = %d, want %d", tt.s, got, tt.want)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		s    string
+		want error
+	}{
+		{"", ErrInvalidAmount},
+		{"-", ErrInvalidAmount},
+		{"+", ErrInvalidAmount},
+		{"-+5", ErrInvalidAmount},
+		{"+-5", ErrInvalidAmount},
+		{"--5", ErrInvalidAmount},
+		{"++5", ErrInvalidAmount},
+		{".5", ErrInvalidAmount},
+		{"1.005", ErrInvalidAmount},
+		{"1.2.3", ErrInvalidAmount},
+		{"1e3", ErrInvalidAmount},
+		{"12,50", ErrInvalidAmount},
+		{"- 5", ErrInvalidAmount},
+		{"abc", ErrInvalidAmount},
+		{"100000000", ErrOutOfRange},
+		{"99999999.991", ErrInvalidAmount},
+		{"100000000.00", ErrOutOfRange},
+		{"-100000000", ErrOutOfRange},
+		{"92233720368547758.07", ErrOutOfRange},
+		{"99999999999999999999999", ErrOutOfRange},
+	}
+	for _, tt := range tests {
+		_, err := Parse(tt.s)
+		if !errors.Is(err, tt.want) {
+			t.Errorf("Parse(%q) = %v, want %v", tt.s, err, tt.want)
+		}
+	}
+}
+
+func TestString(t *testing.T) {
+	tests := []struct {
+		amount Amount
+		want   string
+	}{
+		{0, "0.00"},
+		{1, "0.01"},
+		{10, "0.10"},
+		{1250, "12.50"},
+		{-5, "-0.05"},
+		{-1205, "-12.05"},
+		{Max, "99999999.99"},
+	}
+	for _, tt := range tests {
+		if got := tt.amount.String(); got != tt.want {
+			t.Errorf("Amount(%d).String() = %s, want %s", tt.amount, got, tt.want)
+		}
+		// Every amount reads back as itself
+		if back, err := Parse(tt.amount.String()); err != nil || back != tt.amount {
+			t.Errorf("Parse(%s) = %d, %v", tt.amount, back, err)
+		}
+	}
+}
+
+func TestFromRat(t *testing.T) {
+	tests := []struct {
+		r    *big.Rat
+		want Amount
+	}{
+		{big.NewRat(12, 1), 1200},
+		{big.NewRat(1, 3), 33},
+		{big.NewRat(2, 3), 67},
+		{big.NewRat(-2, 3), -67},
+		// Halves round away from zero
+		{big.NewRat(1, 200), 1},
+		{big.NewRat(-1, 200), -1},
+		{big.NewRat(25, 1000), 3},
+		{big.NewRat(-25, 1000), -3},
+		{big.NewRat(49, 10000), 0},
+		{big.NewRat(51, 10000), 1},
+		{new(big.Rat), 0},
+	}
+	for _, tt := range tests {
+		got, err := FromRat(tt.r)
+		if err != nil {
+			t.Errorf("FromRat(%s): %v", tt.r, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("FromRat(%s) = %s, want %s", tt.r, got, tt.want)
+		}
+	}
+
+	huge, _ := new(big.Rat).SetString("1e20")
+	if _, err := FromRat(huge); !errors.Is(err, ErrOutOfRange) {
+		t.Errorf("FromRat(1e20) = %v, want %v", err, ErrOutOfRange)
+	}
+}
+
+func TestJSON(t *testing.T) {
+	var v struct {
+		Amount Amount  `json:"amount"`
+		Total  *Amount `json:"total"`
+	}
+	// Strings and numbers are read from their exact digits
+	for _, body := range []string{`{"amount":"0.30","total":null}`, `{"amount":0.3}`, `{"amount":0.30}`} {
+		v.Amount, v.Total = 0, nil
+		if err := json.Unmarshal([]byte(body), &v); err != nil {
+			t.Errorf("Unmarshal(%s): %v", body, err)
+			continue
+		}
+		if v.Amount != 30 || v.Total != nil {
+			t.Errorf("Unmarshal(%s) = %d, %v", body, v.Amount, v.Total)
+		}
+	}
+	for _, body := range []string{`{"amount":"1.005"}`, `{"amount":1e2}`, `{"amount":"-+1"}`, `{"amount":100000000}`, `{"amount":true}`} {
+		if err := json.Unmarshal([]byte(body), &v); err == nil {
+			t.Errorf("Unmarshal(%s) was accepted", body)
+		}
+	}
+
+	data, err := json.Marshal(Amount(1250))
+	if err != nil || string(data) != `"12.50"` {
+		t.Errorf("Marshal = %s, %v", data, err)
+	}
+}
+
+func TestScan(t *testing.T) {
+	tests := []struct {
+		src  interface{}
+		want Amount
+	}{
+		{nil, 0},
+		{[]byte("12.50"), 1250},
+		{"0.05", 5},
+		{int64(3), 300},
+		{float64(0.29), 29},
+		// Totals the database adds up may exceed Max
+		{[]byte("1234567890123.45"), 123456789012345},
+	}
+	for _, tt := range tests {
+		var a Amount
+		if err := a.Scan(tt.src); err != nil {
+			t.Errorf("Scan(%v): %v", tt.src, err)
+			continue
+		}
+		if a != tt.want {
+			t.Errorf("Scan(%v) = %d, want %d", tt.src, a, tt.want)
+		}
+	}
+
+	var a Amount
+	if err := a.Scan(true); err == nil {
+		t.Error("a bool was scanned into an amount")
+	}
+}
+
+func TestIsCurrency(t *testing.T) {
+	tests := []struct {
+		code string
+		want bool
+	}{
+		{"SGD", true},
+		{"EUR", true},
+		{"USD", true},
+		{"sgd", false},
+		{"JPY", false}, // no minor unit
+		{"KWD", false}, // thousandths
+		{"XXX", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if got := IsCurrency(tt.code); got != tt.want {
+			t.Errorf("IsCurrency(%q) = %v, want %v", tt.code, got, tt.want)
+		}
+	}
+}
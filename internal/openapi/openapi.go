@@ -0,0 +1,632 @@
+// Describes the API as an OpenAPI 3 document, with the valid values of each enumeration taken from the reference data.
+package openapi
+
+import (
+	_ "embed"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"fas/internal/audit"
+	"fas/internal/auth"
+	"fas/internal/formula"
+	"fas/internal/models"
+	"fas/internal/money"
+	"fas/internal/payment"
+	"fas/internal/refdata"
+	"fas/internal/utils"
+	"fas/internal/validation"
+)
+
+// object is a JSON object of the document.
+type object = map[string]interface{}
+
+// operation describes a single route of the API.
+type operation struct {
+	Method     string
+	Path       string
+	Tag        string
+	Summary    string
+	Public     bool            // whether the route needs no authentication
+	Permission auth.Permission // the permission the route needs, if any besides authentication
+	Params     []string        // names of the parameters in components.parameters
+	Request    string          // schema of the request body, if any
+	Status     int             // status of a successful response
+	Response   string          // schema of the successful response; empty when there is no body, file for a payment file
+	List       bool            // whether the response is a list of Response
+}
+
+// operations lists every route the server registers. Keep it in step with the router.
+var operations = []operation{
+	// System
+	{Method: http.MethodGet, Path: "/healthz", Tag: "System", Public: true, Summary: "Report whether the server is running", Status: http.StatusOK, Response: "Health"},
+	{Method: http.MethodGet, Path: "/readyz", Tag: "System", Public: true, Summary: "Report whether the server can serve requests", Status: http.StatusOK, Response: "Health"},
+	{Method: http.MethodGet, Path: "/metrics", Tag: "System", Public: true, Summary: "Prometheus metrics", Status: http.StatusOK, Response: "text"},
+	{Method: http.MethodGet, Path: "/api/openapi.json", Tag: "System", Public: true, Summary: "This document", Status: http.StatusOK, Response: "any"},
+	{Method: http.MethodGet, Path: "/api/docs", Tag: "System", Public: true, Summary: "Interactive documentation of the API", Status: http.StatusOK, Response: "html"},
+
+	// Applicants
+	{Method: http.MethodPost, Path: "/api/applicants", Tag: "Applicants", Summary: "Create an applicant with their household members",
+		Permission: auth.PermApplicantsWrite, Params: []string{"Idempotency-Key"}, Request: "Applicant", Status: http.StatusCreated, Response: "Applicant"},
+	{Method: http.MethodGet, Path: "/api/applicants", Tag: "Applicants", Summary: "List applicants",
+		Permission: auth.PermApplicantsRead, Params: []string{"include_deleted", "If-None-Match"}, Status: http.StatusOK, Response: "Applicant", List: true},
+	{Method: http.MethodGet, Path: "/api/applicants/{id}", Tag: "Applicants", Summary: "Retrieve an applicant",
+		Permission: auth.PermApplicantsRead, Params: []string{"id", "include_deleted", "If-None-Match"}, Status: http.StatusOK, Response: "Applicant"},
+	{Method: http.MethodPut, Path: "/api/applicants/{id}", Tag: "Applicants", Summary: "Replace an applicant and their household members",
+		Permission: auth.PermApplicantsWrite, Params: []string{"id", "If-Match"}, Request: "Applicant", Status: http.StatusNoContent},
+	{Method: http.MethodDelete, Path: "/api/applicants/{id}", Tag: "Applicants", Summary: "Delete an applicant, so that it can still be restored",
+		Permission: auth.PermApplicantsWrite, Params: []string{"id", "If-Match", "cascade"}, Status: http.StatusNoContent},
+	{Method: http.MethodPost, Path: "/api/applicants/{id}/restore", Tag: "Applicants", Summary: "Restore a deleted applicant",
+		Permission: auth.PermApplicantsWrite, Params: []string{"id", "Idempotency-Key"}, Status: http.StatusNoContent},
+
+	// Schemes
+	{Method: http.MethodPost, Path: "/api/schemes", Tag: "Schemes", Summary: "Create a scheme with its criteria and benefits",
+		Permission: auth.PermSchemesWrite, Params: []string{"Idempotency-Key"}, Request: "Scheme", Status: http.StatusCreated, Response: "Scheme"},
+	{Method: http.MethodGet, Path: "/api/schemes", Tag: "Schemes", Summary: "List schemes",
+		Permission: auth.PermSchemesRead, Params: []string{"include_deleted", "If-None-Match"}, Status: http.StatusOK, Response: "Scheme", List: true},
+	{Method: http.MethodGet, Path: "/api/schemes/eligible", Tag: "Schemes", Summary: "List the schemes an applicant is eligible for",
+		Permission: auth.PermSchemesRead, Params: []string{"applicant"}, Status: http.StatusOK, Response: "Scheme", List: true},
+	{Method: http.MethodGet, Path: "/api/schemes/{id}/eligibility", Tag: "Schemes", Summary: "Explain whether an applicant is eligible for a scheme, and what its benefits would pay",
+		Permission: auth.PermSchemesRead, Params: []string{"id", "applicant", "If-None-Match"}, Status: http.StatusOK, Response: "Eligibility"},
+	{Method: http.MethodGet, Path: "/api/schemes/{id}", Tag: "Schemes", Summary: "Retrieve a scheme",
+		Permission: auth.PermSchemesRead, Params: []string{"id", "include_deleted", "If-None-Match"}, Status: http.StatusOK, Response: "Scheme"},
+	{Method: http.MethodPut, Path: "/api/schemes/{id}", Tag: "Schemes", Summary: "Replace a scheme with its criteria and benefits",
+		Permission: auth.PermSchemesWrite, Params: []string{"id", "If-Match"}, Request: "Scheme", Status: http.StatusNoContent},
+	{Method: http.MethodDelete, Path: "/api/schemes/{id}", Tag: "Schemes", Summary: "Delete a scheme, so that it can still be restored",
+		Permission: auth.PermSchemesWrite, Params: []string{"id", "If-Match", "cascade"}, Status: http.StatusNoContent},
+	{Method: http.MethodPost, Path: "/api/schemes/{id}/restore", Tag: "Schemes", Summary: "Restore a deleted scheme",
+		Permission: auth.PermSchemesWrite, Params: []string{"id", "Idempotency-Key"}, Status: http.StatusNoContent},
+	{Method: http.MethodPut, Path: "/api/schemes/{id}/criteria/{criteria_id}", Tag: "Schemes", Summary: "Attach an existing criteria to a scheme",
+		Permission: auth.PermSchemesWrite, Params: []string{"id", "criteria_id", "If-Match"}, Status: http.StatusNoContent},
+	{Method: http.MethodDelete, Path: "/api/schemes/{id}/criteria/{criteria_id}", Tag: "Schemes", Summary: "Detach a criteria from a scheme, removing it if no other scheme uses it",
+		Permission: auth.PermSchemesWrite, Params: []string{"id", "criteria_id", "If-Match"}, Status: http.StatusNoContent},
+
+	// Benefits
+	{Method: http.MethodPost, Path: "/api/benefits", Tag: "Benefits", Summary: "Add a benefit to the catalogue, from which schemes can link it by ID",
+		Permission: auth.PermSchemesWrite, Params: []string{"Idempotency-Key"}, Request: "Benefit", Status: http.StatusCreated, Response: "Benefit"},
+	{Method: http.MethodGet, Path: "/api/benefits", Tag: "Benefits", Summary: "List benefits, whether in the catalogue or added inline with a scheme",
+		Permission: auth.PermSchemesRead, Params: []string{"catalogue", "If-None-Match"}, Status: http.StatusOK, Response: "Benefit", List: true},
+	{Method: http.MethodGet, Path: "/api/benefits/{id}", Tag: "Benefits", Summary: "Retrieve a benefit",
+		Permission: auth.PermSchemesRead, Params: []string{"id", "If-None-Match"}, Status: http.StatusOK, Response: "Benefit"},
+	{Method: http.MethodPut, Path: "/api/benefits/{id}", Tag: "Benefits", Summary: "Change a benefit for every scheme that uses it, adding it to the catalogue",
+		Permission: auth.PermSchemesWrite, Params: []string{"id", "If-Match"}, Request: "Benefit", Status: http.StatusNoContent},
+	{Method: http.MethodDelete, Path: "/api/benefits/{id}", Tag: "Benefits", Summary: "Remove a benefit that no scheme uses",
+		Permission: auth.PermSchemesWrite, Params: []string{"id", "If-Match"}, Status: http.StatusNoContent},
+	{Method: http.MethodGet, Path: "/api/benefits/{id}/schemes", Tag: "Benefits", Summary: "List the schemes that use a benefit",
+		Permission: auth.PermSchemesRead, Params: []string{"id", "include_deleted", "If-None-Match"}, Status: http.StatusOK, Response: "Scheme", List: true},
+
+	// Criteria
+	{Method: http.MethodGet, Path: "/api/criteria-types", Tag: "Criteria", Summary: "List the criteria types with the levels and statuses each accepts",
+		Permission: auth.PermSchemesRead, Params: []string{"If-None-Match"}, Status: http.StatusOK, Response: "CriteriaRule", List: true},
+	{Method: http.MethodGet, Path: "/api/criteria", Tag: "Criteria", Summary: "List and search the criteria used by schemes",
+		Permission: auth.PermSchemesRead, Params: []string{"criteria_level", "criteria_type", "status", "If-None-Match"}, Status: http.StatusOK, Response: "Criteria", List: true},
+	{Method: http.MethodGet, Path: "/api/criteria/{id}", Tag: "Criteria", Summary: "Retrieve a criteria",
+		Permission: auth.PermSchemesRead, Params: []string{"id", "If-None-Match"}, Status: http.StatusOK, Response: "Criteria"},
+	{Method: http.MethodGet, Path: "/api/criteria/{id}/schemes", Tag: "Criteria", Summary: "List the schemes that use a criteria",
+		Permission: auth.PermSchemesRead, Params: []string{"id", "include_deleted", "If-None-Match"}, Status: http.StatusOK, Response: "Scheme", List: true},
+
+	// Applications
+	{Method: http.MethodPost, Path: "/api/applications", Tag: "Applications", Summary: "Apply for a scheme on behalf of an applicant",
+		Permission: auth.PermApplicationsWrite, Params: []string{"Idempotency-Key"}, Request: "Application", Status: http.StatusCreated, Response: "Application"},
+	{Method: http.MethodGet, Path: "/api/applications", Tag: "Applications", Summary: "List applications",
+		Permission: auth.PermApplicationsRead, Params: []string{"include_deleted", "If-None-Match"}, Status: http.StatusOK, Response: "Application", List: true},
+	{Method: http.MethodGet, Path: "/api/applications/{id}", Tag: "Applications", Summary: "Retrieve an application",
+		Permission: auth.PermApplicationsRead, Params: []string{"id", "include_deleted", "If-None-Match"}, Status: http.StatusOK, Response: "Application"},
+	{Method: http.MethodPut, Path: "/api/applications/{id}", Tag: "Applications", Summary: "Replace an application; changing its status needs applications:review",
+		Permission: auth.PermApplicationsWrite, Params: []string{"id", "If-Match"}, Request: "Application", Status: http.StatusNoContent},
+	{Method: http.MethodPatch, Path: "/api/applications/{id}", Tag: "Applications", Summary: "Review an application, changing only the fields given",
+		Permission: auth.PermApplicationsReview, Params: []string{"id", "If-Match"}, Request: "ApplicationPatch", Status: http.StatusNoContent},
+	{Method: http.MethodDelete, Path: "/api/applications/{id}", Tag: "Applications", Summary: "Delete an application, so that it can still be restored",
+		Permission: auth.PermApplicationsWrite, Params: []string{"id", "If-Match"}, Status: http.StatusNoContent},
+	{Method: http.MethodPost, Path: "/api/applications/{id}/restore", Tag: "Applications", Summary: "Restore a deleted application",
+		Permission: auth.PermApplicationsWrite, Params: []string{"id", "Idempotency-Key"}, Status: http.StatusNoContent},
+
+	// Disbursements
+	{Method: http.MethodGet, Path: "/api/applicants/{id}/disbursements", Tag: "Disbursements", Summary: "List the payments of an applicant in the order they fall due",
+		Permission: auth.PermDisbursementsRead, Params: []string{"id", "disbursement_status", "If-None-Match"}, Status: http.StatusOK, Response: "Disbursement", List: true},
+	{Method: http.MethodGet, Path: "/api/disbursements/totals", Tag: "Disbursements", Summary: "Add up the payments by state, per scheme or per applicant",
+		Permission: auth.PermDisbursementsRead, Params: []string{"by", "If-None-Match"}, Status: http.StatusOK, Response: "DisbursementTotal", List: true},
+	{Method: http.MethodGet, Path: "/api/disbursements/{id}", Tag: "Disbursements", Summary: "Retrieve a payment",
+		Permission: auth.PermDisbursementsRead, Params: []string{"id", "If-None-Match"}, Status: http.StatusOK, Response: "Disbursement"},
+	{Method: http.MethodPatch, Path: "/api/disbursements/{id}", Tag: "Disbursements", Summary: "Record that a payment was made, failed, was rescheduled, was cancelled or was reversed",
+		Permission: auth.PermDisbursementsWrite, Params: []string{"id", "If-Match"}, Request: "DisbursementPatch", Status: http.StatusNoContent},
+
+	// Payment batches
+	{Method: http.MethodPost, Path: "/api/payment-batches", Tag: "Payment batches", Summary: "Submit the due payments in a bank file",
+		Permission: auth.PermDisbursementsWrite, Params: []string{"Idempotency-Key"}, Request: "PaymentRun", Status: http.StatusCreated, Response: "PaymentBatch"},
+	{Method: http.MethodGet, Path: "/api/payment-batches", Tag: "Payment batches", Summary: "List payment batches, the most recent first",
+		Permission: auth.PermDisbursementsRead, Params: []string{"If-None-Match"}, Status: http.StatusOK, Response: "PaymentBatch", List: true},
+	{Method: http.MethodGet, Path: "/api/payment-batches/{id}", Tag: "Payment batches", Summary: "Retrieve a payment batch",
+		Permission: auth.PermDisbursementsRead, Params: []string{"id", "If-None-Match"}, Status: http.StatusOK, Response: "PaymentBatch"},
+	{Method: http.MethodGet, Path: "/api/payment-batches/{id}/file", Tag: "Payment batches", Summary: "Download the file of a payment batch again",
+		Permission: auth.PermDisbursementsRead, Params: []string{"id"}, Status: http.StatusOK, Response: "file"},
+
+	// Reference data
+	{Method: http.MethodGet, Path: "/api/reference-data", Tag: "Reference data", Summary: "List the reference data of every category",
+		Permission: auth.PermReferenceDataRead, Params: []string{"include_inactive", "If-None-Match"}, Status: http.StatusOK, Response: "ReferenceDataByCategory"},
+	{Method: http.MethodGet, Path: "/api/reference-data/{category}", Tag: "Reference data", Summary: "List the reference data of a category",
+		Permission: auth.PermReferenceDataRead, Params: []string{"category", "include_inactive", "If-None-Match"}, Status: http.StatusOK, Response: "ReferenceData", List: true},
+	{Method: http.MethodPost, Path: "/api/reference-data/{category}", Tag: "Reference data", Summary: "Add a value to a category",
+		Permission: auth.PermReferenceDataWrite, Params: []string{"category", "Idempotency-Key"}, Request: "ReferenceData", Status: http.StatusCreated, Response: "ReferenceData"},
+	{Method: http.MethodPut, Path: "/api/reference-data/{category}/{id}", Tag: "Reference data", Summary: "Change the label, order or activity of a value",
+		Permission: auth.PermReferenceDataWrite, Params: []string{"category", "id"}, Request: "ReferenceData", Status: http.StatusNoContent},
+	{Method: http.MethodDelete, Path: "/api/reference-data/{category}/{id}", Tag: "Reference data", Summary: "Remove a value from a category",
+		Permission: auth.PermReferenceDataWrite, Params: []string{"category", "id"}, Status: http.StatusNoContent},
+
+	// Current principal
+	{Method: http.MethodGet, Path: "/api/me/permissions", Tag: "Administration", Summary: "Show the authenticated principal and their permissions",
+		Status: http.StatusOK, Response: "PrincipalPermissions"},
+
+	// Administration
+	{Method: http.MethodGet, Path: "/api/admin/api-keys", Tag: "Administration", Summary: "List the API keys issued, without the keys themselves",
+		Permission: auth.PermAPIKeysManage, Status: http.StatusOK, Response: "APIKey", List: true},
+	{Method: http.MethodPost, Path: "/api/admin/api-keys", Tag: "Administration", Summary: "Issue an API key, which is only ever returned in this response",
+		Permission: auth.PermAPIKeysManage, Params: []string{"Idempotency-Key"}, Request: "APIKey", Status: http.StatusCreated, Response: "APIKey"},
+	{Method: http.MethodDelete, Path: "/api/admin/api-keys/{id}", Tag: "Administration", Summary: "Revoke an API key",
+		Permission: auth.PermAPIKeysManage, Params: []string{"id"}, Status: http.StatusNoContent},
+	{Method: http.MethodDelete, Path: "/api/admin/applicants/{id}", Tag: "Administration", Summary: "Permanently remove a deleted applicant",
+		Permission: auth.PermRecordsPurge, Params: []string{"id", "cascade"}, Status: http.StatusNoContent},
+	{Method: http.MethodDelete, Path: "/api/admin/schemes/{id}", Tag: "Administration", Summary: "Permanently remove a deleted scheme",
+		Permission: auth.PermRecordsPurge, Params: []string{"id", "cascade"}, Status: http.StatusNoContent},
+	{Method: http.MethodDelete, Path: "/api/admin/applications/{id}", Tag: "Administration", Summary: "Permanently remove a deleted application",
+		Permission: auth.PermRecordsPurge, Params: []string{"id"}, Status: http.StatusNoContent},
+
+	// Audit log
+	{Method: http.MethodGet, Path: "/api/audit", Tag: "Audit", Summary: "List audit log entries, newest first",
+		Permission: auth.PermAuditRead, Params: []string{"entity_type", "entity_id", "actor", "from", "to", "limit", "offset"}, Status: http.StatusOK, Response: "AuditEntry", List: true},
+}
+
+// Spec returns the OpenAPI document describing every route.
+func Spec() map[string]interface{} {
+	paths := object{}
+	for _, op := range operations {
+		item, ok := paths[op.Path].(object)
+		if !ok {
+			item = object{}
+			paths[op.Path] = item
+		}
+		item[strings.ToLower(op.Method)] = op.document()
+	}
+
+	return object{
+		"openapi": "3.0.3",
+		"info": object{
+			"title":       "Financial Assistance Scheme Management System",
+			"version":     "1.0.0",
+			"description": "Manages applicants, the schemes they may be eligible for, and their applications.",
+		},
+		"servers":  []object{{"url": "/"}},
+		"security": []object{{"apiKey": []string{}}, {"bearer": []string{}}},
+		"paths":    paths,
+		"components": object{
+			"securitySchemes": object{
+				"apiKey": object{"type": "apiKey", "in": "header", "name": "X-API-Key"},
+				"bearer": object{"type": "http", "scheme": "bearer", "bearerFormat": "JWT or API key"},
+			},
+			"parameters": parameters(),
+			"schemas":    schemas(),
+			"responses": object{
+				"Error": object{"description": "The request failed", "content": jsonContent(ref("Error"))},
+			},
+		},
+	}
+}
+
+// document builds the OpenAPI operation object.
+func (op operation) document() object {
+	doc := object{
+		"tags":        []string{op.Tag},
+		"summary":     op.Summary,
+		"operationId": strings.ToLower(op.Method) + strings.NewReplacer("/", "_", "{", "", "}", "", "-", "_", ".", "_").Replace(op.Path),
+	}
+
+	responses := object{}
+	success := object{"description": http.StatusText(op.Status)}
+	switch op.Response {
+	case "":
+	case "text":
+		success["content"] = object{"text/plain": object{"schema": object{"type": "string"}}}
+	case "html":
+		success["content"] = object{"text/html": object{"schema": object{"type": "string"}}}
+	case "file":
+		file := object{"schema": object{"type": "string", "format": "binary"}}
+		success["content"] = object{payment.ContentType(payment.FormatPain001): file, payment.ContentType(payment.FormatCSV): file}
+	case "any":
+		success["content"] = jsonContent(object{"type": "object"})
+	default:
+		schema := ref(op.Response)
+		if op.List {
+			schema = object{"type": "array", "items": schema}
+		}
+		success["content"] = jsonContent(schema)
+	}
+	responses[strconv.Itoa(op.Status)] = success
+	responses["default"] = ref("#/components/responses/Error")
+
+	var params []object
+	for _, name := range op.Params {
+		params = append(params, ref("#/components/parameters/"+name))
+		switch name {
+		case "cascade":
+			responses["200"] = object{"description": "Deleted along with the applications, listing the IDs of everything removed",
+				"content": jsonContent(ref("Removal"))}
+		case "If-None-Match":
+			responses["304"] = object{"description": "Not modified since the entity tag in If-None-Match"}
+		case "If-Match":
+			responses["412"] = ref("#/components/responses/Error")
+			responses["428"] = ref("#/components/responses/Error")
+		}
+	}
+	if len(params) > 0 {
+		doc["parameters"] = params
+	}
+	if op.Request != "" {
+		doc["requestBody"] = object{"required": true, "content": jsonContent(ref(op.Request))}
+	}
+
+	if op.Public {
+		doc["security"] = []object{}
+	} else {
+		// Authenticated routes are also subject to the query timeout
+		for _, status := range []string{"401", "503", "504"} {
+			responses[status] = ref("#/components/responses/Error")
+		}
+	}
+	if op.Permission != "" {
+		doc["description"] = "Requires the " + string(op.Permission) + " permission."
+		doc["x-permission"] = op.Permission
+		responses["403"] = ref("#/components/responses/Error")
+	}
+	doc["responses"] = responses
+	return doc
+}
+
+// ref refers to a schema by name, or to any other component by its full reference.
+func ref(name string) object {
+	if !strings.HasPrefix(name, "#") {
+		name = "#/components/schemas/" + name
+	}
+	return object{"$ref": name}
+}
+
+func jsonContent(schema object) object {
+	return object{"application/json": object{"schema": schema}}
+}
+
+// parameters returns the parameters shared by the operations, keyed by name.
+func parameters() object {
+	query := func(name, description string, schema object) object {
+		return object{"name": name, "in": "query", "description": description, "schema": schema}
+	}
+	header := func(name, description string, required bool) object {
+		return object{"name": name, "in": "header", "description": description, "required": required, "schema": object{"type": "string"}}
+	}
+	boolean := object{"type": "boolean", "default": false}
+	uuid := object{"type": "string", "format": "uuid"}
+	timestamp := object{"type": "string", "description": "RFC 3339 time, or a date taken as midnight UTC"}
+
+	applicant := query("applicant", "ID of the applicant", uuid)
+	applicant["required"] = true
+
+	return object{
+		"id":                  object{"name": "id", "in": "path", "required": true, "schema": uuid},
+		"criteria_id":         object{"name": "criteria_id", "in": "path", "required": true, "schema": uuid},
+		"category":            object{"name": "category", "in": "path", "required": true, "schema": object{"type": "string", "enum": categories()}},
+		"If-Match":            header("If-Match", "Entity tag of the version being changed, from the ETag of a previous response", true),
+		"If-None-Match":       header("If-None-Match", "Entity tag of a cached response; 304 Not Modified is returned if it is still current", false),
+		"Idempotency-Key":     header("Idempotency-Key", "Key, unique to the caller, that makes retrying the request safe; the first response is replayed for repeats", false),
+		"include_deleted":     query("include_deleted", "Include deleted entries", boolean),
+		"include_inactive":    query("include_inactive", "Include inactive values", boolean),
+		"catalogue":           query("catalogue", "Only benefits in the catalogue", boolean),
+		"criteria_level":      query("criteria_level", "Only criteria at this level", object{"type": "string", "enum": refdata.Values(refdata.CriteriaLevel)}),
+		"criteria_type":       query("criteria_type", "Only criteria of this type", object{"type": "string", "enum": refdata.Values(refdata.CriteriaType)}),
+		"status":              query("status", "Only criteria requiring this status", object{"type": "string", "enum": criteriaStatuses()}),
+		"disbursement_status": query("status", "Only payments in this state", object{"type": "string", "enum": models.DisbursementStatuses}),
+		"by": query("by", "Whether to add up the payments per scheme or per applicant",
+			object{"type": "string", "enum": []string{"scheme", "applicant"}, "default": "scheme"}),
+		"cascade":     query("cascade", "Also delete the applications that depend on the entry", boolean),
+		"applicant":   applicant,
+		"entity_type": query("entity_type", "Only entries about this type of entity", object{"type": "string"}),
+		"entity_id":   query("entity_id", "Only entries about this entity", object{"type": "string"}),
+		"actor":       query("actor", "Only entries made by this principal", object{"type": "string"}),
+		"from":        query("from", "Only entries made at or after this time", timestamp),
+		"to":          query("to", "Only entries made before this time", timestamp),
+		"limit":       query("limit", "Maximum number of entries", object{"type": "integer", "minimum": 0, "maximum": 1000, "default": 100}),
+		"offset":      query("offset", "Number of entries to skip", object{"type": "integer", "minimum": 0, "default": 0}),
+	}
+}
+
+// schemas returns the schemas of the models, with enumerations resolved from the cached reference data.
+func schemas() object {
+	str := object{"type": "string"}
+	uuid := object{"type": "string", "format": "uuid", "readOnly": true}
+	date := object{"type": "string", "format": "date"}
+	nullable := object{"type": "string", "nullable": true, "readOnly": true}
+	version := object{"type": "integer", "readOnly": true}
+	enum := func(values []string) object { return object{"type": "string", "enum": values} }
+	category := func(name string) object { return enum(refdata.Values(name)) }
+	array := func(items object) object { return object{"type": "array", "items": items} }
+	totals := object{"type": "object", "readOnly": true, "additionalProperties": object{"type": "string"}, "description": "Value of the entitlements together, keyed by currency"}
+	model := func(required []string, properties object) object {
+		schema := object{"type": "object", "properties": properties}
+		if len(required) > 0 {
+			schema["required"] = required
+		}
+		return schema
+	}
+
+	return object{
+		"Applicant": model([]string{"name", "employment_status", "marital_status", "sex", "date_of_birth"}, object{
+			"id":                uuid,
+			"name":              str,
+			"employment_status": category(refdata.EmploymentStatus),
+			"marital_status":    category(refdata.MaritalStatus),
+			"sex":               category(refdata.Sex),
+			"date_of_birth":     date,
+			"household":         array(ref("Household")),
+			"bank_account":      ref("BankAccount"),
+			"version":           version,
+			"deleted_at":        nullable,
+		}),
+		"BankAccount": model([]string{"holder", "number"}, object{
+			"holder": object{"type": "string", "maxLength": 140},
+			"number": object{"type": "string", "maxLength": payment.MaxAccountLength,
+				"description": "IBAN, in capitals without spaces, or local account number"},
+			"bic": object{"type": "string", "description": "BIC of the bank, if payments to it need one"},
+		}),
+		"Household": model([]string{"name", "relationship", "sex", "school_level", "employment_status", "date_of_birth"}, object{
+			"id":                uuid,
+			"applicant_id":      uuid,
+			"name":              str,
+			"relationship":      category(refdata.Relationship),
+			"sex":               category(refdata.Sex),
+			"school_level":      category(refdata.SchoolLevel),
+			"employment_status": category(refdata.EmploymentStatus),
+			"date_of_birth":     date,
+		}),
+		"Scheme": model([]string{"name"}, object{
+			"id":       uuid,
+			"name":     str,
+			"criteria": array(ref("Criteria")),
+			"benefits": array(ref("Benefit")),
+			"total_entitlement": object{"type": "object", "readOnly": true, "additionalProperties": object{"type": "string"},
+				"description": "Value of all the scheme's benefits with fixed amounts together, keyed by currency"},
+			"version":    version,
+			"deleted_at": nullable,
+		}),
+		"Criteria": model([]string{"criteria_level", "criteria_type", "status"}, object{
+			"id":             uuid,
+			"criteria_level": category(refdata.CriteriaLevel),
+			"criteria_type":  category(refdata.CriteriaType),
+			"status": object{"type": "string", "enum": criteriaStatuses(),
+				"description": "The statuses each criteria type accepts are listed by /api/criteria-types"},
+		}),
+		"Benefit": object{
+			"type": "object",
+			"description": "Within a scheme, a benefit given by id alone links one that already exists; " +
+				"otherwise the name and either an amount or an amount_formula are required",
+			"properties": object{
+				"id":   object{"type": "string", "format": "uuid"},
+				"name": str,
+				"amount": object{"type": "string", "pattern": `^\d+(\.\d{1,2})?$`, "example": "150.00",
+					"description": "Exact decimal amount; a JSON number is also accepted, read from its exact digits"},
+				"currency":  object{"type": "string", "pattern": "^[A-Z]{3}$", "default": money.DefaultCurrency, "description": "ISO 4217 code of a currency with 2 decimal places"},
+				"type":      object{"type": "string", "enum": refdata.Values(refdata.BenefitType), "default": models.DefaultBenefitType},
+				"frequency": object{"type": "string", "enum": refdata.Values(refdata.BenefitFrequency), "default": models.FrequencyOneOff},
+				"duration": object{"type": "integer", "minimum": 1, "default": 1,
+					"description": "Number of payments, one per period of the frequency; a one-off benefit is paid once"},
+				"amount_formula": object{"type": "string", "maxLength": formula.MaxLength, "example": "100 + 50 * children_count",
+					"description": "Computes the amount of each payment from the household instead of a fixed amount; " + formulaHelp()},
+				"total":     object{"type": "string", "readOnly": true, "description": "Value of every payment of a benefit with a fixed amount together"},
+				"catalogue": object{"type": "boolean", "readOnly": true, "description": "Whether the benefit is kept when no scheme uses it"},
+				"version":   version,
+			},
+		},
+		"Application": model([]string{"applicant_id", "scheme_id"}, object{
+			"id":           uuid,
+			"applicant_id": object{"type": "string", "format": "uuid"},
+			"scheme_id":    object{"type": "string", "format": "uuid"},
+			"status": object{"type": "string", "enum": models.ApplicationStatuses, "default": models.StatusPending,
+				"description": "An application becomes entitled to the scheme's benefits when its status is " + models.StatusApproved},
+			"applied_date":      date,
+			"entitlements":      object{"type": "array", "items": ref("Entitlement"), "readOnly": true},
+			"total_entitlement": totals,
+			"version":           version,
+			"deleted_at":        nullable,
+		}),
+		"Entitlement": model(nil, object{
+			"benefit_id":     object{"type": "string", "format": "uuid"},
+			"name":           str,
+			"type":           str,
+			"amount":         object{"type": "string", "description": "Amount of each payment, computed by the formula if the benefit has one"},
+			"amount_formula": str,
+			"currency":       str,
+			"frequency":      str,
+			"payments":       object{"type": "integer"},
+			"total":          object{"type": "string", "description": "Value of every payment together"},
+		}),
+		"Eligibility": model(nil, object{
+			"scheme_id":    object{"type": "string", "format": "uuid"},
+			"applicant_id": object{"type": "string", "format": "uuid"},
+			"eligible":     object{"type": "boolean"},
+			"criteria": array(object{"allOf": []object{ref("Criteria"), {"type": "object", "properties": object{
+				"met":    object{"type": "boolean"},
+				"reason": str,
+			}}}}),
+			"entitlements":      array(ref("Entitlement")),
+			"total_entitlement": totals,
+		}),
+		"Disbursement": model(nil, object{
+			"id":             uuid,
+			"application_id": uuid,
+			"applicant_id":   uuid,
+			"scheme_id":      uuid,
+			"benefit_id":     uuid,
+			"name":           str,
+			"installment":    object{"type": "integer", "description": "Number of the payment among those of the benefit, from 1"},
+			"amount":         str,
+			"currency":       str,
+			"due_date":       date,
+			"status":         enum(models.DisbursementStatuses),
+			"reference":      object{"type": "string", "maxLength": 100, "description": "Reference of the payment, such as the bank's"},
+			"paid_at":        object{"type": "string", "description": "When the payment was last recorded as made"},
+			"batch_id":       object{"type": "string", "format": "uuid", "readOnly": true, "description": "Payment batch the payment was last submitted in"},
+			"version":        version,
+		}),
+		"DisbursementPatch": model([]string{"status"}, object{
+			"status": object{"type": "string", "enum": models.DisbursementStatuses,
+				"description": "A scheduled or submitted payment may become paid or failed, a scheduled or failed one cancelled, a failed one paid or scheduled again, and a paid one reversed. Payments are submitted through payment batches"},
+			"reference": object{"type": "string", "maxLength": 100},
+		}),
+		"DisbursementTotal": model(nil, object{
+			"scheme_id":    object{"type": "string", "format": "uuid"},
+			"applicant_id": object{"type": "string", "format": "uuid"},
+			"currency":     str,
+			"scheduled":    str,
+			"submitted":    str,
+			"paid":         str,
+			"failed":       str,
+			"reversed":     str,
+			"cancelled":    str,
+		}),
+		"PaymentRun": model(nil, object{
+			"format":         object{"type": "string", "enum": payment.Formats, "default": payment.FormatPain001},
+			"currency":       object{"type": "string", "default": money.DefaultCurrency, "description": "Only payments in this currency"},
+			"execution_date": object{"type": "string", "format": "date", "description": "Day the bank makes the payments due by then; today unless given, and never in the past"},
+		}),
+		"PaymentBatch": model(nil, object{
+			"id":             uuid,
+			"format":         enum(payment.Formats),
+			"currency":       str,
+			"execution_date": date,
+			"file_name":      str,
+			"checksum":       object{"type": "string", "description": "SHA-256 of the file, in hexadecimal"},
+			"payments":       object{"type": "integer"},
+			"total":          str,
+			"created_at":     str,
+			"skipped":        object{"type": "integer", "description": "Due payments left out for want of a bank account; only reported on creation"},
+		}),
+		"ApplicationPatch": model(nil, object{
+			"status":       enum(models.ApplicationStatuses),
+			"applied_date": date,
+		}),
+		"CriteriaRule": model(nil, object{
+			"criteria_type":  str,
+			"levels":         array(str),
+			"values":         array(str),
+			"value_category": str,
+		}),
+		"ReferenceData": model([]string{"value"}, object{
+			"id":         uuid,
+			"category":   object{"type": "string", "enum": categories(), "readOnly": true},
+			"value":      str,
+			"label":      str,
+			"sort_order": object{"type": "integer"},
+			"active":     object{"type": "boolean", "default": true},
+		}),
+		"ReferenceDataByCategory": object{"type": "object", "additionalProperties": array(ref("ReferenceData"))},
+		"APIKey": model([]string{"name", "role"}, object{
+			"id":           uuid,
+			"name":         str,
+			"prefix":       object{"type": "string", "readOnly": true},
+			"role":         enum(auth.Roles()),
+			"created_by":   object{"type": "string", "readOnly": true},
+			"created_at":   object{"type": "string", "readOnly": true},
+			"last_used_at": nullable,
+			"revoked_at":   nullable,
+			"key":          object{"type": "string", "readOnly": true, "description": "The key itself, only returned when it is issued"},
+		}),
+		"PrincipalPermissions": model(nil, object{
+			"principal": model(nil, object{
+				"id":     str,
+				"name":   str,
+				"method": str,
+				"roles":  array(enum(auth.Roles())),
+			}),
+			"permissions": array(str),
+		}),
+		"AuditEntry": model(nil, object{
+			"id":          str,
+			"actor":       str,
+			"actor_name":  str,
+			"action":      enum([]string{audit.ActionCreate, audit.ActionUpdate, audit.ActionDelete, audit.ActionRevoke, audit.ActionRestore, audit.ActionPurge}),
+			"entity_type": str,
+			"entity_id":   str,
+			"request_id":  str,
+			"before":      object{"type": "object", "nullable": true},
+			"after":       object{"type": "object", "nullable": true},
+			"created_at":  str,
+		}),
+		"Removal": model(nil, object{
+			"removed": object{"type": "object", "additionalProperties": array(str),
+				"description": "IDs of the entries removed, keyed by entity"},
+		}),
+		"Health": model(nil, object{
+			"status": str,
+			"reason": str,
+		}),
+		"Error": model([]string{"error"}, object{
+			"error": model([]string{"code", "message"}, object{
+				"code":    str,
+				"message": str,
+				"field":   str,
+				"details": object{},
+			}),
+		}),
+	}
+}
+
+// categories returns every reference data category.
+func categories() []string {
+	names := make([]string, 0, len(refdata.Defaults))
+	for name := range refdata.Defaults {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// formulaHelp lists the variables and functions amount formulas may use.
+func formulaHelp() string {
+	names := make([]string, 0, len(formula.HouseholdVariables)+len(formula.HouseholdFunctions))
+	for name, description := range formula.HouseholdVariables {
+		names = append(names, name+": "+description)
+	}
+	for _, description := range formula.HouseholdFunctions {
+		names = append(names, description)
+	}
+	sort.Strings(names)
+	return "formulas use + - * / and parentheses, min(...) and max(...), and " + strings.Join(names, "; ")
+}
+
+// criteriaStatuses returns every status accepted by some criteria type.
+func criteriaStatuses() []string {
+	var statuses []string
+	for _, rule := range validation.CriteriaRules() {
+		for _, value := range rule.Values {
+			if !utils.IsValid(statuses, value) {
+				statuses = append(statuses, value)
+			}
+		}
+	}
+	return statuses
+}
+
+//go:embed swagger.html
+var swaggerUI []byte
+
+// Handler serves the document, which changes as the reference data does.
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		utils.WriteConditionalJSON(w, r, "", Spec())
+	})
+}
+
+// UI serves Swagger UI for the document. The UI itself is loaded from a CDN.
+func UI() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write(swaggerUI)
+	})
+}
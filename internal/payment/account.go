@@ -0,0 +1,69 @@
+// Generates the bulk payment files that banks accept, and records the batches of payments submitted in them.
+package payment
+
+import (
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// MaxAccountLength is the longest account number, that of an IBAN, which the bank_account_number column holds.
+const MaxAccountLength = 34
+
+// IsIBAN reports whether an account number is an International Bank Account Number with valid check digits,
+// written in capitals without the spaces it is often printed with.
+func IsIBAN(iban string) bool {
+	if len(iban) < 15 || len(iban) > MaxAccountLength || !letters(iban[:2]) || !numeric(iban[2:4]) || !alphanumeric(iban) || iban != strings.ToUpper(iban) {
+		return false
+	}
+
+	// Move the country code and check digits to the end, spell letters as numbers from A=10, and take the
+	// remainder modulo 97, which is 1 for a valid IBAN
+	var digits strings.Builder
+	for _, c := range iban[4:] + iban[:4] {
+		if c >= 'A' {
+			digits.WriteString(strconv.Itoa(int(c-'A') + 10))
+		} else {
+			digits.WriteRune(c)
+		}
+	}
+	n, _ := new(big.Int).SetString(digits.String(), 10)
+	return new(big.Int).Mod(n, big.NewInt(97)).Int64() == 1
+}
+
+// IsAccountNumber reports whether a local account number holds between 5 and 34 digits, letters and hyphens.
+func IsAccountNumber(account string) bool {
+	return len(account) >= 5 && len(account) <= MaxAccountLength && alphanumeric(strings.ReplaceAll(account, "-", ""))
+}
+
+// IsBIC reports whether a code is a Business Identifier Code: a bank, a country, a location and an optional branch.
+func IsBIC(bic string) bool {
+	return (len(bic) == 8 || len(bic) == 11) && letters(bic[:6]) && alphanumeric(bic[6:]) && bic == strings.ToUpper(bic)
+}
+
+func letters(s string) bool {
+	for _, c := range s {
+		if c < 'A' || c > 'Z' {
+			return false
+		}
+	}
+	return true
+}
+
+func numeric(s string) bool {
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+func alphanumeric(s string) bool {
+	for _, c := range strings.ToUpper(s) {
+		if (c < 'A' || c > 'Z') && (c < '0' || c > '9') {
+			return false
+		}
+	}
+	return true
+}
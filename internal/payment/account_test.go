@@ -0,0 +1,79 @@
+package payment
+
+import "testing"
+
+func TestIsIBAN(t *testing.T) {
+	tests := []struct {
+		iban string
+		want bool
+	}{
+		{"GB82WEST12345698765432", true},
+		{"DE89370400440532013000", true},
+		{"NL91ABNA0417164300", true},
+		{"FR1420041010050500013M02606", true},
+		{"NO9386011117947", true},                      // the shortest, at 15 characters
+		{"LC55HEMM000100010012001200023015", true},     // 32 characters
+		{"MT84MALT011000012345MTLCAST001S", true},      // letters after the bank code
+		{"GB82WEST12345698765431", false},              // wrong check digits
+		{"DE89370400440532013001", false},              // wrong check digits
+		{"GB28WEST12345698765432", false},              // check digits swapped
+		{"gb82west12345698765432", false},              // lower case
+		{"GB82 WEST 1234 5698 7654 32", false},         // spaces
+		{"GB82-WEST-1234-5698-7654-32", false},         // hyphens
+		{"BE6853900754", false},                        // too short
+		{"GB82WEST123456987654321234567890123", false}, // 35 characters
+		{"1282WEST12345698765432", false},              // no country code
+		{"GBXXWEST12345698765432", false},              // check digits that are not digits
+		{"", false},
+	}
+	for _, tt := range tests {
+		if got := IsIBAN(tt.iban); got != tt.want {
+			t.Errorf("IsIBAN(%q) = %v, want %v", tt.iban, got, tt.want)
+		}
+	}
+}
+
+func TestIsAccountNumber(t *testing.T) {
+	tests := []struct {
+		account string
+		want    bool
+	}{
+		{"12345", true},
+		{"123-456789-0", true},
+		{"DBS0012345678", true},
+		{"GB82WEST12345698765432", true},
+		{"1234", false},
+		{"123 456 789", false},
+		{"123/456", false},
+		{"1234567890123456789012345678901234", true},
+		{"12345678901234567890123456789012345", false},
+	}
+	for _, tt := range tests {
+		if got := IsAccountNumber(tt.account); got != tt.want {
+			t.Errorf("IsAccountNumber(%q) = %v, want %v", tt.account, got, tt.want)
+		}
+	}
+}
+
+func TestIsBIC(t *testing.T) {
+	tests := []struct {
+		bic  string
+		want bool
+	}{
+		{"DEUTDEFF", true},
+		{"DBSSSGSG", true},
+		{"DEUTDEFF500", true},
+		{"NEDSZAJJXXX", true},
+		{"deutdeff", false},
+		{"DEUTDEF", false},
+		{"DEUTDEFF5", false},
+		{"DEUT1EFF", false}, // digits in the bank or country code
+		{"DEUTDEFF-00", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if got := IsBIC(tt.bic); got != tt.want {
+			t.Errorf("IsBIC(%q) = %v, want %v", tt.bic, got, tt.want)
+		}
+	}
+}
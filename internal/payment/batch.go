@@ -0,0 +1,225 @@
+// Submits due disbursements to the bank in payment batches, and keeps each batch with its file.
+package payment
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"fas/internal/audit"
+	"fas/internal/models"
+	"fas/internal/utils"
+)
+
+var (
+	ErrNoDebtor      = errors.New("the account payments are made from is not configured")
+	ErrNothingDue    = errors.New("no disbursements with a bank account are due")
+	ErrChecksum      = errors.New("payment file does not match its checksum")
+	ErrUnknownFormat = errors.New("unknown payment file format")
+	ErrPastDate      = errors.New("execution date is in the past")
+)
+
+// Run is a request to submit the due disbursements in a bank file.
+type Run struct {
+	Format        string
+	Currency      string
+	ExecutionDate time.Time // disbursements due on or before this day are paid on it
+}
+
+// batchColumns are the columns of a payment batch besides its file, in the order scanBatch reads them.
+const batchColumns = `id, format, currency, execution_date, file_name, checksum, payments, total, created_at`
+
+// Submit collects the scheduled disbursements in the run's currency that are due by its execution date, writes
+// them to a file, keeps the file as a batch and marks the disbursements as submitted in it, all in one transaction.
+// Disbursements of applicants without a bank account stay scheduled and are counted in the batch's Skipped.
+func Submit(ctx context.Context, db *sql.DB, debtor Debtor, run Run) (models.PaymentBatch, error) {
+	if debtor.Name == "" || debtor.Account == "" {
+		return models.PaymentBatch{}, ErrNoDebtor
+	}
+	run.Format = CanonicalFormat(run.Format)
+	if !utils.IsValid(Formats, run.Format) {
+		return models.PaymentBatch{}, fmt.Errorf("%w %q", ErrUnknownFormat, run.Format)
+	}
+	// A bank cannot be asked to pay on a day that has gone
+	year, month, day := time.Now().In(run.ExecutionDate.Location()).Date()
+	if run.ExecutionDate.Before(time.Date(year, month, day, 0, 0, 0, 0, run.ExecutionDate.Location())) {
+		return models.PaymentBatch{}, fmt.Errorf("%w: %s", ErrPastDate, run.ExecutionDate.Format("2006-01-02"))
+	}
+	date := run.ExecutionDate.Format("2006-01-02")
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return models.PaymentBatch{}, err
+	}
+	defer tx.Rollback()
+
+	// Lock the due disbursements, so that a concurrent run cannot submit them too
+	rows, err := tx.QueryContext(ctx, `SELECT d.id, d.application_id, d.applicant_id, d.scheme_id, d.benefit_id, d.name,
+			d.installment, d.amount, d.currency, d.due_date, d.status, d.reference, d.paid_at, d.batch_id, d.version,
+			a.bank_account_holder, a.bank_account_number, a.bank_bic
+		FROM disbursements d
+		JOIN applicants a ON a.id = d.applicant_id AND a.deleted_at IS NULL
+		JOIN applications app ON app.id = d.application_id AND app.deleted_at IS NULL
+		WHERE d.status = ? AND d.currency = ? AND d.due_date <= ?
+		ORDER BY d.due_date, d.id
+		FOR UPDATE`, models.DisbursementScheduled, run.Currency, date)
+	if err != nil {
+		return models.PaymentBatch{}, err
+	}
+	var due []models.Disbursement
+	var transfers []Transfer
+	skipped := 0
+	for rows.Next() {
+		var d models.Disbursement
+		var holder, number, bic sql.NullString
+		if err := rows.Scan(&d.ID, &d.ApplicationID, &d.ApplicantID, &d.SchemeID, &d.BenefitID, &d.Name, &d.Installment,
+			&d.Amount, &d.Currency, &d.DueDate, &d.Status, &d.Reference, &d.PaidAt, &d.BatchID, &d.Version,
+			&holder, &number, &bic); err != nil {
+			rows.Close()
+			return models.PaymentBatch{}, err
+		}
+		if !number.Valid {
+			skipped++
+			continue
+		}
+		due = append(due, d)
+		transfers = append(transfers, Transfer{
+			ID:        d.ID,
+			Creditor:  models.BankAccount{Holder: holder.String, Number: number.String, BIC: bic.String},
+			Amount:    d.Amount,
+			Reference: fmt.Sprintf("%s, payment %d", d.Name, d.Installment),
+		})
+	}
+	err = rows.Err()
+	rows.Close()
+	if err != nil {
+		return models.PaymentBatch{}, err
+	}
+	if len(due) == 0 {
+		return models.PaymentBatch{}, ErrNothingDue
+	}
+
+	// Write the file
+	file := File{
+		ID:            uuid.New().String(),
+		Created:       time.Now().UTC(),
+		ExecutionDate: run.ExecutionDate,
+		Currency:      run.Currency,
+		Debtor:        debtor,
+		Transfers:     transfers,
+	}
+	content, err := file.Write(run.Format)
+	if err != nil {
+		return models.PaymentBatch{}, err
+	}
+	batch := models.PaymentBatch{
+		ID:            file.ID,
+		Format:        run.Format,
+		Currency:      run.Currency,
+		ExecutionDate: date,
+		FileName:      file.Name(run.Format),
+		Checksum:      checksum(content),
+		Payments:      len(transfers),
+		Total:         file.Total(),
+		CreatedAt:     file.Created.Format("2006-01-02 15:04:05"),
+	}
+
+	// Keep the batch with its file
+	_, err = tx.ExecContext(ctx, `INSERT INTO payment_batches (id, format, currency, execution_date, file_name, content,
+		checksum, payments, total, created_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		batch.ID, batch.Format, batch.Currency, batch.ExecutionDate, batch.FileName, content, batch.Checksum,
+		batch.Payments, batch.Total, file.Created)
+	if err != nil {
+		return models.PaymentBatch{}, err
+	}
+	err = audit.Record(ctx, tx, audit.Entry{Action: audit.ActionCreate, EntityType: "payment_batch", EntityID: batch.ID, After: batch})
+	if err != nil {
+		return models.PaymentBatch{}, err
+	}
+
+	// Mark the disbursements as submitted in the batch
+	ids := make([]interface{}, 0, len(due)+2)
+	ids = append(ids, models.DisbursementSubmitted, batch.ID)
+	for _, d := range due {
+		ids = append(ids, d.ID)
+	}
+	_, err = tx.ExecContext(ctx, `UPDATE disbursements SET status = ?, batch_id = ?, version = version + 1
+		WHERE id IN (`+strings.TrimSuffix(strings.Repeat("?, ", len(due)), ", ")+`)`, ids...)
+	if err != nil {
+		return models.PaymentBatch{}, err
+	}
+	for _, before := range due {
+		after := before
+		after.Status, after.BatchID, after.Version = models.DisbursementSubmitted, &batch.ID, before.Version+1
+		err = audit.Record(ctx, tx, audit.Entry{Action: audit.ActionUpdate, EntityType: "disbursement", EntityID: before.ID, Before: before, After: after})
+		if err != nil {
+			return models.PaymentBatch{}, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return models.PaymentBatch{}, err
+	}
+	batch.Skipped = skipped
+	return batch, nil
+}
+
+// checksum returns the SHA-256 of a file's content, in hexadecimal.
+func checksum(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
+
+// scanBatch reads a row of batchColumns.
+func scanBatch(row interface{ Scan(...interface{}) error }) (models.PaymentBatch, error) {
+	var b models.PaymentBatch
+	err := row.Scan(&b.ID, &b.Format, &b.Currency, &b.ExecutionDate, &b.FileName, &b.Checksum, &b.Payments, &b.Total, &b.CreatedAt)
+	return b, err
+}
+
+// List retrieves every payment batch, the most recent first.
+func List(ctx context.Context, db *sql.DB) ([]models.PaymentBatch, error) {
+	rows, err := db.QueryContext(ctx, `SELECT `+batchColumns+` FROM payment_batches ORDER BY created_at DESC, id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	batches := []models.PaymentBatch{}
+	for rows.Next() {
+		b, err := scanBatch(rows)
+		if err != nil {
+			return nil, err
+		}
+		batches = append(batches, b)
+	}
+	return batches, rows.Err()
+}
+
+// Get retrieves a payment batch, returning sql.ErrNoRows if there is no such batch.
+func Get(ctx context.Context, db *sql.DB, batchID string) (models.PaymentBatch, error) {
+	return scanBatch(db.QueryRowContext(ctx, `SELECT `+batchColumns+` FROM payment_batches WHERE id = ?`, batchID))
+}
+
+// Download retrieves a payment batch and its file, returning ErrChecksum if the file kept has changed since
+// it was written and sql.ErrNoRows if there is no such batch.
+func Download(ctx context.Context, db *sql.DB, batchID string) (models.PaymentBatch, []byte, error) {
+	var b models.PaymentBatch
+	var content []byte
+	err := db.QueryRowContext(ctx, `SELECT `+batchColumns+`, content FROM payment_batches WHERE id = ?`, batchID).
+		Scan(&b.ID, &b.Format, &b.Currency, &b.ExecutionDate, &b.FileName, &b.Checksum, &b.Payments, &b.Total, &b.CreatedAt, &content)
+	if err != nil {
+		return models.PaymentBatch{}, nil, err
+	}
+	if checksum(content) != b.Checksum {
+		return b, nil, ErrChecksum
+	}
+	return b, content, nil
+}
@@ -0,0 +1,36 @@
+package payment
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestSubmitRefusesRun(t *testing.T) {
+	debtor := Debtor{Name: "Family Assistance Office", Account: "GB82WEST12345698765432"}
+	yesterday := time.Now().AddDate(0, 0, -1)
+
+	tests := []struct {
+		name   string
+		debtor Debtor
+		run    Run
+		want   error
+	}{
+		{"no debtor", Debtor{}, Run{Format: FormatCSV, Currency: "SGD", ExecutionDate: time.Now()}, ErrNoDebtor},
+		{"unknown format", debtor, Run{Format: "mt101", Currency: "SGD", ExecutionDate: time.Now()}, ErrUnknownFormat},
+		{"past date", debtor, Run{Format: FormatPain001, Currency: "SGD", ExecutionDate: yesterday}, ErrPastDate},
+		// The format is accepted in any case, so the run only fails on its date
+		{"upper case format", debtor, Run{Format: "CSV", Currency: "SGD", ExecutionDate: yesterday}, ErrPastDate},
+	}
+
+	// Each run is refused before the database is used
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Submit(context.Background(), nil, tt.debtor, tt.run)
+			if !errors.Is(err, tt.want) {
+				t.Errorf("got %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
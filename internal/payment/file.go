@@ -0,0 +1,286 @@
+// Writes payment files in the formats banks accept for bulk credit transfers.
+package payment
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/xml"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"fas/internal/models"
+	"fas/internal/money"
+)
+
+// Formats of payment files.
+const (
+	FormatPain001 = "pain.001" // ISO 20022 customer credit transfer initiation, version pain.001.001.03
+	FormatCSV     = "csv"      // one transfer per line, under a header line
+)
+
+// Formats lists every format of payment file.
+var Formats = []string{FormatPain001, FormatCSV}
+
+// CanonicalFormat returns a valid format spelled as in Formats, such as "csv" for "CSV",
+// since files are written and named by comparing formats exactly.
+func CanonicalFormat(format string) string {
+	for _, f := range Formats {
+		if strings.EqualFold(f, format) {
+			return f
+		}
+	}
+	return format
+}
+
+// maxText is the length at which ISO 20022 cuts names and remittance information.
+const maxText = 140
+
+// Debtor is the organisation making the payments, and the account they are paid from.
+type Debtor struct {
+	Name    string
+	Account string // an IBAN or a local account number
+	BIC     string // optional where the bank does without
+}
+
+// Transfer is a single payment into a creditor's account.
+type Transfer struct {
+	ID        string // identifies the payment from end to end; the disbursement's ID
+	Creditor  models.BankAccount
+	Amount    money.Amount
+	Reference string // remittance information shown to the creditor
+}
+
+// File is the content of a payment file, before it is written in a format.
+type File struct {
+	ID            string
+	Created       time.Time
+	ExecutionDate time.Time // the day the bank is asked to make the payments
+	Currency      string
+	Debtor        Debtor
+	Transfers     []Transfer
+}
+
+// Total returns the sum of the transfers.
+func (f File) Total() money.Amount {
+	var total money.Amount
+	for _, t := range f.Transfers {
+		total = total.Add(t.Amount)
+	}
+	return total
+}
+
+// Name returns the name the file is downloaded under.
+func (f File) Name(format string) string {
+	extension := "xml"
+	if format == FormatCSV {
+		extension = "csv"
+	}
+	return fmt.Sprintf("payments-%s-%s-%s.%s", f.ExecutionDate.Format("2006-01-02"), f.Currency, f.ID[:8], extension)
+}
+
+// ContentType returns the media type of files in a format.
+func ContentType(format string) string {
+	if format == FormatCSV {
+		return "text/csv; charset=utf-8"
+	}
+	return "application/xml; charset=utf-8"
+}
+
+// Write writes the file in a format.
+func (f File) Write(format string) ([]byte, error) {
+	switch format {
+	case FormatPain001:
+		return f.pain001()
+	case FormatCSV:
+		return f.csv()
+	}
+	return nil, fmt.Errorf("unknown payment file format %q", format)
+}
+
+// csv writes one line per transfer, with the columns named on the first line.
+func (f File) csv() ([]byte, error) {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	w.Write([]string{"payment_id", "execution_date", "debtor_account", "creditor_name", "creditor_account", "creditor_bic",
+		"amount", "currency", "reference"})
+	for _, t := range f.Transfers {
+		w.Write([]string{t.ID, f.ExecutionDate.Format("2006-01-02"), f.Debtor.Account, t.Creditor.Holder, t.Creditor.Number,
+			t.Creditor.BIC, t.Amount.String(), f.Currency, t.Reference})
+	}
+	w.Flush()
+	return buf.Bytes(), w.Error()
+}
+
+// pain001 writes the transfers as a single payment information block of a customer credit transfer initiation.
+func (f File) pain001() ([]byte, error) {
+	count, total := strconv.Itoa(len(f.Transfers)), f.Total().String()
+	doc := pain001Document{
+		Initiation: pain001Initiation{
+			Header: pain001Header{
+				MessageID:    messageID(f.ID),
+				Created:      f.Created.UTC().Format("2006-01-02T15:04:05"),
+				Transactions: count,
+				ControlSum:   total,
+				InitiatingParty: pain001Party{
+					Name: truncate(f.Debtor.Name),
+				},
+			},
+			Payment: pain001Payment{
+				ID:            messageID(f.ID),
+				Method:        "TRF",
+				BatchBooking:  true,
+				Transactions:  count,
+				ControlSum:    total,
+				ExecutionDate: f.ExecutionDate.Format("2006-01-02"),
+				Debtor:        pain001Party{Name: truncate(f.Debtor.Name)},
+				DebtorAccount: pain001Account{ID: accountID(f.Debtor.Account), Currency: f.Currency},
+				DebtorAgent:   agent(f.Debtor.BIC),
+				ChargeBearer:  "SLEV",
+			},
+		},
+	}
+	// A debtor's bank must always be given, by BIC or as not provided
+	if doc.Initiation.Payment.DebtorAgent == nil {
+		doc.Initiation.Payment.DebtorAgent = &pain001Agent{Institution: pain001Institution{Other: &pain001Other{ID: "NOTPROVIDED"}}}
+	}
+
+	for _, t := range f.Transfers {
+		doc.Initiation.Payment.Transfers = append(doc.Initiation.Payment.Transfers, pain001Transfer{
+			PaymentID:       pain001PaymentID{EndToEndID: messageID(t.ID)},
+			Amount:          pain001Amount{Instructed: pain001InstructedAmount{Currency: f.Currency, Value: t.Amount.String()}},
+			CreditorAgent:   agent(t.Creditor.BIC),
+			Creditor:        pain001Party{Name: truncate(t.Creditor.Holder)},
+			CreditorAccount: pain001Account{ID: accountID(t.Creditor.Number)},
+			Remittance:      pain001Remittance{Unstructured: truncate(t.Reference)},
+		})
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+	enc := xml.NewEncoder(&buf)
+	enc.Indent("", "  ")
+	if err := enc.Encode(doc); err != nil {
+		return nil, err
+	}
+	buf.WriteByte('\n')
+	return buf.Bytes(), nil
+}
+
+// messageID shortens a UUID to the 32 characters of its digits, within the 35 ISO 20022 allows for identifiers.
+func messageID(id string) string {
+	return strings.ReplaceAll(id, "-", "")
+}
+
+// truncate cuts text to the length ISO 20022 allows.
+func truncate(text string) string {
+	runes := []rune(text)
+	if len(runes) > maxText {
+		return string(runes[:maxText])
+	}
+	return text
+}
+
+// accountID identifies an account by its IBAN, or by its local number otherwise.
+func accountID(account string) pain001AccountID {
+	if IsIBAN(account) {
+		return pain001AccountID{IBAN: account}
+	}
+	return pain001AccountID{Other: &pain001Other{ID: account}}
+}
+
+// agent identifies a bank by its BIC, or returns nil if it has none.
+func agent(bic string) *pain001Agent {
+	if bic == "" {
+		return nil
+	}
+	return &pain001Agent{Institution: pain001Institution{BIC: bic}}
+}
+
+// The elements of a pain.001.001.03 document used by the payment files, in the order the schema requires.
+
+type pain001Document struct {
+	XMLName    xml.Name          `xml:"urn:iso:std:iso:20022:tech:xsd:pain.001.001.03 Document"`
+	Initiation pain001Initiation `xml:"CstmrCdtTrfInitn"`
+}
+
+type pain001Initiation struct {
+	Header  pain001Header  `xml:"GrpHdr"`
+	Payment pain001Payment `xml:"PmtInf"`
+}
+
+type pain001Header struct {
+	MessageID       string       `xml:"MsgId"`
+	Created         string       `xml:"CreDtTm"`
+	Transactions    string       `xml:"NbOfTxs"`
+	ControlSum      string       `xml:"CtrlSum"`
+	InitiatingParty pain001Party `xml:"InitgPty"`
+}
+
+type pain001Payment struct {
+	ID            string            `xml:"PmtInfId"`
+	Method        string            `xml:"PmtMtd"`
+	BatchBooking  bool              `xml:"BtchBookg"`
+	Transactions  string            `xml:"NbOfTxs"`
+	ControlSum    string            `xml:"CtrlSum"`
+	ExecutionDate string            `xml:"ReqdExctnDt"`
+	Debtor        pain001Party      `xml:"Dbtr"`
+	DebtorAccount pain001Account    `xml:"DbtrAcct"`
+	DebtorAgent   *pain001Agent     `xml:"DbtrAgt"`
+	ChargeBearer  string            `xml:"ChrgBr"`
+	Transfers     []pain001Transfer `xml:"CdtTrfTxInf"`
+}
+
+type pain001Transfer struct {
+	PaymentID       pain001PaymentID  `xml:"PmtId"`
+	Amount          pain001Amount     `xml:"Amt"`
+	CreditorAgent   *pain001Agent     `xml:"CdtrAgt,omitempty"`
+	Creditor        pain001Party      `xml:"Cdtr"`
+	CreditorAccount pain001Account    `xml:"CdtrAcct"`
+	Remittance      pain001Remittance `xml:"RmtInf"`
+}
+
+type pain001PaymentID struct {
+	EndToEndID string `xml:"EndToEndId"`
+}
+
+type pain001Amount struct {
+	Instructed pain001InstructedAmount `xml:"InstdAmt"`
+}
+
+type pain001InstructedAmount struct {
+	Currency string `xml:"Ccy,attr"`
+	Value    string `xml:",chardata"`
+}
+
+type pain001Party struct {
+	Name string `xml:"Nm"`
+}
+
+type pain001Account struct {
+	ID       pain001AccountID `xml:"Id"`
+	Currency string           `xml:"Ccy,omitempty"`
+}
+
+type pain001AccountID struct {
+	IBAN  string        `xml:"IBAN,omitempty"`
+	Other *pain001Other `xml:"Othr,omitempty"`
+}
+
+type pain001Agent struct {
+	Institution pain001Institution `xml:"FinInstnId"`
+}
+
+type pain001Institution struct {
+	BIC   string        `xml:"BIC,omitempty"`
+	Other *pain001Other `xml:"Othr,omitempty"`
+}
+
+type pain001Other struct {
+	ID string `xml:"Id"`
+}
+
+type pain001Remittance struct {
+	Unstructured string `xml:"Ustrd"`
+}
@@ -0,0 +1,298 @@
+package payment
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/xml"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"fas/internal/models"
+	"fas/internal/money"
+)
+
+// testFile pays a creditor with an IBAN and a BIC, and one with a local account number and no BIC,
+// whose name needs escaping in XML and quoting in CSV.
+func testFile() File {
+	return File{
+		ID:            "0f8fad5b-d9cb-469f-a165-70867728950e",
+		Created:       time.Date(2025, 3, 1, 9, 30, 0, 0, time.UTC),
+		ExecutionDate: time.Date(2025, 3, 3, 0, 0, 0, 0, time.UTC),
+		Currency:      "SGD",
+		Debtor:        Debtor{Name: "Family Assistance Office", Account: "GB82WEST12345698765432", BIC: "DEUTDEFF"},
+		Transfers: []Transfer{
+			{
+				ID:        "7c9e6679-7425-40de-944b-e07fc1f90ae7",
+				Creditor:  models.BankAccount{Holder: "Mary Tan", Number: "DE89370400440532013000", BIC: "DBSSSGSG"},
+				Amount:    money.FromMinor(50000),
+				Reference: "Household grant, payment 1",
+			},
+			{
+				ID:        "9a1c7b3e-2f4d-4e8a-b6c5-d7e8f9a0b1c2",
+				Creditor:  models.BankAccount{Holder: `Lim & "Sons" <Pte>, Ltd`, Number: "123-456789-0"},
+				Amount:    money.FromMinor(12345),
+				Reference: "School supplies, payment 2",
+			},
+		},
+	}
+}
+
+func TestFileTotalAndName(t *testing.T) {
+	f := testFile()
+	if got := f.Total().String(); got != "623.45" {
+		t.Errorf("Total() = %s, want 623.45", got)
+	}
+	if got := f.Name(FormatPain001); got != "payments-2025-03-03-SGD-0f8fad5b.xml" {
+		t.Errorf("Name(pain.001) = %s", got)
+	}
+	if got := f.Name(FormatCSV); got != "payments-2025-03-03-SGD-0f8fad5b.csv" {
+		t.Errorf("Name(csv) = %s", got)
+	}
+}
+
+// elements lists the path of every element of an XML document, in document order.
+func elements(t *testing.T, content []byte) []string {
+	t.Helper()
+	var paths, stack []string
+	dec := xml.NewDecoder(bytes.NewReader(content))
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			break
+		}
+		switch el := tok.(type) {
+		case xml.StartElement:
+			stack = append(stack, el.Name.Local)
+			paths = append(paths, strings.Join(stack, "/"))
+		case xml.EndElement:
+			stack = stack[:len(stack)-1]
+		}
+	}
+	return paths
+}
+
+func TestPain001(t *testing.T) {
+	content, err := testFile().Write(FormatPain001)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(content, []byte(xml.Header+`<Document xmlns="urn:iso:std:iso:20022:tech:xsd:pain.001.001.03">`)) {
+		t.Errorf("the file does not start with the pain.001.001.03 document:\n%s", content)
+	}
+
+	// The elements come in the order the schema requires
+	const (
+		root     = "Document/CstmrCdtTrfInitn"
+		payment  = root + "/PmtInf"
+		transfer = payment + "/CdtTrfTxInf"
+	)
+	want := []string{
+		"Document", root,
+		root + "/GrpHdr", root + "/GrpHdr/MsgId", root + "/GrpHdr/CreDtTm", root + "/GrpHdr/NbOfTxs", root + "/GrpHdr/CtrlSum",
+		root + "/GrpHdr/InitgPty", root + "/GrpHdr/InitgPty/Nm",
+		payment, payment + "/PmtInfId", payment + "/PmtMtd", payment + "/BtchBookg", payment + "/NbOfTxs", payment + "/CtrlSum",
+		payment + "/ReqdExctnDt", payment + "/Dbtr", payment + "/Dbtr/Nm",
+		payment + "/DbtrAcct", payment + "/DbtrAcct/Id", payment + "/DbtrAcct/Id/IBAN", payment + "/DbtrAcct/Ccy",
+		payment + "/DbtrAgt", payment + "/DbtrAgt/FinInstnId", payment + "/DbtrAgt/FinInstnId/BIC",
+		payment + "/ChrgBr",
+		// A creditor with an IBAN and a BIC
+		transfer, transfer + "/PmtId", transfer + "/PmtId/EndToEndId", transfer + "/Amt", transfer + "/Amt/InstdAmt",
+		transfer + "/CdtrAgt", transfer + "/CdtrAgt/FinInstnId", transfer + "/CdtrAgt/FinInstnId/BIC",
+		transfer + "/Cdtr", transfer + "/Cdtr/Nm", transfer + "/CdtrAcct", transfer + "/CdtrAcct/Id", transfer + "/CdtrAcct/Id/IBAN",
+		transfer + "/RmtInf", transfer + "/RmtInf/Ustrd",
+		// A creditor with a local account number and no BIC
+		transfer, transfer + "/PmtId", transfer + "/PmtId/EndToEndId", transfer + "/Amt", transfer + "/Amt/InstdAmt",
+		transfer + "/Cdtr", transfer + "/Cdtr/Nm", transfer + "/CdtrAcct", transfer + "/CdtrAcct/Id", transfer + "/CdtrAcct/Id/Othr",
+		transfer + "/CdtrAcct/Id/Othr/Id",
+		transfer + "/RmtInf", transfer + "/RmtInf/Ustrd",
+	}
+	if got := elements(t, content); !reflect.DeepEqual(got, want) {
+		t.Errorf("elements are\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	// The counts and sums match the transfers, and the names are escaped
+	var doc pain001Document
+	if err := xml.Unmarshal(content, &doc); err != nil {
+		t.Fatal(err)
+	}
+	header, pmt := doc.Initiation.Header, doc.Initiation.Payment
+	checks := []struct{ name, got, want string }{
+		{"GrpHdr/MsgId", header.MessageID, "0f8fad5bd9cb469fa16570867728950e"},
+		{"GrpHdr/CreDtTm", header.Created, "2025-03-01T09:30:00"},
+		{"GrpHdr/NbOfTxs", header.Transactions, "2"},
+		{"GrpHdr/CtrlSum", header.ControlSum, "623.45"},
+		{"PmtInf/NbOfTxs", pmt.Transactions, "2"},
+		{"PmtInf/CtrlSum", pmt.ControlSum, "623.45"},
+		{"PmtInf/ReqdExctnDt", pmt.ExecutionDate, "2025-03-03"},
+		{"PmtInf/ChrgBr", pmt.ChargeBearer, "SLEV"},
+		{"CdtTrfTxInf[0]/PmtId/EndToEndId", pmt.Transfers[0].PaymentID.EndToEndID, "7c9e6679742540de944be07fc1f90ae7"},
+		{"CdtTrfTxInf[0]/Amt/InstdAmt", pmt.Transfers[0].Amount.Instructed.Value, "500.00"},
+		{"CdtTrfTxInf[0]/Amt/InstdAmt@Ccy", pmt.Transfers[0].Amount.Instructed.Currency, "SGD"},
+		{"CdtTrfTxInf[1]/Amt/InstdAmt", pmt.Transfers[1].Amount.Instructed.Value, "123.45"},
+		{"CdtTrfTxInf[1]/Cdtr/Nm", pmt.Transfers[1].Creditor.Name, `Lim & "Sons" <Pte>, Ltd`},
+		{"CdtTrfTxInf[1]/CdtrAcct/Id/Othr/Id", pmt.Transfers[1].CreditorAccount.ID.Other.ID, "123-456789-0"},
+	}
+	for _, c := range checks {
+		if c.got != c.want {
+			t.Errorf("%s is %q, want %q", c.name, c.got, c.want)
+		}
+	}
+	if !bytes.Contains(content, []byte("<Nm>Lim &amp; &#34;Sons&#34; &lt;Pte&gt;, Ltd</Nm>")) {
+		t.Errorf("the creditor's name is not escaped:\n%s", content)
+	}
+}
+
+func TestPain001WithoutDebtorBIC(t *testing.T) {
+	f := testFile()
+	f.Debtor.BIC = ""
+	f.Debtor.Account = "0123456789"
+	content, err := f.Write(FormatPain001)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var doc pain001Document
+	if err := xml.Unmarshal(content, &doc); err != nil {
+		t.Fatal(err)
+	}
+	pmt := doc.Initiation.Payment
+	if pmt.DebtorAgent == nil || pmt.DebtorAgent.Institution.Other == nil || pmt.DebtorAgent.Institution.Other.ID != "NOTPROVIDED" {
+		t.Errorf("DbtrAgt is %+v, want FinInstnId/Othr/Id NOTPROVIDED", pmt.DebtorAgent)
+	}
+	if pmt.DebtorAccount.ID.Other == nil || pmt.DebtorAccount.ID.Other.ID != "0123456789" || pmt.DebtorAccount.ID.IBAN != "" {
+		t.Errorf("DbtrAcct/Id is %+v, want Othr/Id 0123456789", pmt.DebtorAccount.ID)
+	}
+}
+
+func TestPain001Truncates(t *testing.T) {
+	f := testFile()
+	f.Transfers[0].Creditor.Holder = strings.Repeat("é", maxText+10)
+	content, err := f.Write(FormatPain001)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var doc pain001Document
+	if err := xml.Unmarshal(content, &doc); err != nil {
+		t.Fatal(err)
+	}
+	if got := doc.Initiation.Payment.Transfers[0].Creditor.Name; got != strings.Repeat("é", maxText) {
+		t.Errorf("the name was cut to %d characters, want %d", len([]rune(got)), maxText)
+	}
+}
+
+func TestCSV(t *testing.T) {
+	content, err := testFile().Write(FormatCSV)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	records, err := csv.NewReader(bytes.NewReader(content)).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := [][]string{
+		{"payment_id", "execution_date", "debtor_account", "creditor_name", "creditor_account", "creditor_bic", "amount", "currency", "reference"},
+		{"7c9e6679-7425-40de-944b-e07fc1f90ae7", "2025-03-03", "GB82WEST12345698765432", "Mary Tan", "DE89370400440532013000", "DBSSSGSG",
+			"500.00", "SGD", "Household grant, payment 1"},
+		{"9a1c7b3e-2f4d-4e8a-b6c5-d7e8f9a0b1c2", "2025-03-03", "GB82WEST12345698765432", `Lim & "Sons" <Pte>, Ltd`, "123-456789-0", "",
+			"123.45", "SGD", "School supplies, payment 2"},
+	}
+	if !reflect.DeepEqual(records, want) {
+		t.Errorf("records are\n%q\nwant\n%q", records, want)
+	}
+
+	// Fields holding commas or quotes are quoted, with the quotes doubled
+	for _, quoted := range []string{`"Lim & ""Sons"" <Pte>, Ltd"`, `"Household grant, payment 1"`} {
+		if !bytes.Contains(content, []byte(quoted)) {
+			t.Errorf("the file does not hold %s:\n%s", quoted, content)
+		}
+	}
+}
+
+func TestWriteUnknownFormat(t *testing.T) {
+	if _, err := testFile().Write("mt101"); err == nil {
+		t.Error("a file was written in an unknown format")
+	}
+}
+
+func TestCanonicalFormat(t *testing.T) {
+	tests := []struct {
+		format string
+		want   string
+	}{
+		{"pain.001", FormatPain001},
+		{"PAIN.001", FormatPain001},
+		{"Pain.001", FormatPain001},
+		{"csv", FormatCSV},
+		{"CSV", FormatCSV},
+		{"Csv", FormatCSV},
+		{"mt101", "mt101"},
+	}
+	for _, tt := range tests {
+		if got := CanonicalFormat(tt.format); got != tt.want {
+			t.Errorf("CanonicalFormat(%q) = %q, want %q", tt.format, got, tt.want)
+		}
+	}
+
+	// A format given in another case is written and named as the format itself
+	content, err := testFile().Write(CanonicalFormat("CSV"))
+	if err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	if !strings.HasPrefix(string(content), "payment_id,") {
+		t.Errorf("the file is not CSV:\n%s", content)
+	}
+	if got := testFile().Name(CanonicalFormat("CSV")); !strings.HasSuffix(got, ".csv") {
+		t.Errorf("Name = %s, want a .csv file", got)
+	}
+}
+
+func TestChecksum(t *testing.T) {
+	for _, format := range Formats {
+		t.Run(format, func(t *testing.T) {
+			first, err := testFile().Write(format)
+			if err != nil {
+				t.Fatal(err)
+			}
+			again, err := testFile().Write(format)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// The same batch always gives the same file, and so the same checksum
+			sum := checksum(first)
+			if len(sum) != 64 || strings.Trim(sum, "0123456789abcdef") != "" {
+				t.Errorf("checksum %q is not 64 hexadecimal digits", sum)
+			}
+			if checksum(again) != sum {
+				t.Error("writing the same file twice gave different checksums")
+			}
+
+			// Any change to the file no longer matches
+			changed := bytes.Replace(first, []byte("500.00"), []byte("900.00"), 1)
+			if bytes.Equal(changed, first) {
+				t.Fatal("the amount was not found in the file")
+			}
+			if checksum(changed) == sum {
+				t.Error("a changed file matches the checksum of the original")
+			}
+		})
+	}
+
+	// The SHA-256 of the empty file
+	if got := checksum(nil); got != "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855" {
+		t.Errorf("checksum(nil) = %s", got)
+	}
+}
+
+func TestContentType(t *testing.T) {
+	if got := ContentType(FormatCSV); got != "text/csv; charset=utf-8" {
+		t.Errorf("ContentType(csv) = %s", got)
+	}
+	if got := ContentType(FormatPain001); got != "application/xml; charset=utf-8" {
+		t.Errorf("ContentType(pain.001) = %s", got)
+	}
+}
@@ -0,0 +1,83 @@
+// Caches the reference data that lists the valid values of each enumeration.
+package refdata
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+)
+
+// Categories of reference data.
+const (
+	EmploymentStatus = "employment_status"
+	MaritalStatus    = "marital_status"
+	SchoolLevel      = "school_level"
+	Sex              = "sex"
+	Relationship     = "relationship"
+	CriteriaLevel    = "criteria_level"
+	CriteriaType     = "criteria_type"
+	BenefitType      = "benefit_type"
+	BenefitFrequency = "benefit_frequency"
+)
+
+// Defaults are the values each category is seeded with, and used until the cache is loaded.
+var Defaults = map[string][]string{
+	EmploymentStatus: {"employed", "unemployed", "self-employed", "retired"},
+	MaritalStatus:    {"single", "married", "divorced", "widowed"},
+	SchoolLevel:      {"none", "primary", "secondary", "post-secondary", "university", "graduated"},
+	Sex:              {"male", "female"},
+	Relationship:     {"parent", "son", "daughter", "sibling", "spouse", "other"},
+	CriteriaLevel:    {"individual", "household"},
+	CriteriaType:     {"marital_status", "school_level", "employment_status", "has_children"},
+	BenefitType:      {"cash", "voucher", "in_kind", "service"},
+	BenefitFrequency: {"one_off", "weekly", "monthly", "annually"},
+}
+
+// cache holds the active values of each category, in display order.
+var cache struct {
+	sync.RWMutex
+	values map[string][]string
+}
+
+// IsCategory reports whether the category is known.
+func IsCategory(category string) bool {
+	_, ok := Defaults[category]
+	return ok
+}
+
+// Values returns the active values of a category.
+func Values(category string) []string {
+	cache.RLock()
+	defer cache.RUnlock()
+
+	if cache.values == nil {
+		return Defaults[category]
+	}
+	return cache.values[category]
+}
+
+// Load replaces the cache with the active values stored in the database.
+func Load(ctx context.Context, db *sql.DB) error {
+	rows, err := db.QueryContext(ctx, `SELECT category, value FROM reference_data WHERE active = TRUE ORDER BY category, sort_order, value`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	values := make(map[string][]string, len(Defaults))
+	for rows.Next() {
+		var category, value string
+		if err := rows.Scan(&category, &value); err != nil {
+			return err
+		}
+		values[category] = append(values[category], value)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	cache.Lock()
+	cache.values = values
+	cache.Unlock()
+	return nil
+}
@@ -2,18 +2,151 @@
 package utils
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"log/slog"
 	"net/http"
-    
+	"regexp"
+
 	"github.com/go-sql-driver/mysql"
 )
 
+// Machine-readable error codes returned in the error envelope.
+const (
+	CodeInvalidRequest       = "invalid_request"
+	CodeInvalidID            = "invalid_id"
+	CodeInvalidValue         = "invalid_value"
+	CodeValidationFailed     = "validation_failed"
+	CodeNotFound             = "not_found"
+	CodeDuplicateEntry       = "duplicate_entry"
+	CodeForeignKeyViolation  = "foreign_key_violation"
+	CodeDataTooLong          = "data_too_long"
+	CodeMissingValue         = "missing_value"
+	CodeOutOfRange           = "out_of_range"
+	CodeUnauthenticated      = "unauthenticated"
+	CodeForbidden            = "forbidden"
+	CodePreconditionRequired = "precondition_required"
+	CodePreconditionFailed   = "precondition_failed"
+	CodeIdempotencyMismatch  = "idempotency_key_mismatch"
+	CodeRequestInProgress    = "request_in_progress"
+	CodeInvalidState         = "invalid_state"
+	CodeHasDependents        = "has_dependents"
+	CodeTimeout              = "timeout"
+	CodeUnavailable          = "unavailable"
+	CodeInternal             = "internal_error"
+)
+
+var (
+	ErrMissingID = errors.New("ID is required")
+	ErrInvalidID = errors.New("invalid ID format")
+	ErrNotFound  = errors.New("not found")
+)
+
+// APIError is the body of every error response.
+type APIError struct {
+	Code    string      `json:"code"`
+	Message string      `json:"message"`
+	Field   string      `json:"field,omitempty"`
+	Details interface{} `json:"details,omitempty"`
+}
+
+// errorEnvelope wraps an APIError so that error responses are recognisable as such.
+type errorEnvelope struct {
+	Error APIError `json:"error"`
+}
+
+// WriteError writes the error envelope with the given status.
+func WriteError(w http.ResponseWriter, status int, apiErr APIError) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(errorEnvelope{Error: apiErr})
+}
+
+// Error writes an error envelope that has no field or details, in the manner of http.Error.
+func Error(w http.ResponseWriter, status int, code, message string) {
+	WriteError(w, status, APIError{Code: code, Message: message})
+}
+
+// HandleContextError writes 504 Gateway Timeout if the request ran out of time, or 503 Service Unavailable
+// if it was cancelled, reporting whether err was either.
+func HandleContextError(w http.ResponseWriter, err error) bool {
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		Error(w, http.StatusGatewayTimeout, CodeTimeout, "The request took too long to complete")
+	case errors.Is(err, context.Canceled):
+		Error(w, http.StatusServiceUnavailable, CodeUnavailable, "The request was cancelled before it completed")
+	default:
+		return false
+	}
+	return true
+}
+
+// columnPattern extracts the column named in a MySQL error message.
+var columnPattern = regexp.MustCompile(`(?:column|Column|Field) '([^']+)'`)
+
 // HandleInsertError handles any errors from insertion of entries into the database.
 func HandleInsertError(w http.ResponseWriter, err error, entity string) {
-    if mysqlErr, ok := err.(*mysql.MySQLError); ok && mysqlErr.Number == 1062 {
-        http.Error(w, fmt.Sprintf("An entry for the %s already exists", entity), http.StatusConflict)
-        return
-    }
-    
-    http.Error(w, fmt.Sprintf("Failed to insert %s", entity), http.StatusInternalServerError)
+	if HandleContextError(w, err) {
+		return
+	}
+	var mysqlErr *mysql.MySQLError
+	if !errors.As(err, &mysqlErr) {
+		Error(w, http.StatusInternalServerError, CodeInternal, fmt.Sprintf("Failed to insert %s", entity))
+		return
+	}
+
+	var field string
+	if match := columnPattern.FindStringSubmatch(mysqlErr.Message); match != nil {
+		field = match[1]
+	}
+
+	switch mysqlErr.Number {
+	case 1062: // ER_DUP_ENTRY
+		Error(w, http.StatusConflict, CodeDuplicateEntry, fmt.Sprintf("An entry for the %s already exists", entity))
+	case 1451: // ER_ROW_IS_REFERENCED_2
+		Error(w, http.StatusConflict, CodeForeignKeyViolation,
+			fmt.Sprintf("The %s is still referenced by other entries", entity))
+	case 1452: // ER_NO_REFERENCED_ROW_2
+		Error(w, http.StatusBadRequest, CodeForeignKeyViolation,
+			fmt.Sprintf("The %s refers to an entry that does not exist", entity))
+	case 1406: // ER_DATA_TOO_LONG
+		WriteError(w, http.StatusBadRequest, APIError{Code: CodeDataTooLong, Field: field,
+			Message: fmt.Sprintf("A value for the %s is too long", entity)})
+	case 1048, 1364: // ER_BAD_NULL_ERROR, ER_NO_DEFAULT_FOR_FIELD
+		WriteError(w, http.StatusBadRequest, APIError{Code: CodeMissingValue, Field: field,
+			Message: fmt.Sprintf("A required value for the %s is missing", entity)})
+	case 1264: // ER_WARN_DATA_OUT_OF_RANGE
+		WriteError(w, http.StatusBadRequest, APIError{Code: CodeOutOfRange, Field: field,
+			Message: fmt.Sprintf("A value for the %s is out of range", entity)})
+	case 1292, 1366: // ER_TRUNCATED_WRONG_VALUE, ER_TRUNCATED_WRONG_VALUE_FOR_FIELD
+		WriteError(w, http.StatusBadRequest, APIError{Code: CodeInvalidValue, Field: field,
+			Message: fmt.Sprintf("A value for the %s has an invalid format", entity)})
+	default:
+		Error(w, http.StatusInternalServerError, CodeInternal, fmt.Sprintf("Failed to insert %s", entity))
+	}
+}
+
+// IsDuplicateEntry reports whether err is MySQL refusing a row whose unique key is already taken.
+func IsDuplicateEntry(err error) bool {
+	var mysqlErr *mysql.MySQLError
+	return errors.As(err, &mysqlErr) && mysqlErr.Number == 1062 // ER_DUP_ENTRY
+}
+
+// HandleLookupError handles errors from validating an ID and checking that its entity exists.
+// Database errors are logged rather than shown to the client.
+func HandleLookupError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, ErrMissingID), errors.Is(err, ErrInvalidID):
+		Error(w, http.StatusBadRequest, CodeInvalidID, err.Error())
+	case errors.Is(err, ErrNotFound):
+		Error(w, http.StatusNotFound, CodeNotFound, err.Error())
+	default:
+		if !HandleContextError(w, err) {
+			slog.Error("lookup failed", "error", err)
+			Error(w, http.StatusInternalServerError, CodeInternal, "Failed to retrieve resource")
+		}
+	}
 }
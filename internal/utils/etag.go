@@ -0,0 +1,95 @@
+// Contains helpers for entity tags and conditional requests.
+package utils
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrIfMatchMissing = errors.New("If-Match header is required")
+	ErrIfMatchInvalid = errors.New("If-Match header must contain a single entity tag")
+)
+
+// VersionETag returns the strong entity tag for a resource at the given version.
+func VersionETag(version int) string {
+	return fmt.Sprintf(`"%d"`, version)
+}
+
+// ParseIfMatch returns the resource version named in the If-Match header.
+func ParseIfMatch(r *http.Request) (int, error) {
+	header := strings.TrimSpace(r.Header.Get("If-Match"))
+	if header == "" {
+		return 0, ErrIfMatchMissing
+	}
+
+	// Weak tags never match under the strong comparison If-Match requires.
+	if strings.HasPrefix(header, "W/") || len(header) < 2 ||
+		!strings.HasPrefix(header, `"`) || !strings.HasSuffix(header, `"`) {
+		return 0, ErrIfMatchInvalid
+	}
+
+	version, err := strconv.Atoi(header[1 : len(header)-1])
+	if err != nil {
+		return 0, ErrIfMatchInvalid
+	}
+	return version, nil
+}
+
+// RequireIfMatch reads the If-Match version, writing the error response when it is absent or malformed.
+func RequireIfMatch(w http.ResponseWriter, r *http.Request) (int, bool) {
+	version, err := ParseIfMatch(r)
+	if errors.Is(err, ErrIfMatchMissing) {
+		Error(w, http.StatusPreconditionRequired, CodePreconditionRequired, err.Error())
+		return 0, false
+	}
+	if err != nil {
+		Error(w, http.StatusBadRequest, CodeInvalidRequest, err.Error())
+		return 0, false
+	}
+	return version, true
+}
+
+// WriteConditionalJSON writes v as JSON with the given entity tag, or 304 Not Modified when
+// the request's If-None-Match header already holds that tag. An empty etag is derived from the body.
+func WriteConditionalJSON(w http.ResponseWriter, r *http.Request, etag string, v interface{}) {
+	body, err := json.Marshal(v)
+	if err != nil {
+		Error(w, http.StatusInternalServerError, CodeInternal, "Failed to encode response")
+		return
+	}
+	if etag == "" {
+		sum := sha256.Sum256(body)
+		etag = `W/"` + hex.EncodeToString(sum[:16]) + `"`
+	}
+
+	w.Header().Set("ETag", etag)
+	if noneMatch(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(append(body, '\n'))
+}
+
+// noneMatch reports whether an If-None-Match header matches the entity tag, using weak comparison.
+func noneMatch(header, etag string) bool {
+	if header == "" {
+		return false
+	}
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
+}
@@ -2,7 +2,6 @@
 package utils
 
 import (
-    "fmt"
 	"strings"
 
     "github.com/google/uuid"
@@ -18,13 +17,24 @@ func IsValid(validVals []string, value string) bool {
     return false
 }
 
+// Canonical returns a valid value spelled as in validVals, since IsValid accepts any case.
+// A value that is not valid is returned unchanged.
+func Canonical(validVals []string, value string) string {
+    for _, item := range validVals {
+        if strings.EqualFold(item, value) {
+            return item
+        }
+    }
+    return value
+}
+
 // ValidateUUID checks if the provided string is a valid UUID and not empty.
 func ValidateUUID(id string) (error) {
     if id == "" {
-        return fmt.Errorf("ID is required")
+        return ErrMissingID
     }
     if _, err := uuid.Parse(id); err != nil {
-        return fmt.Errorf("invalid ID format")
+        return ErrInvalidID
     }
     return nil
 }
@@ -0,0 +1,17 @@
+// Contains helpers for correlating the work done for a request.
+package utils
+
+import "context"
+
+type requestIDKey struct{}
+
+// WithRequestID returns a copy of the context that carries the request ID.
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, requestID)
+}
+
+// RequestID returns the ID of the request the context belongs to, or an empty string.
+func RequestID(ctx context.Context) string {
+	requestID, _ := ctx.Value(requestIDKey{}).(string)
+	return requestID
+}
@@ -0,0 +1,70 @@
+// Validates applicants and their household members.
+package validation
+
+import (
+	"fmt"
+	"unicode"
+
+	"fas/internal/models"
+	"fas/internal/payment"
+	"fas/internal/refdata"
+)
+
+// Applicant returns every violation in the applicant and their household members.
+// The valid options come from the cached reference data.
+func Applicant(applicant models.Applicant) Errors {
+	v := &validator{}
+	validEmploymentStatus := refdata.Values(refdata.EmploymentStatus)
+	validMaritalStatus := refdata.Values(refdata.MaritalStatus)
+	validSchoolLevels := refdata.Values(refdata.SchoolLevel)
+	validSex := refdata.Values(refdata.Sex)
+	validRelationships := refdata.Values(refdata.Relationship)
+
+	// Validate the applicant's fields
+	v.name("name", applicant.Name)
+	v.oneOf("employment_status", applicant.EmploymentStatus, validEmploymentStatus)
+	v.oneOf("marital_status", applicant.MaritalStatus, validMaritalStatus)
+	v.oneOf("sex", applicant.Sex, validSex)
+	v.pastDate("date_of_birth", applicant.DateOfBirth)
+	if applicant.BankAccount != nil {
+		v.bankAccount("bank_account.", *applicant.BankAccount)
+	}
+
+	// Validate household member(s) fields
+	for i, member := range applicant.Household {
+		path := fmt.Sprintf("household[%d].", i)
+		v.name(path+"name", member.Name)
+		v.oneOf(path+"relationship", member.Relationship, validRelationships)
+		v.oneOf(path+"sex", member.Sex, validSex)
+		v.oneOf(path+"school_level", member.SchoolLevel, validSchoolLevels)
+		v.oneOf(path+"employment_status", member.EmploymentStatus, validEmploymentStatus)
+		v.pastDate(path+"date_of_birth", member.DateOfBirth)
+	}
+
+	return v.errs
+}
+
+// maxHolderLength is the longest name a bulk payment file gives the holder of an account.
+const maxHolderLength = 140
+
+// bankAccount checks that an account has a holder, an IBAN or local account number, and a valid BIC if one is given.
+func (v *validator) bankAccount(path string, account models.BankAccount) {
+	if v.required(path+"holder", account.Holder) && len(account.Holder) > maxHolderLength {
+		v.add(path+"holder", CodeTooLong, fmt.Sprintf("Holder must be at most %d characters", maxHolderLength))
+	}
+
+	switch {
+	case !v.required(path+"number", account.Number):
+	case len(account.Number) >= 2 && unicode.IsLetter(rune(account.Number[0])) && unicode.IsLetter(rune(account.Number[1])):
+		// An account number starting with a country code is an IBAN
+		if !payment.IsIBAN(account.Number) {
+			v.add(path+"number", CodeInvalidFormat, "IBAN must be written in capitals without spaces and have valid check digits")
+		}
+	case !payment.IsAccountNumber(account.Number):
+		v.add(path+"number", CodeInvalidFormat, fmt.Sprintf("Account number must be 5 to %d letters, digits and hyphens", payment.MaxAccountLength))
+	}
+
+	if account.BIC != "" && !payment.IsBIC(account.BIC) {
+		v.add(path+"bic", CodeInvalidFormat, "BIC must be 8 or 11 capital letters and digits")
+	}
+}
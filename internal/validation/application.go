@@ -0,0 +1,26 @@
+// Validates the applications made for schemes.
+package validation
+
+import (
+	"strings"
+
+	"fas/internal/models"
+)
+
+// ApplicationStatus returns the violation in an application's status, if it is not one of models.ApplicationStatuses.
+func ApplicationStatus(status string) Errors {
+	v := &validator{}
+	v.oneOf("status", status, models.ApplicationStatuses)
+	return v.errs
+}
+
+// CanonicalStatus returns a valid application status spelled as in models.ApplicationStatuses, such as "Approved"
+// for "approved", since statuses are compared exactly once stored.
+func CanonicalStatus(status string) string {
+	for _, s := range models.ApplicationStatuses {
+		if strings.EqualFold(s, status) {
+			return s
+		}
+	}
+	return status
+}
@@ -0,0 +1,51 @@
+// Declares which levels and statuses each criteria type supports.
+package validation
+
+import (
+	"fas/internal/refdata"
+	"fas/internal/utils"
+)
+
+// CriteriaRule declares the levels a criteria type may be used at and the statuses it accepts.
+// The statuses are either fixed or taken from a reference data category.
+type CriteriaRule struct {
+	Type          string   `json:"criteria_type"`
+	Levels        []string `json:"levels"`
+	Values        []string `json:"values"`
+	ValueCategory string   `json:"value_category,omitempty"`
+}
+
+// criteriaRules is the registry of criteria types that the eligibility checks understand.
+var criteriaRules = []CriteriaRule{
+	{Type: "marital_status", Levels: []string{"individual"}, ValueCategory: refdata.MaritalStatus},
+	{Type: "school_level", Levels: []string{"household"}, ValueCategory: refdata.SchoolLevel},
+	{Type: "employment_status", Levels: []string{"individual", "household"}, ValueCategory: refdata.EmploymentStatus},
+	{Type: "has_children", Levels: []string{"individual"}, Values: []string{"true", "false"}},
+}
+
+// CriteriaRules returns the registry, with statuses resolved from the cached reference data.
+func CriteriaRules() []CriteriaRule {
+	rules := make([]CriteriaRule, len(criteriaRules))
+	for i, rule := range criteriaRules {
+		rules[i] = resolve(rule)
+	}
+	return rules
+}
+
+// CriteriaRuleFor returns the rule for a criteria type, if the type is supported.
+func CriteriaRuleFor(criteriaType string) (CriteriaRule, bool) {
+	for _, rule := range criteriaRules {
+		if utils.IsValid([]string{rule.Type}, criteriaType) {
+			return resolve(rule), true
+		}
+	}
+	return CriteriaRule{}, false
+}
+
+// resolve fills in the statuses of a rule whose value domain is a reference data category.
+func resolve(rule CriteriaRule) CriteriaRule {
+	if rule.ValueCategory != "" {
+		rule.Values = refdata.Values(rule.ValueCategory)
+	}
+	return rule
+}
@@ -0,0 +1,124 @@
+// Validates schemes with their criteria and benefits.
+package validation
+
+import (
+	"fmt"
+	"strings"
+
+	"fas/internal/formula"
+	"fas/internal/models"
+	"fas/internal/money"
+	"fas/internal/refdata"
+	"fas/internal/utils"
+)
+
+// Scheme returns every violation in the scheme, its criteria and its benefits.
+// Each criteria must also use a level and status allowed by its type's rule.
+func Scheme(scheme models.Scheme) Errors {
+	v := &validator{}
+	validCriteriaLevels := refdata.Values(refdata.CriteriaLevel)
+	validCriteriaTypes := refdata.Values(refdata.CriteriaType)
+
+	v.name("name", scheme.Name)
+
+	// Validate scheme criteria; a criteria given by ID links one that already exists
+	for i, criteria := range scheme.Criteria {
+		path := fmt.Sprintf("criteria[%d].", i)
+		if criteria.ID != "" {
+			v.id(path+"id", criteria.ID)
+			continue
+		}
+		v.oneOf(path+"criteria_level", criteria.CriteriaLevel, validCriteriaLevels)
+		v.oneOf(path+"criteria_type", criteria.CriteriaType, validCriteriaTypes)
+		v.criteriaRule(path, criteria)
+	}
+
+	// Validate scheme benefits; a benefit given by ID links one that already exists
+	for i, benefit := range scheme.Benefits {
+		path := fmt.Sprintf("benefits[%d].", i)
+		if benefit.ID != "" {
+			v.id(path+"id", benefit.ID)
+			continue
+		}
+		v.benefit(path, benefit)
+	}
+
+	return v.errs
+}
+
+// Benefit returns every violation in a benefit of the catalogue.
+func Benefit(benefit models.Benefit) Errors {
+	v := &validator{}
+	v.benefit("", benefit)
+	return v.errs
+}
+
+// maxBenefitDuration is the most payments a recurring benefit may make, twenty years of weekly payments.
+const maxBenefitDuration = 1040
+
+// benefit checks the name, amount, currency, type, frequency and duration of a benefit.
+// A benefit without a currency, type or frequency is a one-off cash payment in the default currency.
+func (v *validator) benefit(path string, benefit models.Benefit) {
+	v.name(path+"name", benefit.Name)
+	if benefit.Amount < 0 {
+		v.add(path+"amount", CodeOutOfRange, "Amount should be more than or equal to 0.00")
+	} else if benefit.Amount > money.Max {
+		v.add(path+"amount", CodeOutOfRange, "Amount should be at most "+money.Max.String())
+	}
+	if benefit.AmountFormula != "" {
+		v.amountFormula(path, benefit)
+	}
+	if benefit.Currency != "" && !money.IsCurrency(benefit.Currency) {
+		v.add(path+"currency", CodeInvalidOption, "Currency must be the ISO 4217 code of a currency with 2 decimal places, such as "+money.DefaultCurrency)
+	}
+	if benefit.Type != "" {
+		v.oneOf(path+"type", benefit.Type, refdata.Values(refdata.BenefitType))
+	}
+	frequency := utils.Canonical(models.Frequencies, benefit.Frequency)
+	if frequencies := refdata.Values(refdata.BenefitFrequency); frequency != "" {
+		v.oneOf(path+"frequency", frequency, frequencies)
+		if utils.IsValid(frequencies, frequency) && !utils.IsValid(models.Frequencies, frequency) {
+			v.add(path+"frequency", CodeInvalidOption, "Frequency "+frequency+" has no payment schedule, "+
+				strings.TrimSpace(utils.FormatValidOptions(models.Frequencies)))
+		}
+	}
+
+	// The duration counts the periods of a recurring benefit's frequency
+	if frequency == "" || frequency == models.FrequencyOneOff {
+		if benefit.Duration != 0 && benefit.Duration != 1 {
+			v.add(path+"duration", CodeOutOfRange, "A one-off benefit is paid once, so its duration must be 1 or omitted")
+		}
+	} else if benefit.Duration < 1 || benefit.Duration > maxBenefitDuration {
+		v.add(path+"duration", CodeOutOfRange, fmt.Sprintf("Duration must be between 1 and %d payments", maxBenefitDuration))
+	}
+}
+
+// amountFormula checks that a benefit computing its amount from the household has a formula that can be evaluated.
+func (v *validator) amountFormula(path string, benefit models.Benefit) {
+	if benefit.Amount != 0 {
+		v.add(path+"amount", CodeConflict, "Give either an amount or an amount_formula, not both")
+	}
+	if len(benefit.AmountFormula) > formula.MaxLength {
+		v.add(path+"amount_formula", CodeTooLong, fmt.Sprintf("Formula must be at most %d characters", formula.MaxLength))
+	} else if err := formula.CheckHousehold(benefit.AmountFormula); err != nil {
+		v.add(path+"amount_formula", CodeInvalidFormat, "Invalid formula, "+err.Error())
+	}
+}
+
+// criteriaRule checks the criteria's level and status against the rule for its type.
+func (v *validator) criteriaRule(path string, criteria models.Criteria) {
+	rule, ok := CriteriaRuleFor(criteria.CriteriaType)
+	if !ok {
+		if criteria.CriteriaType != "" && utils.IsValid(refdata.Values(refdata.CriteriaType), criteria.CriteriaType) {
+			v.add(path+"criteria_type", CodeInvalidOption, "Criteria type is not supported by the eligibility checks")
+		}
+		v.required(path+"status", criteria.Status)
+		return
+	}
+
+	if criteria.CriteriaLevel != "" && !utils.IsValid(rule.Levels, criteria.CriteriaLevel) {
+		v.add(path+"criteria_level", CodeInvalidOption,
+			"Criteria type "+rule.Type+" is only valid at these levels, "+strings.TrimSpace(utils.FormatValidOptions(rule.Levels)))
+	}
+	v.oneOf(path+"status", criteria.Status, rule.Values)
+}
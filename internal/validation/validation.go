@@ -0,0 +1,117 @@
+// Validates the entities received by the API, collecting every violation instead of stopping at the first.
+package validation
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"fas/internal/utils"
+)
+
+// Codes describing why a field is invalid.
+const (
+	CodeRequired      = "required"
+	CodeInvalidOption = "invalid_option"
+	CodeInvalidFormat = "invalid_format"
+	CodeTooLong       = "too_long"
+	CodeFutureDate    = "future_date"
+	CodeOutOfRange    = "out_of_range"
+	CodeConflict      = "conflict"
+)
+
+// dateLayout is the format of every date exchanged through the API.
+const dateLayout = "2006-01-02"
+
+// maxNameLength matches the VARCHAR(100) name columns.
+const maxNameLength = 100
+
+// FieldError describes a single invalid field by its JSON path.
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// Errors is every violation found in an entity.
+type Errors []FieldError
+
+func (errs Errors) Error() string {
+	messages := make([]string, len(errs))
+	for i, e := range errs {
+		messages[i] = e.Field + ": " + e.Message
+	}
+	return strings.Join(messages, "; ")
+}
+
+// validator accumulates the violations found while checking an entity.
+type validator struct {
+	errs Errors
+}
+
+func (v *validator) add(field, code, message string) {
+	v.errs = append(v.errs, FieldError{Field: field, Code: code, Message: message})
+}
+
+// name checks that a name is present and fits its column.
+func (v *validator) name(field, value string) {
+	if strings.TrimSpace(value) == "" {
+		v.add(field, CodeRequired, "Name is required")
+	} else if len(value) > maxNameLength {
+		v.add(field, CodeTooLong, fmt.Sprintf("Name must be at most %d characters", maxNameLength))
+	}
+}
+
+// required checks that a value is present.
+func (v *validator) required(field, value string) bool {
+	if strings.TrimSpace(value) == "" {
+		v.add(field, CodeRequired, "Value is required")
+		return false
+	}
+	return true
+}
+
+// id checks that a value is a UUID.
+func (v *validator) id(field, value string) {
+	if err := utils.ValidateUUID(value); err != nil {
+		v.add(field, CodeInvalidFormat, "ID must be a UUID")
+	}
+}
+
+// oneOf checks that a value is one of its valid options.
+func (v *validator) oneOf(field, value string, options []string) {
+	if !v.required(field, value) {
+		return
+	}
+	if !utils.IsValid(options, value) {
+		v.add(field, CodeInvalidOption, "Invalid value, "+strings.TrimSpace(utils.FormatValidOptions(options)))
+	}
+}
+
+// pastDate checks that a value is a YYYY-MM-DD date that is not in the future.
+func (v *validator) pastDate(field, value string) {
+	if !v.required(field, value) {
+		return
+	}
+	date, err := time.Parse(dateLayout, value)
+	if err != nil {
+		v.add(field, CodeInvalidFormat, "Date must be in the format YYYY-MM-DD")
+		return
+	}
+	if date.After(time.Now()) {
+		v.add(field, CodeFutureDate, "Date must not be in the future")
+	}
+}
+
+// ToAPIError converts the violations into the body of an error response.
+func (errs Errors) ToAPIError() utils.APIError {
+	apiErr := utils.APIError{
+		Code:    utils.CodeValidationFailed,
+		Message: fmt.Sprintf("%d field(s) are invalid", len(errs)),
+		Details: errs,
+	}
+	if len(errs) == 1 {
+		apiErr.Field = errs[0].Field
+	}
+	return apiErr
+}